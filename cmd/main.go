@@ -7,6 +7,7 @@ import (
 	"syscall"
 
 	"github.com/Karzoug/meower-user-service/internal/app"
+	"github.com/Karzoug/meower-user-service/internal/migrate"
 
 	"github.com/rs/zerolog"
 )
@@ -18,6 +19,17 @@ func main() {
 
 	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate.RunCommand(ctx, os.Args[2:], os.Stdout, logger); err != nil {
+			logger.Error().
+				Err(err).
+				Msg("error running migrate command")
+			cancel()
+			os.Exit(1) //nolint:gocritic
+		}
+		return
+	}
+
 	if err := app.Run(ctx, logger); err != nil {
 		logger.Error().
 			Err(err).
@@ -2,17 +2,17 @@ package app
 
 import (
 	"context"
+	"errors"
 	"runtime"
 	"time"
 
-	"github.com/caarlos0/env/v11"
+	"github.com/rs/xid"
 	"github.com/rs/zerolog"
 	"go.opentelemetry.io/otel"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/Karzoug/meower-common-go/memcached"
 	"github.com/Karzoug/meower-common-go/metric/prom"
-	"github.com/Karzoug/meower-common-go/postgresql"
 	"github.com/Karzoug/meower-common-go/trace/otlp"
 
 	"github.com/Karzoug/meower-user-service/internal/config"
@@ -20,8 +20,17 @@ import (
 	userHandler "github.com/Karzoug/meower-user-service/internal/delivery/grpc/handler/user"
 	grpcServer "github.com/Karzoug/meower-user-service/internal/delivery/grpc/server"
 	"github.com/Karzoug/meower-user-service/internal/delivery/kafka"
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/broker"
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/confluent"
+	memoryBroker "github.com/Karzoug/meower-user-service/internal/delivery/kafka/memory"
+	"github.com/Karzoug/meower-user-service/internal/migrate"
+	"github.com/Karzoug/meower-user-service/internal/user/repo/breaker"
+	lruCache "github.com/Karzoug/meower-user-service/internal/user/repo/lru"
 	userCache "github.com/Karzoug/meower-user-service/internal/user/repo/memcached"
+	memoryRepo "github.com/Karzoug/meower-user-service/internal/user/repo/memory"
 	userRepo "github.com/Karzoug/meower-user-service/internal/user/repo/pg"
+	"github.com/Karzoug/meower-user-service/internal/user/repo/pg/cdc"
+	redisCache "github.com/Karzoug/meower-user-service/internal/user/repo/redis"
 	"github.com/Karzoug/meower-user-service/internal/user/service"
 	"github.com/Karzoug/meower-user-service/pkg/buildinfo"
 )
@@ -36,7 +45,7 @@ const (
 var serviceVersion = buildinfo.Get().ServiceVersion
 
 func Run(ctx context.Context, logger zerolog.Logger) error {
-	cfg, err := env.ParseAs[config.Config]()
+	cfg, err := config.Parse()
 	if err != nil {
 		return err
 	}
@@ -72,42 +81,200 @@ func Run(ctx context.Context, logger zerolog.Logger) error {
 	}
 	defer doClose(shutdownMeter, logger)
 
-	db, err := postgresql.NewDB(ctxInit, cfg.PG)
-	if err != nil {
-		return err
+	// set up repository of the selected backend
+	var (
+		repo    breaker.Repository
+		replica *userRepo.Replica
+	)
+	switch cfg.RepoBackend {
+	case config.RepoBackendMemory:
+		logger.Warn().
+			Msg("users are kept in memory: use it for local development only")
+
+		repo = memoryRepo.NewUserRepo()
+	default:
+		if err := migrateSchema(ctx, cfg.Migrate, cfg.PG.URI, logger); err != nil {
+			return err
+		}
+
+		db, err := userRepo.NewDB(ctxInit, *cfg.PG)
+		if err != nil {
+			return err
+		}
+		defer doClose(db.Close, logger)
+
+		// set up read replica if configured: short projection reads go to it while it is not lagging
+		if cfg.PGReplica.URI != "" {
+			replica, err = userRepo.NewReplica(cfg.PGReplica, logger)
+			if err != nil {
+				return err
+			}
+			defer doClose(replica.Close, logger)
+		}
+
+		// the outbox table is not needed if changes are captured from the WAL
+		repo = userRepo.NewUserRepo(db, replica, cfg.EventPublisher == config.EventPublisherOutbox)
 	}
-	defer doClose(db.Close, logger)
 
-	cache, err := memcached.NewStaticClient(ctxInit, cfg.Memcached, logger)
-	if err != nil {
-		return err
+	// set up shared cache of the selected backend
+	var projectionsCache lruCache.Cache
+	switch cfg.CacheBackend {
+	case config.CacheBackendRedis:
+		cache := redisCache.NewClient(ctxInit, *cfg.Redis, logger)
+		defer doClose(cache.Close, logger)
+
+		projectionsCache = redisCache.NewUserCache(cache.UniversalClient)
+	default:
+		cache, err := memcached.NewStaticClient(ctxInit, *cfg.Memcached, logger)
+		if err != nil {
+			return err
+		}
+		defer doClose(cache.Close, logger)
+
+		projectionsCache = userCache.NewUserCache(cfg.UserCache, cache)
+	}
+
+	// set up circuit breakers: requests skip the cache or fail fast
+	// while the cache or the database is unavailable
+	cacheBreaker := breaker.NewUserCache(cfg.CacheBreaker, projectionsCache, logger)
+	projectionsCache = cacheBreaker
+	repoBreaker := breaker.NewUserRepo(cfg.PGBreaker, repo, logger)
+
+	// set up message sources and sinks of the selected broker backend
+	var (
+		newSource, newBroadcastSource func(groupID string) (broker.Source, error)
+		newSink                       func() (broker.Sink, error)
+	)
+	switch cfg.BrokerBackend {
+	case config.BrokerBackendMemory:
+		logger.Warn().
+			Msg("kafka is replaced by an in-memory broker, no auth events are received: use it for local development only")
+
+		mb := memoryBroker.New(1)
+		newSource = func(groupID string) (broker.Source, error) {
+			return mb.NewSource(groupID), nil
+		}
+		newBroadcastSource = func(string) (broker.Source, error) {
+			return mb.NewBroadcastSource(), nil
+		}
+		newSink = func() (broker.Sink, error) {
+			return mb.NewSink(), nil
+		}
+	default:
+		newSource = func(groupID string) (broker.Source, error) {
+			return confluent.NewSource(ctxInit, *cfg.KafkaClient, groupID)
+		}
+		newBroadcastSource = func(groupID string) (broker.Source, error) {
+			return confluent.NewBroadcastSource(ctxInit, *cfg.KafkaClient, groupID)
+		}
+		newSink = func() (broker.Sink, error) {
+			return confluent.NewSink(ctxInit, *cfg.KafkaClient, logger)
+		}
+	}
+
+	// set up publisher of user changes captured from the WAL if selected instead of the outbox:
+	// the slot is created and verified before the server starts, so nothing is served without it
+	var runCDC func(context.Context) error
+	if cfg.EventPublisher == config.EventPublisherCDC {
+		sink, err := newSink()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := sink.Close(); err != nil {
+				logger.Error().
+					Err(err).
+					Msg("error closing")
+			}
+		}()
+
+		publisher, err := cdc.NewPublisher(ctxInit, *cfg.CDC, cfg.PG.URI, sink, cfg.Kafka.UserTopic, logger)
+		if err != nil {
+			return err
+		}
+		runCDC = publisher.Run
+	}
+
+	// set up two-tier cache if enabled:
+	// in-process entries are invalidated by user change events of all replicas
+	var runInvalidation func(context.Context) error
+	if cfg.LocalCache.Enabled {
+		localCache := lruCache.NewUserCache(cfg.LocalCache, projectionsCache)
+		projectionsCache = localCache
+
+		// every replica reads all events in its own consumer group
+		source, err := newBroadcastSource(cfg.Kafka.GroupID + "-cache-" + xid.New().String())
+		if err != nil {
+			return err
+		}
+		runInvalidation = kafka.NewInvalidationConsumer(cfg.Kafka.UserTopic, source, localCache, logger).Run
 	}
-	defer doClose(cache.Close, logger)
 
 	// set up service
 	us := service.NewUserService(
 		cfg.Service,
-		userRepo.NewUserRepo(db),
-		userCache.NewUserCache(cache),
+		repoBreaker,
+		projectionsCache,
 		logger,
 	)
+	defer doClose(us.Close, logger)
+
+	// warm up the cache before serving requests, but no longer than the budget
+	if cfg.Service.WarmUp.Enabled {
+		warmUpCache(ctx, us, time.Duration(cfg.Service.WarmUp.BudgetSeconds)*time.Second, logger)
+	}
 
 	// set up grpc server
+	healthComponents := []healthHandler.Component{
+		{
+			Name:      repoBreaker.Name(),
+			Available: repoBreaker.Available,
+			Required:  true,
+		},
+		{
+			Name:      cacheBreaker.Name(),
+			Available: cacheBreaker.Available,
+		},
+	}
+	if replica != nil {
+		healthComponents = append(healthComponents, healthHandler.Component{
+			Name:      replica.Name(),
+			Available: replica.Available,
+		})
+	}
 	grpcSrv := grpcServer.New(
 		cfg.GRPC,
 		[]grpcServer.ServiceRegister{
-			healthHandler.RegisterService(),
+			healthHandler.RegisterService(healthComponents...),
 			userHandler.RegisterService(us),
 		},
 		tracer,
 		logger,
 	)
 
-	// set up kafka consumer
-	uc, err := kafka.NewConsumer(ctxInit, cfg.Kafka, us, logger)
+	// set up kafka consumer with the dead letter topic if configured
+	var dlq broker.Sink
+	if cfg.Kafka.DLQTopic != "" {
+		dlq, err = newSink()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := dlq.Close(); err != nil {
+				logger.Error().
+					Err(err).
+					Msg("error closing")
+			}
+		}()
+	}
+	source, err := newSource(cfg.Kafka.GroupID)
 	if err != nil {
 		return err
 	}
+	uc, err := kafka.NewConsumer(cfg.Kafka, source, dlq, us, logger)
+	if err != nil {
+		return errors.Join(err, source.Close())
+	}
 
 	eg, ctx := errgroup.WithContext(ctx)
 	// run service grpc server
@@ -118,6 +285,24 @@ func Run(ctx context.Context, logger zerolog.Logger) error {
 	eg.Go(func() error {
 		return uc.Run(ctx)
 	})
+	// run kafka cache invalidation consumer
+	if runInvalidation != nil {
+		eg.Go(func() error {
+			return runInvalidation(ctx)
+		})
+	}
+	// run publisher of user changes captured from the WAL
+	if runCDC != nil {
+		eg.Go(func() error {
+			return runCDC(ctx)
+		})
+	}
+	// run read replica lag checks
+	if replica != nil {
+		eg.Go(func() error {
+			return replica.Run(ctx)
+		})
+	}
 	// run prometheus metrics http server
 	eg.Go(func() error {
 		return prom.Serve(ctx, cfg.PromHTTP, logger)
@@ -126,6 +311,49 @@ func Run(ctx context.Context, logger zerolog.Logger) error {
 	return eg.Wait()
 }
 
+// migrateSchema applies pending migrations if enabled
+// and refuses to start if the schema is still behind the binary.
+func migrateSchema(ctx context.Context, cfg migrate.Config, uri string, logger zerolog.Logger) error {
+	mg, err := migrate.New(cfg, uri, logger)
+	if err != nil {
+		return err
+	}
+	defer doClose(mg.Close, logger)
+
+	if cfg.Auto {
+		if err := mg.Up(ctx); err != nil {
+			return err
+		}
+	}
+
+	return mg.Check()
+}
+
+func warmUpCache(ctx context.Context, us service.UserService, budget time.Duration, logger zerolog.Logger) {
+	ctx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+
+	start := time.Now()
+	n, err := us.WarmUpCache(ctx)
+	switch {
+	case err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded):
+		logger.Warn().
+			Int("users", n).
+			Dur("budget", budget).
+			Msg("cache warm-up: budget exceeded")
+	case err != nil:
+		logger.Warn().
+			Int("users", n).
+			Err(err).
+			Msg("cache warm-up: failed")
+	default:
+		logger.Info().
+			Int("users", n).
+			Dur("duration", time.Since(start)).
+			Msg("cache warm-up: done")
+	}
+}
+
 func doClose(fn func(context.Context) error, logger zerolog.Logger) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -1,6 +1,11 @@
 package config
 
 import (
+	"fmt"
+
+	"github.com/caarlos0/env/v11"
+	"github.com/rs/zerolog"
+
 	"github.com/Karzoug/meower-common-go/memcached"
 	"github.com/Karzoug/meower-common-go/metric/prom"
 	"github.com/Karzoug/meower-common-go/postgresql"
@@ -8,18 +13,142 @@ import (
 
 	grpcSrv "github.com/Karzoug/meower-user-service/internal/delivery/grpc/server"
 	"github.com/Karzoug/meower-user-service/internal/delivery/kafka"
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/confluent"
+	"github.com/Karzoug/meower-user-service/internal/migrate"
+	"github.com/Karzoug/meower-user-service/internal/user/repo/breaker"
+	"github.com/Karzoug/meower-user-service/internal/user/repo/lru"
+	userCache "github.com/Karzoug/meower-user-service/internal/user/repo/memcached"
+	"github.com/Karzoug/meower-user-service/internal/user/repo/pg"
+	"github.com/Karzoug/meower-user-service/internal/user/repo/pg/cdc"
+	"github.com/Karzoug/meower-user-service/internal/user/repo/redis"
 	"github.com/Karzoug/meower-user-service/internal/user/service"
+)
 
-	"github.com/rs/zerolog"
+const (
+	RepoBackendPostgreSQL = "postgresql"
+	// RepoBackendMemory keeps users in memory, it is intended for local development
+	RepoBackendMemory = "memory"
+
+	CacheBackendMemcached = "memcached"
+	CacheBackendRedis     = "redis"
+
+	BrokerBackendKafka = "kafka"
+	// BrokerBackendMemory replaces kafka with an in-process broker, it is intended for local development.
+	// Nothing produces auth events to it, so users are never created or deleted by events:
+	// only user events published by the service itself with the cdc event publisher are consumed
+	BrokerBackendMemory = "memory"
+
+	// EventPublisherOutbox records user changes in the outbox table published by the outbox service
+	EventPublisherOutbox = "outbox"
+	// EventPublisherCDC publishes user changes captured from the WAL, it requires postgresql as the repository backend
+	EventPublisherCDC = "cdc"
 )
 
 type Config struct {
-	LogLevel  zerolog.Level     `env:"LOG_LEVEL" envDefault:"info"`
-	GRPC      grpcSrv.Config    `envPrefix:"GRPC_"`
-	PromHTTP  prom.ServerConfig `envPrefix:"PROM_"`
-	OTLP      otlp.Config       `envPrefix:"OTLP_"`
-	Service   service.Config    `envPrefix:"SERVICE_"`
-	PG        postgresql.Config `envPrefix:"PG_"`
-	Memcached memcached.Config  `envPrefix:"MEMCACHED_"`
-	Kafka     kafka.Config      `envPrefix:"KAFKA_"`
+	LogLevel    zerolog.Level     `env:"LOG_LEVEL" envDefault:"info"`
+	GRPC        grpcSrv.Config    `envPrefix:"GRPC_"`
+	PromHTTP    prom.ServerConfig `envPrefix:"PROM_"`
+	OTLP        otlp.Config       `envPrefix:"OTLP_"`
+	Service     service.Config    `envPrefix:"SERVICE_"`
+	RepoBackend string            `env:"REPO_BACKEND" envDefault:"postgresql"`
+	// PG is set only if postgresql is the repository backend
+	PG *postgresql.Config `envPrefix:"PG_"`
+	// PGReplica is used only if postgresql is the repository backend
+	PGReplica    pg.ReplicaConfig `envPrefix:"PG_REPLICA_"`
+	PGBreaker    breaker.Config   `envPrefix:"PG_BREAKER_"`
+	Migrate      migrate.Config   `envPrefix:"MIGRATE_"`
+	CacheBackend string           `env:"CACHE_BACKEND" envDefault:"memcached"`
+	// Memcached is set only if memcached is the cache backend
+	Memcached *memcached.Config `envPrefix:"MEMCACHED_"`
+	// Redis is set only if redis is the cache backend
+	Redis        *redis.Config    `envPrefix:"REDIS_"`
+	CacheBreaker breaker.Config   `envPrefix:"CACHE_BREAKER_"`
+	UserCache    userCache.Config `envPrefix:"USER_CACHE_"`
+	LocalCache   lru.Config       `envPrefix:"LOCAL_CACHE_"`
+	// BrokerBackend is kafka or memory, the memory broker receives no auth events
+	BrokerBackend string       `env:"BROKER_BACKEND" envDefault:"kafka"`
+	Kafka         kafka.Config `envPrefix:"KAFKA_"`
+	// KafkaClient is set only if kafka is the broker backend
+	KafkaClient    *confluent.Config `envPrefix:"KAFKA_"`
+	EventPublisher string            `env:"EVENT_PUBLISHER" envDefault:"outbox"`
+	// CDC is set only if cdc is the event publisher
+	CDC *cdc.Config `envPrefix:"CDC_"`
+}
+
+// Parse parses the config from environment variables,
+// only the configs of the selected repository, cache and broker backends
+// and of the event publisher are parsed and required.
+func Parse() (Config, error) {
+	cfg, err := env.ParseAs[Config]()
+	if err != nil {
+		return Config{}, err
+	}
+
+	switch cfg.RepoBackend {
+	case RepoBackendPostgreSQL:
+		cfg.PG = &postgresql.Config{}
+		err = env.ParseWithOptions(cfg.PG, env.Options{Prefix: "PG_"})
+		if err == nil && cfg.PGReplica.URI != "" {
+			err = cfg.PGReplica.Validate()
+		}
+	case RepoBackendMemory:
+	default:
+		return Config{}, fmt.Errorf("unknown repository backend: %q", cfg.RepoBackend)
+	}
+	if err != nil {
+		return Config{}, err
+	}
+
+	switch cfg.CacheBackend {
+	case CacheBackendMemcached:
+		cfg.Memcached = &memcached.Config{}
+		err = env.ParseWithOptions(cfg.Memcached, env.Options{Prefix: "MEMCACHED_"})
+	case CacheBackendRedis:
+		cfg.Redis = &redis.Config{}
+		err = env.ParseWithOptions(cfg.Redis, env.Options{Prefix: "REDIS_"})
+	default:
+		return Config{}, fmt.Errorf("unknown cache backend: %q", cfg.CacheBackend)
+	}
+	if err != nil {
+		return Config{}, err
+	}
+
+	switch cfg.BrokerBackend {
+	case BrokerBackendKafka:
+		cfg.KafkaClient = &confluent.Config{}
+		if err = env.ParseWithOptions(cfg.KafkaClient, env.Options{Prefix: "KAFKA_"}); err == nil {
+			err = cfg.KafkaClient.Validate()
+		}
+	case BrokerBackendMemory:
+	default:
+		return Config{}, fmt.Errorf("unknown broker backend: %q", cfg.BrokerBackend)
+	}
+	if err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Kafka.Validate(); err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Service.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	switch cfg.EventPublisher {
+	case EventPublisherCDC:
+		if cfg.RepoBackend != RepoBackendPostgreSQL {
+			return Config{}, fmt.Errorf("cdc event publisher requires %s repository backend", RepoBackendPostgreSQL)
+		}
+		cfg.CDC = &cdc.Config{}
+		if err = env.ParseWithOptions(cfg.CDC, env.Options{Prefix: "CDC_"}); err == nil {
+			err = cfg.CDC.Validate()
+		}
+	case EventPublisherOutbox:
+	default:
+		return Config{}, fmt.Errorf("unknown event publisher: %q", cfg.EventPublisher)
+	}
+	if err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
 }
@@ -1,6 +1,9 @@
 package converter
 
 import (
+	"github.com/rs/xid"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
 	gen "github.com/Karzoug/meower-user-service/internal/delivery/grpc/gen/user/v1"
 	"github.com/Karzoug/meower-user-service/internal/user/entity"
 )
@@ -12,6 +15,7 @@ func ToProtoUser(u entity.User) *gen.User {
 		Name:       u.Name,
 		ImageUrl:   u.ImageURL,
 		StatusText: u.StatusText,
+		UpdatedAt:  timestamppb.New(u.UpdatedAt),
 	}
 }
 
@@ -33,3 +37,21 @@ func ToProtoUserShortProjections(users []entity.UserShortProjection) []*gen.User
 
 	return projections
 }
+
+func ToProtoUserShortProjectionsMap(users map[string]entity.UserShortProjection) map[string]*gen.UserShortProjection {
+	projections := make(map[string]*gen.UserShortProjection, len(users))
+	for key := range users {
+		projections[key] = ToProtoUserShortProjection(users[key])
+	}
+
+	return projections
+}
+
+func ToProtoIDs(ids []xid.ID) []string {
+	res := make([]string, len(ids))
+	for i := range ids {
+		res[i] = ids[i].String()
+	}
+
+	return res
+}
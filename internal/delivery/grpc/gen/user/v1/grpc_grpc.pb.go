@@ -20,9 +20,10 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	UserService_GetUser_FullMethodName                  = "/user.v1.UserService/GetUser"
-	UserService_GetShortProjection_FullMethodName       = "/user.v1.UserService/GetShortProjection"
-	UserService_BatchGetShortProjections_FullMethodName = "/user.v1.UserService/BatchGetShortProjections"
+	UserService_GetUser_FullMethodName                             = "/user.v1.UserService/GetUser"
+	UserService_GetShortProjection_FullMethodName                  = "/user.v1.UserService/GetShortProjection"
+	UserService_BatchGetShortProjections_FullMethodName            = "/user.v1.UserService/BatchGetShortProjections"
+	UserService_BatchGetShortProjectionsByUsernames_FullMethodName = "/user.v1.UserService/BatchGetShortProjectionsByUsernames"
 )
 
 // UserServiceClient is the client API for UserService service.
@@ -39,6 +40,7 @@ type UserServiceClient interface {
 	GetUser(ctx context.Context, in *GetUserRequest, opts ...grpc.CallOption) (*User, error)
 	GetShortProjection(ctx context.Context, in *GetShortProjectionRequest, opts ...grpc.CallOption) (*UserShortProjection, error)
 	BatchGetShortProjections(ctx context.Context, in *BatchGetShortProjectionsRequest, opts ...grpc.CallOption) (*BatchGetShortProjectionsResponse, error)
+	BatchGetShortProjectionsByUsernames(ctx context.Context, in *BatchGetShortProjectionsByUsernamesRequest, opts ...grpc.CallOption) (*BatchGetShortProjectionsByUsernamesResponse, error)
 }
 
 type userServiceClient struct {
@@ -79,6 +81,16 @@ func (c *userServiceClient) BatchGetShortProjections(ctx context.Context, in *Ba
 	return out, nil
 }
 
+func (c *userServiceClient) BatchGetShortProjectionsByUsernames(ctx context.Context, in *BatchGetShortProjectionsByUsernamesRequest, opts ...grpc.CallOption) (*BatchGetShortProjectionsByUsernamesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchGetShortProjectionsByUsernamesResponse)
+	err := c.cc.Invoke(ctx, UserService_BatchGetShortProjectionsByUsernames_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // UserServiceServer is the server API for UserService service.
 // All implementations must embed UnimplementedUserServiceServer
 // for forward compatibility.
@@ -93,6 +105,7 @@ type UserServiceServer interface {
 	GetUser(context.Context, *GetUserRequest) (*User, error)
 	GetShortProjection(context.Context, *GetShortProjectionRequest) (*UserShortProjection, error)
 	BatchGetShortProjections(context.Context, *BatchGetShortProjectionsRequest) (*BatchGetShortProjectionsResponse, error)
+	BatchGetShortProjectionsByUsernames(context.Context, *BatchGetShortProjectionsByUsernamesRequest) (*BatchGetShortProjectionsByUsernamesResponse, error)
 	mustEmbedUnimplementedUserServiceServer()
 }
 
@@ -112,6 +125,9 @@ func (UnimplementedUserServiceServer) GetShortProjection(context.Context, *GetSh
 func (UnimplementedUserServiceServer) BatchGetShortProjections(context.Context, *BatchGetShortProjectionsRequest) (*BatchGetShortProjectionsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method BatchGetShortProjections not implemented")
 }
+func (UnimplementedUserServiceServer) BatchGetShortProjectionsByUsernames(context.Context, *BatchGetShortProjectionsByUsernamesRequest) (*BatchGetShortProjectionsByUsernamesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchGetShortProjectionsByUsernames not implemented")
+}
 func (UnimplementedUserServiceServer) mustEmbedUnimplementedUserServiceServer() {}
 func (UnimplementedUserServiceServer) testEmbeddedByValue()                     {}
 
@@ -187,6 +203,24 @@ func _UserService_BatchGetShortProjections_Handler(srv interface{}, ctx context.
 	return interceptor(ctx, in, info, handler)
 }
 
+func _UserService_BatchGetShortProjectionsByUsernames_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetShortProjectionsByUsernamesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).BatchGetShortProjectionsByUsernames(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_BatchGetShortProjectionsByUsernames_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).BatchGetShortProjectionsByUsernames(ctx, req.(*BatchGetShortProjectionsByUsernamesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // UserService_ServiceDesc is the grpc.ServiceDesc for UserService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -206,6 +240,10 @@ var UserService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "BatchGetShortProjections",
 			Handler:    _UserService_BatchGetShortProjections_Handler,
 		},
+		{
+			MethodName: "BatchGetShortProjectionsByUsernames",
+			Handler:    _UserService_BatchGetShortProjectionsByUsernames_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "user/v1/grpc.proto",
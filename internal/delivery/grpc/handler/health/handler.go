@@ -10,8 +10,18 @@ import (
 	"google.golang.org/grpc/status"
 )
 
-func RegisterService() func(grpcServer *grpc.Server) {
-	hdl := handlers{}
+// Component is a dependency of the service, its status is checked by the name as a service.
+type Component struct {
+	Name      string
+	Available func() bool
+	// Required means that the service can't serve requests without the component
+	Required bool
+}
+
+func RegisterService(components ...Component) func(grpcServer *grpc.Server) {
+	hdl := handlers{
+		components: components,
+	}
 
 	return func(grpcServer *grpc.Server) {
 		health.RegisterHealthServer(grpcServer, hdl)
@@ -20,14 +30,40 @@ func RegisterService() func(grpcServer *grpc.Server) {
 
 type handlers struct {
 	health.UnimplementedHealthServer
+	components []Component
 }
 
 func (h handlers) Check(ctx context.Context, req *health.HealthCheckRequest) (*health.HealthCheckResponse, error) {
-	return &health.HealthCheckResponse{
-		Status: health.HealthCheckResponse_SERVING,
-	}, nil
+	if req.GetService() == "" {
+		for _, c := range h.components {
+			if c.Required && !c.Available() {
+				return newResponse(false), nil
+			}
+		}
+		return newResponse(true), nil
+	}
+
+	for _, c := range h.components {
+		if c.Name == req.GetService() {
+			return newResponse(c.Available()), nil
+		}
+	}
+
+	return nil, status.Error(codes.NotFound, "unknown service")
 }
 
 func (h handlers) Watch(req *health.HealthCheckRequest, ss grpc.ServerStreamingServer[health.HealthCheckResponse]) error {
 	return status.Error(codes.Unimplemented, "unimplemented")
 }
+
+func newResponse(serving bool) *health.HealthCheckResponse {
+	if !serving {
+		return &health.HealthCheckResponse{
+			Status: health.HealthCheckResponse_NOT_SERVING,
+		}
+	}
+
+	return &health.HealthCheckResponse{
+		Status: health.HealthCheckResponse_SERVING,
+	}
+}
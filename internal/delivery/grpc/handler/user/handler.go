@@ -2,6 +2,8 @@ package user
 
 import (
 	"context"
+	"slices"
+	"time"
 
 	"google.golang.org/grpc"
 
@@ -40,7 +42,12 @@ func (h handlers) GetUser(ctx context.Context, req *gen.GetUserRequest) (*gen.Us
 		return nil, status.Error(codes.InvalidArgument, "invalid id: "+req.Id)
 	}
 
-	user, err := h.userService.Get(ctx, auth.UserIDFromContext(ctx), id)
+	var minUpdatedAt time.Time
+	if req.MinUpdatedAt != nil {
+		minUpdatedAt = req.MinUpdatedAt.AsTime()
+	}
+
+	user, err := h.userService.Get(ctx, auth.UserIDFromContext(ctx), id, minUpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -93,12 +100,42 @@ func (h handlers) BatchGetShortProjections(ctx context.Context, req *gen.BatchGe
 		}
 	}
 
-	users, err := h.userService.BatchGetShortProjections(ctx, ids)
+	users, notFoundIDs, err := h.userService.BatchGetShortProjections(ctx, ids)
 	if err != nil {
 		return nil, err
 	}
 
 	return &gen.BatchGetShortProjectionsResponse{
-		Users: converter.ToProtoUserShortProjections(users),
+		Users:       converter.ToProtoUserShortProjections(users),
+		NotFoundIds: converter.ToProtoIDs(notFoundIDs),
+	}, nil
+}
+
+func (h handlers) BatchGetShortProjectionsByUsernames(ctx context.Context, req *gen.BatchGetShortProjectionsByUsernamesRequest) (*gen.BatchGetShortProjectionsByUsernamesResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "empty request")
+	}
+
+	for _, username := range req.Usernames {
+		if username == "" {
+			return nil, status.Error(codes.InvalidArgument, "empty username")
+		}
+	}
+
+	users, err := h.userService.BatchGetShortProjectionsByUsernames(ctx, req.Usernames)
+	if err != nil {
+		return nil, err
+	}
+
+	notFound := make([]string, 0)
+	for _, username := range req.Usernames {
+		if _, ok := users[username]; !ok && !slices.Contains(notFound, username) {
+			notFound = append(notFound, username)
+		}
+	}
+
+	return &gen.BatchGetShortProjectionsByUsernamesResponse{
+		Users:             converter.ToProtoUserShortProjectionsMap(users),
+		NotFoundUsernames: notFound,
 	}, nil
 }
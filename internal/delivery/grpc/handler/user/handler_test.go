@@ -0,0 +1,308 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	health "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	gen "github.com/Karzoug/meower-user-service/internal/delivery/grpc/gen/user/v1"
+	healthHandler "github.com/Karzoug/meower-user-service/internal/delivery/grpc/handler/health"
+	userHandler "github.com/Karzoug/meower-user-service/internal/delivery/grpc/handler/user"
+	grpcServer "github.com/Karzoug/meower-user-service/internal/delivery/grpc/server"
+	"github.com/Karzoug/meower-user-service/internal/user/entity"
+	"github.com/Karzoug/meower-user-service/internal/user/repo"
+	"github.com/Karzoug/meower-user-service/internal/user/service/servicetest"
+)
+
+const userIDKey = "x-user-id"
+
+// newClient serves the user service with fakes by the server with all interceptors.
+func newClient(t *testing.T) (gen.UserServiceClient, *grpc.ClientConn, *servicetest.Harness) {
+	t.Helper()
+
+	h := servicetest.New(t)
+	srv := grpcServer.New(
+		grpcServer.Config{},
+		[]grpcServer.ServiceRegister{
+			healthHandler.RegisterService(healthHandler.Component{
+				Name:      "postgres",
+				Available: func() bool { return true },
+				Required:  true,
+			}),
+			userHandler.RegisterService(h.Service),
+		},
+		noop.NewTracerProvider().Tracer(""),
+		zerolog.Nop(),
+	)
+
+	lis := bufconn.Listen(1 << 20)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(ctx, lis)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			t.Errorf("serve error = %v", err)
+		}
+	})
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return gen.NewUserServiceClient(conn), conn, h
+}
+
+func TestGetUser(t *testing.T) {
+	client, _, h := newClient(t)
+	u := createUser(t, h, "alice")
+
+	tests := []struct {
+		name     string
+		userID   string
+		id       string
+		setup    func()
+		wantCode codes.Code
+	}{
+		{
+			name:   "ok",
+			userID: u.ID.String(),
+			id:     u.ID.String(),
+		},
+		{
+			name:     "anonymous",
+			id:       u.ID.String(),
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "another user",
+			userID:   xid.New().String(),
+			id:       u.ID.String(),
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "invalid caller id",
+			userID:   "invalid",
+			id:       u.ID.String(),
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "invalid id",
+			userID:   u.ID.String(),
+			id:       "invalid",
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:   "repository error",
+			userID: u.ID.String(),
+			id:     u.ID.String(),
+			setup: func() {
+				// the user is cached by the first case
+				h.Cache.Fail(errors.New("cache is down"))
+				h.Repo.Fail(errors.New("boom"))
+			},
+			wantCode: codes.Internal,
+		},
+		{
+			name:   "repository unavailable",
+			userID: u.ID.String(),
+			id:     u.ID.String(),
+			setup: func() {
+				// the user is cached by the first case
+				h.Cache.Fail(errors.New("cache is down"))
+				h.Repo.Fail(repo.ErrUnavailable)
+			},
+			wantCode: codes.Unavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.setup != nil {
+				tt.setup()
+				t.Cleanup(func() {
+					h.Cache.Fail(nil)
+					h.Repo.Fail(nil)
+				})
+			}
+
+			ctx := context.Background()
+			if tt.userID != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, userIDKey, tt.userID)
+			}
+
+			got, err := client.GetUser(ctx, &gen.GetUserRequest{Id: tt.id})
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("GetUser() error = %v, want code %v", err, tt.wantCode)
+			}
+			if tt.wantCode != codes.OK {
+				return
+			}
+
+			if got.GetId() != u.ID.String() || got.GetUsername() != u.Username {
+				t.Errorf("GetUser() = %v, want user %v", got, u)
+			}
+			if !got.GetUpdatedAt().AsTime().Equal(u.UpdatedAt) {
+				t.Errorf("GetUser() updated at = %v, want %v", got.GetUpdatedAt().AsTime(), u.UpdatedAt)
+			}
+		})
+	}
+}
+
+func TestGetShortProjection(t *testing.T) {
+	client, _, h := newClient(t)
+	u := createUser(t, h, "alice")
+
+	tests := []struct {
+		name     string
+		req      *gen.GetShortProjectionRequest
+		wantCode codes.Code
+	}{
+		{
+			name: "by id",
+			req:  &gen.GetShortProjectionRequest{ByOneof: &gen.GetShortProjectionRequest_Id{Id: u.ID.String()}},
+		},
+		{
+			name: "by username",
+			req:  &gen.GetShortProjectionRequest{ByOneof: &gen.GetShortProjectionRequest_Username{Username: u.Username}},
+		},
+		{
+			name:     "empty",
+			req:      &gen.GetShortProjectionRequest{},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "invalid id",
+			req:      &gen.GetShortProjectionRequest{ByOneof: &gen.GetShortProjectionRequest_Id{Id: "invalid"}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "not found",
+			req:      &gen.GetShortProjectionRequest{ByOneof: &gen.GetShortProjectionRequest_Id{Id: xid.New().String()}},
+			wantCode: codes.NotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := client.GetShortProjection(context.Background(), tt.req)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("GetShortProjection() error = %v, want code %v", err, tt.wantCode)
+			}
+			if tt.wantCode == codes.OK && got.GetId() != u.ID.String() {
+				t.Errorf("GetShortProjection() id = %q, want %q", got.GetId(), u.ID.String())
+			}
+		})
+	}
+}
+
+func TestBatchGetShortProjections(t *testing.T) {
+	client, _, h := newClient(t)
+	alice, bob := createUser(t, h, "alice"), createUser(t, h, "bob")
+	unknown := xid.New().String()
+
+	resp, err := client.BatchGetShortProjections(context.Background(), &gen.BatchGetShortProjectionsRequest{
+		Ids: []string{bob.ID.String(), unknown, alice.ID.String()},
+	})
+	if err != nil {
+		t.Fatalf("BatchGetShortProjections() error = %v", err)
+	}
+
+	var ids []string
+	for _, u := range resp.GetUsers() {
+		ids = append(ids, u.GetId())
+	}
+	if want := []string{bob.ID.String(), alice.ID.String()}; !slices.Equal(ids, want) {
+		t.Errorf("BatchGetShortProjections() ids = %v, want %v", ids, want)
+	}
+	if want := []string{unknown}; !slices.Equal(resp.GetNotFoundIds(), want) {
+		t.Errorf("BatchGetShortProjections() not found ids = %v, want %v", resp.GetNotFoundIds(), want)
+	}
+
+	_, err = client.BatchGetShortProjections(context.Background(), &gen.BatchGetShortProjectionsRequest{
+		Ids: []string{"invalid"},
+	})
+	if code := status.Code(err); code != codes.InvalidArgument {
+		t.Errorf("BatchGetShortProjections() with invalid id error = %v, want code %v", err, codes.InvalidArgument)
+	}
+}
+
+func TestBatchGetShortProjectionsByUsernames(t *testing.T) {
+	client, _, h := newClient(t)
+	alice := createUser(t, h, "alice")
+
+	resp, err := client.BatchGetShortProjectionsByUsernames(context.Background(), &gen.BatchGetShortProjectionsByUsernamesRequest{
+		Usernames: []string{"bob", "alice", "bob"},
+	})
+	if err != nil {
+		t.Fatalf("BatchGetShortProjectionsByUsernames() error = %v", err)
+	}
+
+	if got := resp.GetUsers()["alice"].GetId(); got != alice.ID.String() || len(resp.GetUsers()) != 1 {
+		t.Errorf("BatchGetShortProjectionsByUsernames() users = %v, want only alice", resp.GetUsers())
+	}
+	if want := []string{"bob"}; !slices.Equal(resp.GetNotFoundUsernames(), want) {
+		t.Errorf("BatchGetShortProjectionsByUsernames() not found = %v, want %v", resp.GetNotFoundUsernames(), want)
+	}
+
+	_, err = client.BatchGetShortProjectionsByUsernames(context.Background(), &gen.BatchGetShortProjectionsByUsernamesRequest{
+		Usernames: []string{""},
+	})
+	if code := status.Code(err); code != codes.InvalidArgument {
+		t.Errorf("BatchGetShortProjectionsByUsernames() with empty username error = %v, want code %v", err, codes.InvalidArgument)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	_, conn, _ := newClient(t)
+	client := health.NewHealthClient(conn)
+
+	resp, err := client.Check(context.Background(), &health.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if resp.GetStatus() != health.HealthCheckResponse_SERVING {
+		t.Errorf("Check() status = %v, want %v", resp.GetStatus(), health.HealthCheckResponse_SERVING)
+	}
+
+	_, err = client.Check(context.Background(), &health.HealthCheckRequest{Service: "unknown"})
+	if code := status.Code(err); code != codes.NotFound {
+		t.Errorf("Check() of unknown service error = %v, want code %v", err, codes.NotFound)
+	}
+}
+
+func createUser(t *testing.T, h *servicetest.Harness, username string) entity.User {
+	t.Helper()
+
+	u := entity.NewUser(username)
+	if _, err := h.Repo.Create(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := h.Repo.GetOne(context.Background(), u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return got
+}
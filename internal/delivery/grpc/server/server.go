@@ -79,6 +79,11 @@ func (s *server) Run(ctx context.Context) error {
 
 	s.logger.Info().Str("address", s.cfg.Address()).Msg("listening")
 
+	return s.Serve(ctx, list)
+}
+
+// Serve serves requests on the listener until the context is done.
+func (s *server) Serve(ctx context.Context, list net.Listener) error {
 	go func() {
 		<-ctx.Done()
 		s.grpcServer.GracefulStop()
@@ -0,0 +1,112 @@
+// Package broker defines a source of messages read by the consumers and a sink of messages
+// produced by them, so the consumers do not depend on a particular client of the message broker.
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrFatal is returned by the source if it is not usable anymore and must be closed.
+var ErrFatal = errors.New("fatal broker error")
+
+// Header is a message header.
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Message is a message read from a topic partition.
+type Message struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   []Header
+	Timestamp time.Time
+}
+
+// TopicPartition returns the position of the message.
+func (m *Message) TopicPartition() TopicPartition {
+	return TopicPartition{
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
+	}
+}
+
+// Header returns the value of the first header with the key.
+func (m *Message) Header(key string) ([]byte, bool) {
+	for _, header := range m.Headers {
+		if header.Key == key {
+			return header.Value, true
+		}
+	}
+	return nil, false
+}
+
+// TopicPartition is a partition of a topic with an offset in it.
+type TopicPartition struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+}
+
+func (tp TopicPartition) String() string {
+	return fmt.Sprintf("%s[%d]", tp.Topic, tp.Partition)
+}
+
+// PartitionLag is a number of messages of a partition after the committed offset.
+type PartitionLag struct {
+	Topic     string
+	Partition int32
+	Lag       int64
+}
+
+type RebalanceType int
+
+const (
+	PartitionsAssigned RebalanceType = iota + 1
+	PartitionsRevoked
+	// PartitionsLost are revoked partitions that may be already assigned to another consumer,
+	// so their offsets must not be committed
+	PartitionsLost
+)
+
+// RebalanceEvent is a change of partitions assigned to the source.
+type RebalanceEvent struct {
+	Type       RebalanceType
+	Partitions []TopicPartition
+}
+
+// RebalanceFunc is called by the source on partition assignment changes before they take effect.
+type RebalanceFunc func(ev RebalanceEvent) error
+
+// Source is a consumer group member reading messages of a topic.
+// Offsets stored by StoreOffsets are committed periodically, by Commit and on Close.
+type Source interface {
+	// Subscribe joins the consumer group and subscribes to the topic,
+	// rebalance may be nil if assignment changes are not of interest.
+	Subscribe(topic string, rebalance RebalanceFunc) error
+	// Poll returns the next message or nil if there is no message within the timeout.
+	// Errors not wrapping ErrFatal are temporary.
+	Poll(timeout time.Duration) (*Message, error)
+	// StoreOffsets stores offsets of the next messages to read for the next commit.
+	StoreOffsets(tps []TopicPartition) error
+	// Commit synchronously commits stored offsets, it is a no-op if nothing is stored.
+	Commit() error
+	// Lag returns the lag of assigned partitions.
+	Lag() ([]PartitionLag, error)
+	Close() error
+}
+
+// Sink is a producer of messages.
+type Sink interface {
+	// Produce synchronously produces the message to its topic,
+	// the partition is chosen by the key, the offset is ignored.
+	Produce(ctx context.Context, msg *Message) error
+	Close() error
+}
@@ -1,10 +1,56 @@
 package kafka
 
+import (
+	"errors"
+	"fmt"
+)
+
 type Config struct {
-	// Kafka brokers addresses separated by comma
-	Brokers string `env:"BROKERS,notEmpty"`
+	// AuthTopic is a topic of the auth change events, e.g. staging.auth on a shared cluster
+	AuthTopic string `env:"AUTH_TOPIC" envDefault:"auth"`
+	// UserTopic is a topic of the user change events emitted by the service,
+	// it is read to invalidate the in-process cache
+	UserTopic string `env:"USER_TOPIC" envDefault:"user"`
 	// GroupID is a kafka consumer group id
 	GroupID string `env:"GROUP_ID,notEmpty" envDefault:"user-service"`
-	// CommitInterval defines how often to flush commits to Kafka
-	CommitIntervalMilliseconds int `env:"COMMIT_INTERVAL_MILLISECONDS" envDefault:"500"`
+	// Workers is a number of workers processing messages concurrently,
+	// messages with the same key are processed by the same worker in order
+	Workers int `env:"WORKERS" envDefault:"8"`
+	// WorkerQueueSize is a number of messages waiting for a busy worker before reading is paused
+	WorkerQueueSize int `env:"WORKER_QUEUE_SIZE" envDefault:"64"`
+	// DrainTimeoutSeconds is a time to wait for in-flight messages before partitions are revoked
+	// or the consumer is closed, messages not finished in time are processed again by the next owner
+	DrainTimeoutSeconds int `env:"DRAIN_TIMEOUT_SECONDS" envDefault:"10"`
+	// DLQTopic is a topic of messages that can't be handled: of unknown message or change type,
+	// with invalid payload or failing on every retry. Such messages are only counted if it is empty
+	DLQTopic string `env:"DLQ_TOPIC"`
+}
+
+// Validate reports all invalid settings at once.
+func (cfg Config) Validate() error {
+	var errs []error
+
+	if cfg.AuthTopic == "" {
+		errs = append(errs, errors.New("auth topic is empty"))
+	}
+	if cfg.UserTopic == "" {
+		errs = append(errs, errors.New("user topic is empty"))
+	}
+	if cfg.DLQTopic != "" && (cfg.DLQTopic == cfg.AuthTopic || cfg.DLQTopic == cfg.UserTopic) {
+		errs = append(errs, fmt.Errorf("dead letter topic %s must differ from the consumed topics", cfg.DLQTopic))
+	}
+	if cfg.Workers < 1 {
+		errs = append(errs, fmt.Errorf("workers %d must be positive", cfg.Workers))
+	}
+	if cfg.WorkerQueueSize < 0 {
+		errs = append(errs, fmt.Errorf("worker queue size %d must not be negative", cfg.WorkerQueueSize))
+	}
+	if cfg.DrainTimeoutSeconds < 0 {
+		errs = append(errs, fmt.Errorf("drain timeout %ds must not be negative", cfg.DrainTimeoutSeconds))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid kafka consumer config: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,169 @@
+package confluent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+const (
+	SecurityProtocolPlaintext     = "plaintext"
+	SecurityProtocolSSL           = "ssl"
+	SecurityProtocolSASLPlaintext = "sasl_plaintext"
+	SecurityProtocolSASLSSL       = "sasl_ssl"
+)
+
+var (
+	securityProtocols = []string{
+		SecurityProtocolPlaintext,
+		SecurityProtocolSSL,
+		SecurityProtocolSASLPlaintext,
+		SecurityProtocolSASLSSL,
+	}
+	saslMechanisms = []string{"PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512"}
+	offsetResets   = []string{"earliest", "latest"}
+	// managedProperties are set by the service, overriding them breaks offset handling
+	managedProperties = []string{
+		"bootstrap.servers",
+		"group.id",
+		"enable.auto.commit",
+		"enable.auto.offset.store",
+	}
+)
+
+type Config struct {
+	// Kafka brokers addresses separated by comma
+	Brokers string `env:"BROKERS,notEmpty"`
+	// CommitInterval defines how often to flush commits to Kafka
+	CommitIntervalMilliseconds int `env:"COMMIT_INTERVAL_MILLISECONDS" envDefault:"500"`
+	// AutoOffsetReset is where the consumer group starts reading a partition without committed offset:
+	// earliest or latest, the cache invalidation consumer always starts from the latest
+	AutoOffsetReset string `env:"AUTO_OFFSET_RESET" envDefault:"earliest"`
+	// SecurityProtocol is one of plaintext, ssl, sasl_plaintext or sasl_ssl
+	SecurityProtocol string `env:"SECURITY_PROTOCOL" envDefault:"plaintext"`
+	// SASLMechanism is one of PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512, it is required for sasl protocols
+	SASLMechanism string `env:"SASL_MECHANISM"`
+	SASLUsername  string `env:"SASL_USERNAME"`
+	SASLPassword  string `env:"SASL_PASSWORD"`
+	// CAFile is a path to CA certificates to verify brokers with ssl protocols,
+	// the system certificates are used if empty
+	CAFile string `env:"CA_FILE"`
+	// SessionTimeoutMilliseconds is a time after which the consumer without heartbeats leaves the group
+	SessionTimeoutMilliseconds int `env:"SESSION_TIMEOUT_MILLISECONDS" envDefault:"45000"`
+	// HeartbeatIntervalMilliseconds must be lower than the session timeout, usually a third of it
+	HeartbeatIntervalMilliseconds int `env:"HEARTBEAT_INTERVAL_MILLISECONDS" envDefault:"3000"`
+	// MaxPollIntervalMilliseconds is a maximum time between reads before the consumer leaves the group,
+	// it must be longer than the handler retries and not lower than the session timeout
+	MaxPollIntervalMilliseconds int `env:"MAX_POLL_INTERVAL_MILLISECONDS" envDefault:"300000"`
+	// Overrides are librdkafka properties applied over all others, e.g. client.rack:eu-1a,fetch.wait.max.ms:100
+	Overrides map[string]string `env:"OVERRIDES"`
+}
+
+// Validate reports all invalid settings at once.
+func (cfg Config) Validate() error {
+	var errs []error
+
+	if !slices.Contains(offsetResets, cfg.AutoOffsetReset) {
+		errs = append(errs, fmt.Errorf("auto offset reset %q is not one of %s",
+			cfg.AutoOffsetReset, strings.Join(offsetResets, ", ")))
+	}
+
+	protocol := strings.ToLower(cfg.SecurityProtocol)
+	sasl := protocol == SecurityProtocolSASLPlaintext || protocol == SecurityProtocolSASLSSL
+	ssl := protocol == SecurityProtocolSSL || protocol == SecurityProtocolSASLSSL
+	if !slices.Contains(securityProtocols, protocol) {
+		errs = append(errs, fmt.Errorf("security protocol %q is not one of %s",
+			cfg.SecurityProtocol, strings.Join(securityProtocols, ", ")))
+	}
+
+	switch {
+	case sasl:
+		if !slices.Contains(saslMechanisms, strings.ToUpper(cfg.SASLMechanism)) {
+			errs = append(errs, fmt.Errorf("sasl mechanism %q is not one of %s",
+				cfg.SASLMechanism, strings.Join(saslMechanisms, ", ")))
+		}
+		if cfg.SASLUsername == "" || cfg.SASLPassword == "" {
+			errs = append(errs, fmt.Errorf("sasl username and password are required with %s protocol", protocol))
+		}
+	case cfg.SASLMechanism != "" || cfg.SASLUsername != "" || cfg.SASLPassword != "":
+		errs = append(errs, fmt.Errorf("sasl settings are set, but the security protocol is %s", cfg.SecurityProtocol))
+	}
+
+	if cfg.CAFile != "" {
+		if !ssl {
+			errs = append(errs, fmt.Errorf("ca file is set, but the security protocol is %s", cfg.SecurityProtocol))
+		} else if _, err := os.Stat(cfg.CAFile); err != nil {
+			errs = append(errs, fmt.Errorf("ca file: %w", err))
+		}
+	}
+
+	if cfg.SessionTimeoutMilliseconds <= 0 ||
+		cfg.HeartbeatIntervalMilliseconds <= 0 ||
+		cfg.MaxPollIntervalMilliseconds <= 0 ||
+		cfg.CommitIntervalMilliseconds <= 0 {
+		errs = append(errs, errors.New("timeouts and intervals must be positive"))
+	}
+	if cfg.HeartbeatIntervalMilliseconds >= cfg.SessionTimeoutMilliseconds {
+		errs = append(errs, fmt.Errorf("heartbeat interval %dms must be lower than session timeout %dms",
+			cfg.HeartbeatIntervalMilliseconds, cfg.SessionTimeoutMilliseconds))
+	}
+	if cfg.MaxPollIntervalMilliseconds < cfg.SessionTimeoutMilliseconds {
+		errs = append(errs, fmt.Errorf("max poll interval %dms must not be lower than session timeout %dms",
+			cfg.MaxPollIntervalMilliseconds, cfg.SessionTimeoutMilliseconds))
+	}
+
+	for key := range cfg.Overrides {
+		if slices.Contains(managedProperties, key) {
+			errs = append(errs, fmt.Errorf("property %s can't be overridden", key))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid kafka config: %w", err)
+	}
+	return nil
+}
+
+// configMap returns the client properties: security and session settings,
+// then the given ones and the overrides at last.
+func (cfg Config) configMap(props kafka.ConfigMap) *kafka.ConfigMap {
+	cm := kafka.ConfigMap{
+		"bootstrap.servers":     cfg.Brokers,
+		"security.protocol":     strings.ToLower(cfg.SecurityProtocol),
+		"session.timeout.ms":    cfg.SessionTimeoutMilliseconds,
+		"heartbeat.interval.ms": cfg.HeartbeatIntervalMilliseconds,
+		"max.poll.interval.ms":  cfg.MaxPollIntervalMilliseconds,
+	}
+	if cfg.SASLMechanism != "" {
+		cm["sasl.mechanism"] = strings.ToUpper(cfg.SASLMechanism)
+		cm["sasl.username"] = cfg.SASLUsername
+		cm["sasl.password"] = cfg.SASLPassword
+	}
+	if cfg.CAFile != "" {
+		cm["ssl.ca.location"] = cfg.CAFile
+	}
+
+	for k, v := range props {
+		cm[k] = v
+	}
+	for k, v := range cfg.Overrides {
+		cm[k] = v
+	}
+
+	return &cm
+}
+
+// producerConfigMap is like configMap without consumer group settings
+// that the producer warns about.
+func (cfg Config) producerConfigMap(props kafka.ConfigMap) *kafka.ConfigMap {
+	cm := cfg.configMap(props)
+	for _, k := range []string{"session.timeout.ms", "heartbeat.interval.ms", "max.poll.interval.ms"} {
+		delete(*cm, k)
+	}
+
+	return cm
+}
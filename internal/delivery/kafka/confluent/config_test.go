@@ -0,0 +1,115 @@
+package confluent_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/caarlos0/env/v11"
+
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/confluent"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr []string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name: "sasl ssl",
+			env: map[string]string{
+				"SECURITY_PROTOCOL": "SASL_SSL",
+				"SASL_MECHANISM":    "scram-sha-512",
+				"SASL_USERNAME":     "user-service",
+				"SASL_PASSWORD":     "secret",
+				"OVERRIDES":         "client.rack:eu-1a",
+			},
+		},
+		{
+			name: "unknown values",
+			env: map[string]string{
+				"AUTO_OFFSET_RESET": "none",
+				"SECURITY_PROTOCOL": "tls",
+			},
+			wantErr: []string{"auto offset reset", "security protocol"},
+		},
+		{
+			name: "sasl without credentials",
+			env: map[string]string{
+				"SECURITY_PROTOCOL": "sasl_plaintext",
+				"SASL_MECHANISM":    "GSSAPI",
+			},
+			wantErr: []string{"sasl mechanism", "sasl username and password are required"},
+		},
+		{
+			name: "sasl settings without sasl protocol",
+			env: map[string]string{
+				"SASL_USERNAME": "user-service",
+			},
+			wantErr: []string{"sasl settings are set"},
+		},
+		{
+			name: "ca file",
+			env: map[string]string{
+				"CA_FILE": "ca.pem",
+			},
+			wantErr: []string{"ca file is set"},
+		},
+		{
+			name: "missing ca file",
+			env: map[string]string{
+				"SECURITY_PROTOCOL": "ssl",
+				"CA_FILE":           filepath.Join(t.TempDir(), "ca.pem"),
+			},
+			wantErr: []string{"ca file:"},
+		},
+		{
+			name: "timeouts",
+			env: map[string]string{
+				"SESSION_TIMEOUT_MILLISECONDS":    "10000",
+				"HEARTBEAT_INTERVAL_MILLISECONDS": "10000",
+				"MAX_POLL_INTERVAL_MILLISECONDS":  "5000",
+			},
+			wantErr: []string{"heartbeat interval", "max poll interval"},
+		},
+		{
+			name: "managed property override",
+			env: map[string]string{
+				"OVERRIDES": "enable.auto.commit:true",
+			},
+			wantErr: []string{"enable.auto.commit can't be overridden"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			environment := map[string]string{"BROKERS": "localhost:9092"}
+			for k, v := range tt.env {
+				environment[k] = v
+			}
+			cfg, err := env.ParseAsWithOptions[confluent.Config](env.Options{Environment: environment})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = cfg.Validate()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() error = nil, want %v", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package confluent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/rs/zerolog"
+
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/broker"
+)
+
+// flushTimeout is a time to wait for in-flight messages on close
+const flushTimeout = 5 * time.Second
+
+type Sink struct {
+	p *kafka.Producer
+}
+
+var _ broker.Sink = (*Sink)(nil)
+
+// NewSink creates a producer that waits for all in-sync replicas to acknowledge a message.
+func NewSink(ctx context.Context, cfg Config, logger zerolog.Logger) (*Sink, error) {
+	const op = "create kafka sink"
+
+	logger = logger.With().
+		Str("component", "kafka sink").
+		Logger()
+
+	p, err := kafka.NewProducer(cfg.producerConfigMap(kafka.ConfigMap{
+		"acks":               "all",
+		"enable.idempotence": true,
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var timeout int
+	if t, ok := ctx.Deadline(); ok {
+		timeout = int(time.Until(t).Milliseconds())
+	} else {
+		timeout = 500
+	}
+
+	// analog PING here
+	_, err = p.GetMetadata(nil, false, timeout)
+	if err != nil {
+		p.Close()
+		return nil, fmt.Errorf("%s: failed to get metadata: %w", op, err)
+	}
+
+	// delivery reports go to the per message channels, only client errors are left here
+	go func() {
+		for ev := range p.Events() {
+			if err, ok := ev.(kafka.Error); ok {
+				logger.Error().
+					Err(err).
+					Msg("producer error")
+			}
+		}
+	}()
+
+	return &Sink{p: p}, nil
+}
+
+func (s *Sink) Produce(ctx context.Context, msg *broker.Message) error {
+	headers := make([]kafka.Header, len(msg.Headers))
+	for i := range msg.Headers {
+		headers[i] = kafka.Header{
+			Key:   msg.Headers[i].Key,
+			Value: msg.Headers[i].Value,
+		}
+	}
+
+	delivery := make(chan kafka.Event, 1)
+	if err := s.p.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{
+			Topic:     &msg.Topic,
+			Partition: kafka.PartitionAny,
+		},
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	}, delivery); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case ev := <-delivery:
+		m, ok := ev.(*kafka.Message)
+		if !ok {
+			return errors.New("unexpected delivery report")
+		}
+		return m.TopicPartition.Error
+	}
+}
+
+// Close waits for in-flight messages no longer than the flush timeout.
+func (s *Sink) Close() error {
+	defer s.p.Close()
+
+	if n := s.p.Flush(int(flushTimeout.Milliseconds())); n > 0 {
+		return fmt.Errorf("%d messages are not delivered", n)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+// Package confluent is a message source reading from Kafka with the librdkafka based client.
+package confluent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/broker"
+)
+
+// lagTimeout is a timeout of fetching committed offsets for the lag
+const lagTimeout = time.Second
+
+type Source struct {
+	c *kafka.Consumer
+}
+
+var _ broker.Source = (*Source)(nil)
+
+// NewSource creates a member of the consumer group that reads from the configured offset
+// if nothing is committed, stored offsets are committed by the commit interval.
+func NewSource(ctx context.Context, cfg Config, groupID string) (*Source, error) {
+	const op = "create kafka source"
+
+	s, err := newSource(ctx, cfg.configMap(kafka.ConfigMap{
+		"group.id":                 groupID,
+		"auto.offset.reset":        cfg.AutoOffsetReset,
+		"auto.commit.interval.ms":  cfg.CommitIntervalMilliseconds,
+		"enable.auto.offset.store": false,
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return s, nil
+}
+
+// NewBroadcastSource creates a member of the consumer group that reads from the latest offset
+// and never commits, so the group must be unique to read all messages.
+func NewBroadcastSource(ctx context.Context, cfg Config, groupID string) (*Source, error) {
+	const op = "create kafka broadcast source"
+
+	s, err := newSource(ctx, cfg.configMap(kafka.ConfigMap{
+		"group.id":           groupID,
+		"auto.offset.reset":  "latest",
+		"enable.auto.commit": false,
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return s, nil
+}
+
+func newSource(ctx context.Context, cm *kafka.ConfigMap) (*Source, error) {
+	c, err := kafka.NewConsumer(cm)
+	if err != nil {
+		return nil, err
+	}
+
+	var timeout int
+	if t, ok := ctx.Deadline(); ok {
+		timeout = int(time.Until(t).Milliseconds())
+	} else {
+		timeout = 500
+	}
+
+	// analog PING here
+	_, err = c.GetMetadata(nil, false, timeout)
+	if err != nil {
+		return nil, errors.Join(
+			fmt.Errorf("failed to get metadata: %w", err),
+			c.Close())
+	}
+
+	return &Source{c: c}, nil
+}
+
+func (s *Source) Subscribe(topic string, rebalance broker.RebalanceFunc) error {
+	if rebalance == nil {
+		return s.c.Subscribe(topic, nil)
+	}
+
+	return s.c.Subscribe(topic, func(c *kafka.Consumer, ev kafka.Event) error {
+		switch e := ev.(type) {
+		case kafka.AssignedPartitions:
+			return rebalance(broker.RebalanceEvent{
+				Type:       broker.PartitionsAssigned,
+				Partitions: fromTopicPartitions(e.Partitions),
+			})
+		case kafka.RevokedPartitions:
+			typ := broker.PartitionsRevoked
+			if c.AssignmentLost() {
+				typ = broker.PartitionsLost
+			}
+			return rebalance(broker.RebalanceEvent{
+				Type:       typ,
+				Partitions: fromTopicPartitions(e.Partitions),
+			})
+		}
+		return nil
+	})
+}
+
+func (s *Source) Poll(timeout time.Duration) (*broker.Message, error) {
+	msg, err := s.c.ReadMessage(timeout)
+	if err != nil {
+		var kafkaErr kafka.Error
+		if errors.As(err, &kafkaErr) {
+			if kafkaErr.IsTimeout() {
+				return nil, nil
+			}
+			if kafkaErr.IsFatal() {
+				return nil, fmt.Errorf("%w: %w", broker.ErrFatal, err)
+			}
+		}
+		return nil, err
+	}
+
+	headers := make([]broker.Header, len(msg.Headers))
+	for i := range msg.Headers {
+		headers[i] = broker.Header{
+			Key:   msg.Headers[i].Key,
+			Value: msg.Headers[i].Value,
+		}
+	}
+
+	return &broker.Message{
+		Topic:     *msg.TopicPartition.Topic,
+		Partition: msg.TopicPartition.Partition,
+		Offset:    int64(msg.TopicPartition.Offset),
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Headers:   headers,
+		Timestamp: msg.Timestamp,
+	}, nil
+}
+
+func (s *Source) StoreOffsets(tps []broker.TopicPartition) error {
+	_, err := s.c.StoreOffsets(toTopicPartitions(tps))
+	return err
+}
+
+func (s *Source) Commit() error {
+	if _, err := s.c.Commit(); err != nil {
+		var kafkaErr kafka.Error
+		if errors.As(err, &kafkaErr) && kafkaErr.Code() == kafka.ErrNoOffset {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Source) Lag() ([]broker.PartitionLag, error) {
+	assigned, err := s.c.Assignment()
+	if err != nil || len(assigned) == 0 {
+		return nil, err
+	}
+
+	committed, err := s.c.Committed(assigned, int(lagTimeout.Milliseconds()))
+	if err != nil {
+		return nil, err
+	}
+
+	lags := make([]broker.PartitionLag, 0, len(committed))
+	for _, tp := range committed {
+		low, high, err := s.c.GetWatermarkOffsets(*tp.Topic, tp.Partition)
+		if err != nil {
+			continue
+		}
+
+		// nothing is committed yet: all retained messages are behind
+		offset := int64(tp.Offset)
+		if tp.Offset < 0 {
+			offset = low
+		}
+
+		lags = append(lags, broker.PartitionLag{
+			Topic:     *tp.Topic,
+			Partition: tp.Partition,
+			Lag:       max(high-offset, 0),
+		})
+	}
+
+	return lags, nil
+}
+
+func (s *Source) Close() error {
+	return s.c.Close()
+}
+
+func fromTopicPartitions(tps []kafka.TopicPartition) []broker.TopicPartition {
+	res := make([]broker.TopicPartition, len(tps))
+	for i := range tps {
+		res[i] = broker.TopicPartition{
+			Topic:     *tps[i].Topic,
+			Partition: tps[i].Partition,
+			Offset:    int64(tps[i].Offset),
+		}
+	}
+	return res
+}
+
+func toTopicPartitions(tps []broker.TopicPartition) []kafka.TopicPartition {
+	res := make([]kafka.TopicPartition, len(tps))
+	for i := range tps {
+		res[i] = kafka.TopicPartition{
+			Topic:     &tps[i].Topic,
+			Partition: tps[i].Partition,
+			Offset:    kafka.Offset(tps[i].Offset),
+		}
+	}
+	return res
+}
@@ -4,171 +4,239 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"sync"
 	"time"
 
-	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/rs/xid"
 	"github.com/rs/zerolog"
-	"google.golang.org/protobuf/proto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	ck "github.com/Karzoug/meower-common-go/kafka"
 
-	gen "github.com/Karzoug/meower-user-service/internal/delivery/kafka/gen/auth/v1"
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/broker"
 	"github.com/Karzoug/meower-user-service/internal/user/service"
 )
 
-const (
-	authTopic = "auth"
-)
-
 type consumer struct {
-	c           *kafka.Consumer
+	source      broker.Source
+	dlq         broker.Sink
+	registry    registry
+	cfg         Config
 	userService service.UserService
+	tracer      trace.Tracer
+	metrics     metrics
 	logger      zerolog.Logger
 }
 
-func NewConsumer(ctx context.Context, cfg Config, service service.UserService, logger zerolog.Logger) (consumer, error) {
+// NewConsumer creates a consumer of the auth change events read from the source,
+// the source is closed when the consumer stops. Messages that can't be handled are sent
+// to the dead letter topic by dlq, they are only counted and logged if dlq is nil.
+func NewConsumer(cfg Config, source broker.Source, dlq broker.Sink, service service.UserService, logger zerolog.Logger) (consumer, error) {
 	const op = "create kafka consumer"
 
 	logger = logger.With().
 		Str("component", "kafka consumer").
 		Logger()
 
-	c, err := kafka.NewConsumer(&kafka.ConfigMap{
-		"bootstrap.servers":        cfg.Brokers,
-		"group.id":                 cfg.GroupID,
-		"auto.offset.reset":        "earliest",
-		"auto.commit.interval.ms":  cfg.CommitIntervalMilliseconds,
-		"enable.auto.offset.store": false,
-	})
-	if err != nil {
+	if err := cfg.Validate(); err != nil {
 		return consumer{}, fmt.Errorf("%s: %w", op, err)
 	}
-
-	var (
-		topic   = authTopic
-		timeout int
-	)
-	if t, ok := ctx.Deadline(); ok {
-		timeout = int(time.Until(t).Milliseconds())
-	} else {
-		timeout = 500
+	if dlq != nil && cfg.DLQTopic == "" {
+		return consumer{}, fmt.Errorf("%s: dead letter topic is not set", op)
 	}
 
-	// analog PING here
-	_, err = c.GetMetadata(&topic, false, timeout)
-	if err != nil {
-		return consumer{}, fmt.Errorf("%s: failed to get metadata: %w", op, err)
-	}
-
-	return consumer{
-		c:           c,
+	c := consumer{
+		source:      source,
+		dlq:         dlq,
+		cfg:         cfg,
 		userService: service,
+		tracer:      otel.GetTracerProvider().Tracer(instrumentationName),
+		metrics:     newMetrics(),
 		logger:      logger,
-	}, nil
+	}
+	c.registry = c.registerHandlers()
+
+	return c, nil
 }
 
 func (c consumer) Run(ctx context.Context) (err error) {
-	authChangedEventFngpnt := ck.MessageTypeHeaderValue(&gen.ChangedEvent{})
-
 	defer func() {
-		if defErr := c.c.Close(); defErr != nil {
+		if defErr := c.source.Close(); defErr != nil {
 			err = errors.Join(err,
 				fmt.Errorf("failed to close consumer: %w", defErr))
 		}
 	}()
 
-	if err := c.c.Subscribe(authTopic, nil); err != nil {
+	offsets := newOffsetTracker(c.storeOffset)
+
+	// workers are not canceled on shutdown: they finish in-flight messages first,
+	// a failed worker cancels all of them with the error as the cause
+	workersCtx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	var (
+		wg     sync.WaitGroup
+		queues = make([]chan tracked, c.cfg.Workers)
+	)
+	// messages with the same key go to the same worker, so they are processed in order
+	for i := range queues {
+		queues[i] = make(chan tracked, c.cfg.WorkerQueueSize)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.work(workersCtx, cancel, queues[i], offsets)
+		}()
+	}
+	defer func() {
+		cancel(nil)
+		wg.Wait()
+	}()
+
+	if err := c.source.Subscribe(c.cfg.AuthTopic, func(ev broker.RebalanceEvent) error {
+		return c.rebalance(workersCtx, offsets, ev)
+	}); err != nil {
+		return err
+	}
+
+	unregisterLag, err := c.metrics.registerLag(c.source)
+	if err != nil {
 		return err
 	}
+	defer unregisterLag()
 
-	run := true
-	for run {
+	for {
 		select {
 		case <-ctx.Done():
-			run = false
+			// the same as revoking of all partitions
+			c.drainAndCommit(workersCtx, offsets, false)
+			return nil
+		case <-workersCtx.Done():
+			// log outside, not store offset, return from consumer with error
+			return context.Cause(workersCtx)
 		default:
-			msg, err := c.c.ReadMessage(100 * time.Millisecond)
-			if err != nil {
-				var kafkaErr kafka.Error
-				if errors.As(err, &kafkaErr) {
-					if kafkaErr.IsFatal() {
-						return fmt.Errorf("fatal error while read message: %w", err)
-					}
-					if !kafkaErr.IsTimeout() {
-						c.logger.Error().
-							Err(err).
-							Msg("failed to read message")
-					}
-				}
-				continue
-			}
+		}
 
-			if len(msg.Headers) == 0 {
-				c.storeOffset(msg)
-				continue
+		msg, err := c.source.Poll(100 * time.Millisecond)
+		if err != nil {
+			if errors.Is(err, broker.ErrFatal) {
+				return fmt.Errorf("fatal error while read message: %w", err)
 			}
-			eventType, ok := lookupHeaderValue(msg.Headers, ck.MessageTypeHeaderKey)
+			c.logger.Error().
+				Err(err).
+				Msg("failed to read message")
+			continue
+		}
+		if msg == nil {
+			continue
+		}
+
+		m := offsets.add(msg)
+
+		eventType, ok := msg.Header(ck.MessageTypeHeaderKey)
+		if _, known := c.registry.schema(string(eventType)); !known {
+			reason := skipReasonUnknownType
 			if !ok {
-				c.storeOffset(msg)
-				continue
+				reason = skipReasonMissingType
 			}
-
-			eventTypeFngpnt := string(eventType)
-
-			handlerLogger := c.logger.With().
-				Str("topic", *msg.TopicPartition.Topic).
-				Str("request_id", xid.New().String()).
-				Str("key", string(msg.Key)).
-				Str("event_fingerprint", eventTypeFngpnt).
-				Logger()
-
-			if eventTypeFngpnt == authChangedEventFngpnt {
-				handlerLogger.Info().
-					Ctx(ctx).
-					Msg("received message")
-
-				event := &gen.ChangedEvent{}
-				if err := proto.Unmarshal(msg.Value, event); err != nil {
-					return fmt.Errorf("failed to deserialize payload: %w", err)
-				}
-
-				switch event.ChangeType {
-				case gen.ChangeType_CHANGE_TYPE_REGISTERED:
-					err = c.userRegisteredHandler(ctx, event, handlerLogger)
-				case gen.ChangeType_CHANGE_TYPE_DELETED:
-					err = c.userDeletedHandler(ctx, event, handlerLogger)
-				}
+			if err := c.skip(workersCtx, msg, reason, nil); err != nil {
+				return err
 			}
 
-			if err != nil {
-				// log outside, not store offset, return from consumer with error
-				return err
+			offsets.complete(m)
+			continue
+		}
+
+		select {
+		case queues[workerIndex(msg.Key, len(queues))] <- m:
+		case <-workersCtx.Done():
+		}
+	}
+}
+
+// work processes messages of the queue until the context is done or processing fails.
+func (c consumer) work(ctx context.Context, fail context.CancelCauseFunc, queue <-chan tracked, offsets *offsetTracker) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m := <-queue:
+			eventType, _ := m.msg.Header(ck.MessageTypeHeaderKey)
+			if err := c.processAuthChangedEvent(ctx, m.msg, string(eventType)); err != nil {
+				fail(err)
+				return
 			}
 
-			c.storeOffset(msg)
+			offsets.complete(m)
 		}
 	}
+}
 
-	return nil
+func workerIndex(key []byte, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return int(h.Sum32() % uint32(n)) //nolint:gosec
 }
 
-func (c consumer) storeOffset(msg *kafka.Message) {
-	_, err := c.c.StoreMessage(msg)
+// processAuthChangedEvent handles the message in the trace context of the message producer.
+func (c consumer) processAuthChangedEvent(ctx context.Context, msg *broker.Message, eventTypeFngpnt string) (err error) {
+	ctx, span := startProcessSpan(ctx, c.tracer, c.cfg.GroupID, msg)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	handlerLogger := c.logger.With().
+		Str("topic", msg.Topic).
+		Str("request_id", xid.New().String()).
+		Str("trace_id", span.SpanContext().TraceID().String()).
+		Str("key", string(msg.Key)).
+		Str("event_fingerprint", eventTypeFngpnt).
+		Logger()
+
+	handlerLogger.Info().
+		Ctx(ctx).
+		Msg("received message")
+
+	// the message type is checked before the message is dispatched to the worker
+	sch, _ := c.registry.schema(eventTypeFngpnt)
+	event, err := sch.decode(msg.Value)
 	if err != nil {
-		c.logger.Error().
-			Err(err).
-			Str("topic", *msg.TopicPartition.Topic).
-			Str("key", string(msg.Key)).
-			Msg("failed to store offset after message")
+		err = fmt.Errorf("failed to deserialize payload: %w", err)
+		if c.dlq == nil {
+			return err
+		}
+		return c.skip(ctx, msg, skipReasonInvalidPayload, err)
 	}
+	event.SchemaVersion = sch.version
+
+	handler, ok := c.registry.handler(eventTypeFngpnt, event.ChangeType)
+	if !ok {
+		return c.skip(ctx, msg, skipReasonUnknownChangeType,
+			fmt.Errorf("no handler of change type %s of schema %s", event.ChangeType, event.SchemaVersion))
+	}
+
+	start := time.Now()
+	err = handler(ctx, event, handlerLogger)
+	c.metrics.messageProcessed(ctx, event, time.Since(start), err)
+	if errors.Is(err, errUnprocessable) {
+		return c.skip(ctx, msg, skipReasonUnprocessable, err)
+	}
+
+	return err
 }
 
-func lookupHeaderValue(headers []kafka.Header, key string) ([]byte, bool) {
-	for _, header := range headers {
-		if header.Key == key {
-			return header.Value, true
-		}
+func (c consumer) storeOffset(tp broker.TopicPartition) {
+	if err := c.source.StoreOffsets([]broker.TopicPartition{tp}); err != nil {
+		c.logger.Error().
+			Err(err).
+			Str("topic", tp.Topic).
+			Int32("partition", tp.Partition).
+			Int64("offset", tp.Offset).
+			Msg("failed to store offset")
 	}
-	return nil, false
 }
@@ -0,0 +1,313 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/proto"
+
+	ck "github.com/Karzoug/meower-common-go/kafka"
+
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka"
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/broker"
+	gen "github.com/Karzoug/meower-user-service/internal/delivery/kafka/gen/auth/v1"
+	genV2 "github.com/Karzoug/meower-user-service/internal/delivery/kafka/gen/auth/v2"
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/memory"
+	"github.com/Karzoug/meower-user-service/internal/user/repo"
+	"github.com/Karzoug/meower-user-service/internal/user/service/servicetest"
+)
+
+const (
+	authTopic = "auth"
+	dlqTopic  = "auth.dlq"
+	groupID   = "user-service"
+)
+
+// authEvent is an auth event of any schema version, the username is the message key.
+type authEvent interface {
+	proto.Message
+	GetUsername() string
+}
+
+func TestConsumer(t *testing.T) {
+	tests := []struct {
+		name        string
+		events      []authEvent
+		skipped     int
+		wantExist   []string
+		wantMissing []string
+	}{
+		{
+			name: "registered",
+			events: []authEvent{
+				v1Event(gen.ChangeType_CHANGE_TYPE_REGISTERED, "alice"),
+				v1Event(gen.ChangeType_CHANGE_TYPE_REGISTERED, "bob"),
+			},
+			wantExist: []string{"alice", "bob"},
+		},
+		{
+			name: "registered twice",
+			events: []authEvent{
+				v1Event(gen.ChangeType_CHANGE_TYPE_REGISTERED, "alice"),
+				v1Event(gen.ChangeType_CHANGE_TYPE_REGISTERED, "alice"),
+			},
+			wantExist: []string{"alice"},
+		},
+		{
+			name: "deleted after registered",
+			events: []authEvent{
+				v1Event(gen.ChangeType_CHANGE_TYPE_REGISTERED, "alice"),
+				v1Event(gen.ChangeType_CHANGE_TYPE_REGISTERED, "bob"),
+				v1Event(gen.ChangeType_CHANGE_TYPE_DELETED, "alice"),
+			},
+			wantExist:   []string{"bob"},
+			wantMissing: []string{"alice"},
+		},
+		{
+			name: "schema versions in parallel",
+			events: []authEvent{
+				v1Event(gen.ChangeType_CHANGE_TYPE_REGISTERED, "alice"),
+				v2Event(genV2.ChangeType_CHANGE_TYPE_REGISTERED, "bob"),
+				v2Event(genV2.ChangeType_CHANGE_TYPE_DELETED, "alice"),
+			},
+			wantExist:   []string{"bob"},
+			wantMissing: []string{"alice"},
+		},
+		{
+			name: "username changed",
+			events: []authEvent{
+				v2Event(genV2.ChangeType_CHANGE_TYPE_REGISTERED, "alice"),
+				usernameChangedEvent("alice", "alice2"),
+				// redelivered
+				usernameChangedEvent("alice", "alice2"),
+			},
+			wantExist:   []string{"alice2"},
+			wantMissing: []string{"alice"},
+		},
+		{
+			name: "account locked and email verified",
+			events: []authEvent{
+				v2Event(genV2.ChangeType_CHANGE_TYPE_REGISTERED, "alice"),
+				v2Event(genV2.ChangeType_CHANGE_TYPE_EMAIL_VERIFIED, "alice"),
+				v2Event(genV2.ChangeType_CHANGE_TYPE_ACCOUNT_LOCKED, "alice"),
+			},
+			wantExist: []string{"alice"},
+		},
+		{
+			// no dead letter topic is configured: the consumer goes on
+			name: "unprocessable username change is skipped",
+			events: []authEvent{
+				v2Event(genV2.ChangeType_CHANGE_TYPE_REGISTERED, "alice"),
+				// the user is unknown
+				usernameChangedEvent("bob", "bob2"),
+				usernameChangedEvent("alice", "alice2"),
+			},
+			wantExist:   []string{"alice2"},
+			wantMissing: []string{"alice", "bob", "bob2"},
+		},
+		{
+			name: "unknown messages are skipped",
+			events: []authEvent{
+				v1Event(gen.ChangeType_CHANGE_TYPE_REGISTERED, "alice"),
+				v1Event(gen.ChangeType_CHANGE_TYPE_UNSPECIFIED, "bob"),
+			},
+			skipped:     2,
+			wantExist:   []string{"alice"},
+			wantMissing: []string{"bob"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := servicetest.New(t)
+			mb := memory.New(1)
+
+			for i := 0; i < tt.skipped; i++ {
+				mb.Produce(authTopic, []byte("skipped"), []byte("payload"),
+					broker.Header{Key: ck.MessageTypeHeaderKey, Value: []byte("unknown")})
+			}
+			for _, ev := range tt.events {
+				produceAuthEvent(t, mb, ev)
+			}
+
+			stop := runConsumer(t, mb, h, "")
+			waitCommitted(t, mb, int64(len(tt.events)+tt.skipped))
+			stop()
+
+			for _, username := range tt.wantExist {
+				if _, err := h.Repo.GetOneShortProjectionByUsername(context.Background(), username); err != nil {
+					t.Errorf("user %s: error = %v, want nil", username, err)
+				}
+			}
+			for _, username := range tt.wantMissing {
+				if _, err := h.Repo.GetOneShortProjectionByUsername(context.Background(), username); !errors.Is(err, repo.ErrRecordNotFound) {
+					t.Errorf("user %s: error = %v, want %v", username, err, repo.ErrRecordNotFound)
+				}
+			}
+		})
+	}
+}
+
+func TestConsumerDeadLetters(t *testing.T) {
+	h := servicetest.New(t)
+	mb := memory.New(1)
+
+	mb.Produce(authTopic, []byte("missing"), []byte("payload"))
+	mb.Produce(authTopic, []byte("unknown"), []byte("payload"),
+		broker.Header{Key: ck.MessageTypeHeaderKey, Value: []byte("unknown")})
+	mb.Produce(authTopic, []byte("invalid"), []byte{0xff, 0xff, 0xff},
+		broker.Header{Key: ck.MessageTypeHeaderKey, Value: []byte(ck.MessageTypeHeaderValue(&gen.ChangedEvent{}))})
+	produceAuthEvent(t, mb, v2Event(genV2.ChangeType_CHANGE_TYPE_UNSPECIFIED, "alice"))
+	produceAuthEvent(t, mb, v2Event(genV2.ChangeType_CHANGE_TYPE_REGISTERED, "alice"))
+	// the user is unknown
+	produceAuthEvent(t, mb, usernameChangedEvent("bob", "bob2"))
+
+	stop := runConsumer(t, mb, h, dlqTopic)
+	waitCommitted(t, mb, 6)
+	stop()
+
+	source := mb.NewSource("dlq-reader")
+	if err := source.Subscribe(dlqTopic, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var reasons []string
+	for {
+		msg, err := source.Poll(10 * time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg == nil {
+			break
+		}
+
+		reason, _ := msg.Header("dlq-reason")
+		reasons = append(reasons, string(reason))
+		if _, ok := msg.Header("dlq-original-offset"); !ok {
+			t.Errorf("dead letter %s has no original offset", reason)
+		}
+	}
+
+	slices.Sort(reasons)
+	want := []string{"invalid_payload", "missing_fngpnt", "unknown_change_type", "unknown_fngpnt", "unprocessable"}
+	if !slices.Equal(reasons, want) {
+		t.Errorf("dead letter reasons = %v, want %v", reasons, want)
+	}
+}
+
+func TestConsumerResumesFromCommitted(t *testing.T) {
+	h := servicetest.New(t)
+	mb := memory.New(1)
+
+	produceAuthEvent(t, mb, v1Event(gen.ChangeType_CHANGE_TYPE_REGISTERED, "alice"))
+	stop := runConsumer(t, mb, h, "")
+	waitCommitted(t, mb, 1)
+	stop()
+
+	produceAuthEvent(t, mb, v1Event(gen.ChangeType_CHANGE_TYPE_REGISTERED, "bob"))
+	stop = runConsumer(t, mb, h, "")
+	waitCommitted(t, mb, 2)
+	stop()
+
+	// alice is created once: the first message is not read again
+	if got := len(h.Repo.Outbox()); got != 2 {
+		t.Errorf("outbox records = %d, want %d", got, 2)
+	}
+}
+
+func v1Event(changeType gen.ChangeType, username string) authEvent {
+	return &gen.ChangedEvent{
+		ChangeType: changeType,
+		Username:   username,
+	}
+}
+
+func v2Event(changeType genV2.ChangeType, username string) authEvent {
+	return &genV2.ChangedEvent{
+		ChangeType: changeType,
+		Username:   username,
+	}
+}
+
+func usernameChangedEvent(username, newUsername string) authEvent {
+	return &genV2.ChangedEvent{
+		ChangeType: genV2.ChangeType_CHANGE_TYPE_USERNAME_CHANGED,
+		Username:   username,
+		Details: &genV2.ChangedEvent_UsernameChanged{
+			UsernameChanged: &genV2.UsernameChanged{NewUsername: newUsername},
+		},
+	}
+}
+
+func produceAuthEvent(t *testing.T, mb *memory.Broker, ev authEvent) {
+	t.Helper()
+
+	payload, err := proto.Marshal(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mb.Produce(authTopic, []byte(ev.GetUsername()), payload,
+		broker.Header{
+			Key:   ck.MessageTypeHeaderKey,
+			Value: []byte(ck.MessageTypeHeaderValue(ev)),
+		})
+}
+
+// runConsumer runs the consumer of the broker until the returned func is called,
+// skipped messages are sent to the dead letter topic if it is not empty.
+func runConsumer(t *testing.T, mb *memory.Broker, h *servicetest.Harness, dlqTopic string) func() {
+	t.Helper()
+
+	cfg, err := env.ParseAsWithOptions[kafka.Config](env.Options{Environment: map[string]string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dlq broker.Sink
+	if dlqTopic != "" {
+		cfg.DLQTopic = dlqTopic
+		dlq = mb.NewSink()
+	}
+
+	c, err := kafka.NewConsumer(cfg, mb.NewSource(groupID), dlq, h.Service, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(ctx)
+	}()
+
+	return func() {
+		t.Helper()
+
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	}
+}
+
+// waitCommitted waits until the offset of the single auth partition is committed.
+func waitCommitted(t *testing.T, mb *memory.Broker, want int64) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, _ := mb.Committed(groupID, authTopic, 0)
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("committed offset = %d, want %d", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,92 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/broker"
+)
+
+// headers added to messages sent to the dead letter topic
+const (
+	dlqReasonHeaderKey    = "dlq-reason"
+	dlqErrorHeaderKey     = "dlq-error"
+	dlqTopicHeaderKey     = "dlq-original-topic"
+	dlqPartitionHeaderKey = "dlq-original-partition"
+	dlqOffsetHeaderKey    = "dlq-original-offset"
+)
+
+// skip counts the message that can't be handled and sends it to the dead letter topic
+// if it is configured. An error is returned only if the message is not sent in time,
+// then the consumer stops without storing the offset of the message.
+func (c consumer) skip(ctx context.Context, msg *broker.Message, reason string, cause error) error {
+	c.metrics.messageSkipped(msg.Topic, reason)
+
+	logger := c.logger.With().
+		Str("topic", msg.Topic).
+		Int32("partition", msg.Partition).
+		Int64("offset", msg.Offset).
+		Str("key", string(msg.Key)).
+		Str("reason", reason).
+		Err(cause).
+		Logger()
+
+	if c.dlq == nil {
+		logger.Warn().
+			Ctx(ctx).
+			Msg("skipped message")
+		return nil
+	}
+
+	headers := append(slices.Clone(msg.Headers),
+		broker.Header{Key: dlqReasonHeaderKey, Value: []byte(reason)},
+		broker.Header{Key: dlqTopicHeaderKey, Value: []byte(msg.Topic)},
+		broker.Header{Key: dlqPartitionHeaderKey, Value: []byte(strconv.Itoa(int(msg.Partition)))},
+		broker.Header{Key: dlqOffsetHeaderKey, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+	)
+	if cause != nil {
+		headers = append(headers, broker.Header{Key: dlqErrorHeaderKey, Value: []byte(cause.Error())})
+	}
+	dead := &broker.Message{
+		Topic:   c.cfg.DLQTopic,
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	}
+
+	if err := backoff.RetryNotify(
+		func() error {
+			ctx, cancel := context.WithTimeout(ctx, defaultOperationTimeout)
+			defer cancel()
+
+			return c.dlq.Produce(ctx, dead)
+		},
+		backoff.WithContext(
+			backoff.NewExponentialBackOff(
+				backoff.WithMaxElapsedTime(maxRetryTimeoutBeforeExit),
+			),
+			ctx,
+		),
+		func(err error, _ time.Duration) {
+			logger.Error().
+				Ctx(ctx).
+				AnErr("dlq_error", err).
+				Msg("failed to send message to dead letter topic")
+		},
+	); err != nil {
+		return fmt.Errorf("all retries for sending message to dead letter topic failed: %w", err)
+	}
+	c.metrics.messageDeadLettered(msg.Topic, reason)
+
+	logger.Warn().
+		Ctx(ctx).
+		Str("dlq_topic", c.cfg.DLQTopic).
+		Msg("sent message to dead letter topic")
+
+	return nil
+}
@@ -0,0 +1,426 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.35.1
+// 	protoc        (unknown)
+// source: auth/v2/kafka.proto
+
+package v2
+
+import (
+	reflect "reflect"
+	sync "sync"
+
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ChangeType int32
+
+const (
+	ChangeType_CHANGE_TYPE_UNSPECIFIED      ChangeType = 0
+	ChangeType_CHANGE_TYPE_REGISTERED       ChangeType = 1
+	ChangeType_CHANGE_TYPE_DELETED          ChangeType = 2
+	ChangeType_CHANGE_TYPE_USERNAME_CHANGED ChangeType = 3
+	ChangeType_CHANGE_TYPE_ACCOUNT_LOCKED   ChangeType = 4
+	ChangeType_CHANGE_TYPE_EMAIL_VERIFIED   ChangeType = 5
+)
+
+// Enum value maps for ChangeType.
+var (
+	ChangeType_name = map[int32]string{
+		0: "CHANGE_TYPE_UNSPECIFIED",
+		1: "CHANGE_TYPE_REGISTERED",
+		2: "CHANGE_TYPE_DELETED",
+		3: "CHANGE_TYPE_USERNAME_CHANGED",
+		4: "CHANGE_TYPE_ACCOUNT_LOCKED",
+		5: "CHANGE_TYPE_EMAIL_VERIFIED",
+	}
+	ChangeType_value = map[string]int32{
+		"CHANGE_TYPE_UNSPECIFIED":      0,
+		"CHANGE_TYPE_REGISTERED":       1,
+		"CHANGE_TYPE_DELETED":          2,
+		"CHANGE_TYPE_USERNAME_CHANGED": 3,
+		"CHANGE_TYPE_ACCOUNT_LOCKED":   4,
+		"CHANGE_TYPE_EMAIL_VERIFIED":   5,
+	}
+)
+
+func (x ChangeType) Enum() *ChangeType {
+	p := new(ChangeType)
+	*p = x
+	return p
+}
+
+func (x ChangeType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ChangeType) Descriptor() protoreflect.EnumDescriptor {
+	return file_auth_v2_kafka_proto_enumTypes[0].Descriptor()
+}
+
+func (ChangeType) Type() protoreflect.EnumType {
+	return &file_auth_v2_kafka_proto_enumTypes[0]
+}
+
+func (x ChangeType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ChangeType.Descriptor instead.
+func (ChangeType) EnumDescriptor() ([]byte, []int) {
+	return file_auth_v2_kafka_proto_rawDescGZIP(), []int{0}
+}
+
+type ChangedEvent struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Username   string     `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	ChangeType ChangeType `protobuf:"varint,2,opt,name=change_type,json=changeType,proto3,enum=auth.v2.ChangeType" json:"change_type,omitempty"`
+	// Types that are assignable to Details:
+	//
+	//	*ChangedEvent_UsernameChanged
+	//	*ChangedEvent_AccountLocked
+	//	*ChangedEvent_EmailVerified
+	Details isChangedEvent_Details `protobuf_oneof:"details"`
+}
+
+func (x *ChangedEvent) Reset() {
+	*x = ChangedEvent{}
+	mi := &file_auth_v2_kafka_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChangedEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChangedEvent) ProtoMessage() {}
+
+func (x *ChangedEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_v2_kafka_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChangedEvent.ProtoReflect.Descriptor instead.
+func (*ChangedEvent) Descriptor() ([]byte, []int) {
+	return file_auth_v2_kafka_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ChangedEvent) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *ChangedEvent) GetChangeType() ChangeType {
+	if x != nil {
+		return x.ChangeType
+	}
+	return ChangeType_CHANGE_TYPE_UNSPECIFIED
+}
+
+func (m *ChangedEvent) GetDetails() isChangedEvent_Details {
+	if m != nil {
+		return m.Details
+	}
+	return nil
+}
+
+func (x *ChangedEvent) GetUsernameChanged() *UsernameChanged {
+	if x, ok := x.GetDetails().(*ChangedEvent_UsernameChanged); ok {
+		return x.UsernameChanged
+	}
+	return nil
+}
+
+func (x *ChangedEvent) GetAccountLocked() *AccountLocked {
+	if x, ok := x.GetDetails().(*ChangedEvent_AccountLocked); ok {
+		return x.AccountLocked
+	}
+	return nil
+}
+
+func (x *ChangedEvent) GetEmailVerified() *EmailVerified {
+	if x, ok := x.GetDetails().(*ChangedEvent_EmailVerified); ok {
+		return x.EmailVerified
+	}
+	return nil
+}
+
+type isChangedEvent_Details interface {
+	isChangedEvent_Details()
+}
+
+type ChangedEvent_UsernameChanged struct {
+	UsernameChanged *UsernameChanged `protobuf:"bytes,3,opt,name=username_changed,json=usernameChanged,proto3,oneof"`
+}
+
+type ChangedEvent_AccountLocked struct {
+	AccountLocked *AccountLocked `protobuf:"bytes,4,opt,name=account_locked,json=accountLocked,proto3,oneof"`
+}
+
+type ChangedEvent_EmailVerified struct {
+	EmailVerified *EmailVerified `protobuf:"bytes,5,opt,name=email_verified,json=emailVerified,proto3,oneof"`
+}
+
+func (*ChangedEvent_UsernameChanged) isChangedEvent_Details() {}
+
+func (*ChangedEvent_AccountLocked) isChangedEvent_Details() {}
+
+func (*ChangedEvent_EmailVerified) isChangedEvent_Details() {}
+
+type UsernameChanged struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	NewUsername string `protobuf:"bytes,1,opt,name=new_username,json=newUsername,proto3" json:"new_username,omitempty"`
+}
+
+func (x *UsernameChanged) Reset() {
+	*x = UsernameChanged{}
+	mi := &file_auth_v2_kafka_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UsernameChanged) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UsernameChanged) ProtoMessage() {}
+
+func (x *UsernameChanged) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_v2_kafka_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UsernameChanged.ProtoReflect.Descriptor instead.
+func (*UsernameChanged) Descriptor() ([]byte, []int) {
+	return file_auth_v2_kafka_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *UsernameChanged) GetNewUsername() string {
+	if x != nil {
+		return x.NewUsername
+	}
+	return ""
+}
+
+type AccountLocked struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Reason string `protobuf:"bytes,1,opt,name=reason,proto3" json:"reason,omitempty"`
+}
+
+func (x *AccountLocked) Reset() {
+	*x = AccountLocked{}
+	mi := &file_auth_v2_kafka_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AccountLocked) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AccountLocked) ProtoMessage() {}
+
+func (x *AccountLocked) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_v2_kafka_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AccountLocked.ProtoReflect.Descriptor instead.
+func (*AccountLocked) Descriptor() ([]byte, []int) {
+	return file_auth_v2_kafka_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *AccountLocked) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type EmailVerified struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *EmailVerified) Reset() {
+	*x = EmailVerified{}
+	mi := &file_auth_v2_kafka_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EmailVerified) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EmailVerified) ProtoMessage() {}
+
+func (x *EmailVerified) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_v2_kafka_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EmailVerified.ProtoReflect.Descriptor instead.
+func (*EmailVerified) Descriptor() ([]byte, []int) {
+	return file_auth_v2_kafka_proto_rawDescGZIP(), []int{3}
+}
+
+var File_auth_v2_kafka_proto protoreflect.FileDescriptor
+
+var file_auth_v2_kafka_proto_rawDesc = []byte{
+	0x0a, 0x13, 0x61, 0x75, 0x74, 0x68, 0x2f, 0x76, 0x32, 0x2f, 0x6b, 0x61, 0x66, 0x6b, 0x61, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x07, 0x61, 0x75, 0x74, 0x68, 0x2e, 0x76, 0x32, 0x22, 0xb4,
+	0x02, 0x0a, 0x0c, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x64, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x12,
+	0x1a, 0x0a, 0x08, 0x75, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x08, 0x75, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x34, 0x0a, 0x0b, 0x63,
+	0x68, 0x61, 0x6e, 0x67, 0x65, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e,
+	0x32, 0x13, 0x2e, 0x61, 0x75, 0x74, 0x68, 0x2e, 0x76, 0x32, 0x2e, 0x43, 0x68, 0x61, 0x6e, 0x67,
+	0x65, 0x54, 0x79, 0x70, 0x65, 0x52, 0x0a, 0x63, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x54, 0x79, 0x70,
+	0x65, 0x12, 0x45, 0x0a, 0x10, 0x75, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x5f, 0x63, 0x68,
+	0x61, 0x6e, 0x67, 0x65, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x61, 0x75,
+	0x74, 0x68, 0x2e, 0x76, 0x32, 0x2e, 0x55, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x43, 0x68,
+	0x61, 0x6e, 0x67, 0x65, 0x64, 0x48, 0x00, 0x52, 0x0f, 0x75, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d,
+	0x65, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x64, 0x12, 0x3f, 0x0a, 0x0e, 0x61, 0x63, 0x63, 0x6f,
+	0x75, 0x6e, 0x74, 0x5f, 0x6c, 0x6f, 0x63, 0x6b, 0x65, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x16, 0x2e, 0x61, 0x75, 0x74, 0x68, 0x2e, 0x76, 0x32, 0x2e, 0x41, 0x63, 0x63, 0x6f, 0x75,
+	0x6e, 0x74, 0x4c, 0x6f, 0x63, 0x6b, 0x65, 0x64, 0x48, 0x00, 0x52, 0x0d, 0x61, 0x63, 0x63, 0x6f,
+	0x75, 0x6e, 0x74, 0x4c, 0x6f, 0x63, 0x6b, 0x65, 0x64, 0x12, 0x3f, 0x0a, 0x0e, 0x65, 0x6d, 0x61,
+	0x69, 0x6c, 0x5f, 0x76, 0x65, 0x72, 0x69, 0x66, 0x69, 0x65, 0x64, 0x18, 0x05, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x16, 0x2e, 0x61, 0x75, 0x74, 0x68, 0x2e, 0x76, 0x32, 0x2e, 0x45, 0x6d, 0x61, 0x69,
+	0x6c, 0x56, 0x65, 0x72, 0x69, 0x66, 0x69, 0x65, 0x64, 0x48, 0x00, 0x52, 0x0d, 0x65, 0x6d, 0x61,
+	0x69, 0x6c, 0x56, 0x65, 0x72, 0x69, 0x66, 0x69, 0x65, 0x64, 0x42, 0x09, 0x0a, 0x07, 0x64, 0x65,
+	0x74, 0x61, 0x69, 0x6c, 0x73, 0x22, 0x34, 0x0a, 0x0f, 0x55, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d,
+	0x65, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x64, 0x12, 0x21, 0x0a, 0x0c, 0x6e, 0x65, 0x77, 0x5f,
+	0x75, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b,
+	0x6e, 0x65, 0x77, 0x55, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x22, 0x27, 0x0a, 0x0d, 0x41,
+	0x63, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x4c, 0x6f, 0x63, 0x6b, 0x65, 0x64, 0x12, 0x16, 0x0a, 0x06,
+	0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x72, 0x65,
+	0x61, 0x73, 0x6f, 0x6e, 0x22, 0x0f, 0x0a, 0x0d, 0x45, 0x6d, 0x61, 0x69, 0x6c, 0x56, 0x65, 0x72,
+	0x69, 0x66, 0x69, 0x65, 0x64, 0x2a, 0xc0, 0x01, 0x0a, 0x0a, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65,
+	0x54, 0x79, 0x70, 0x65, 0x12, 0x1b, 0x0a, 0x17, 0x43, 0x48, 0x41, 0x4e, 0x47, 0x45, 0x5f, 0x54,
+	0x59, 0x50, 0x45, 0x5f, 0x55, 0x4e, 0x53, 0x50, 0x45, 0x43, 0x49, 0x46, 0x49, 0x45, 0x44, 0x10,
+	0x00, 0x12, 0x1a, 0x0a, 0x16, 0x43, 0x48, 0x41, 0x4e, 0x47, 0x45, 0x5f, 0x54, 0x59, 0x50, 0x45,
+	0x5f, 0x52, 0x45, 0x47, 0x49, 0x53, 0x54, 0x45, 0x52, 0x45, 0x44, 0x10, 0x01, 0x12, 0x17, 0x0a,
+	0x13, 0x43, 0x48, 0x41, 0x4e, 0x47, 0x45, 0x5f, 0x54, 0x59, 0x50, 0x45, 0x5f, 0x44, 0x45, 0x4c,
+	0x45, 0x54, 0x45, 0x44, 0x10, 0x02, 0x12, 0x20, 0x0a, 0x1c, 0x43, 0x48, 0x41, 0x4e, 0x47, 0x45,
+	0x5f, 0x54, 0x59, 0x50, 0x45, 0x5f, 0x55, 0x53, 0x45, 0x52, 0x4e, 0x41, 0x4d, 0x45, 0x5f, 0x43,
+	0x48, 0x41, 0x4e, 0x47, 0x45, 0x44, 0x10, 0x03, 0x12, 0x1e, 0x0a, 0x1a, 0x43, 0x48, 0x41, 0x4e,
+	0x47, 0x45, 0x5f, 0x54, 0x59, 0x50, 0x45, 0x5f, 0x41, 0x43, 0x43, 0x4f, 0x55, 0x4e, 0x54, 0x5f,
+	0x4c, 0x4f, 0x43, 0x4b, 0x45, 0x44, 0x10, 0x04, 0x12, 0x1e, 0x0a, 0x1a, 0x43, 0x48, 0x41, 0x4e,
+	0x47, 0x45, 0x5f, 0x54, 0x59, 0x50, 0x45, 0x5f, 0x45, 0x4d, 0x41, 0x49, 0x4c, 0x5f, 0x56, 0x45,
+	0x52, 0x49, 0x46, 0x49, 0x45, 0x44, 0x10, 0x05, 0x42, 0x09, 0x5a, 0x07, 0x61, 0x75, 0x74, 0x68,
+	0x2f, 0x76, 0x32, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_auth_v2_kafka_proto_rawDescOnce sync.Once
+	file_auth_v2_kafka_proto_rawDescData = file_auth_v2_kafka_proto_rawDesc
+)
+
+func file_auth_v2_kafka_proto_rawDescGZIP() []byte {
+	file_auth_v2_kafka_proto_rawDescOnce.Do(func() {
+		file_auth_v2_kafka_proto_rawDescData = protoimpl.X.CompressGZIP(file_auth_v2_kafka_proto_rawDescData)
+	})
+	return file_auth_v2_kafka_proto_rawDescData
+}
+
+var file_auth_v2_kafka_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_auth_v2_kafka_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_auth_v2_kafka_proto_goTypes = []any{
+	(ChangeType)(0),         // 0: auth.v2.ChangeType
+	(*ChangedEvent)(nil),    // 1: auth.v2.ChangedEvent
+	(*UsernameChanged)(nil), // 2: auth.v2.UsernameChanged
+	(*AccountLocked)(nil),   // 3: auth.v2.AccountLocked
+	(*EmailVerified)(nil),   // 4: auth.v2.EmailVerified
+}
+var file_auth_v2_kafka_proto_depIdxs = []int32{
+	0, // 0: auth.v2.ChangedEvent.change_type:type_name -> auth.v2.ChangeType
+	2, // 1: auth.v2.ChangedEvent.username_changed:type_name -> auth.v2.UsernameChanged
+	3, // 2: auth.v2.ChangedEvent.account_locked:type_name -> auth.v2.AccountLocked
+	4, // 3: auth.v2.ChangedEvent.email_verified:type_name -> auth.v2.EmailVerified
+	4, // [4:4] is the sub-list for method output_type
+	4, // [4:4] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_auth_v2_kafka_proto_init() }
+func file_auth_v2_kafka_proto_init() {
+	if File_auth_v2_kafka_proto != nil {
+		return
+	}
+	file_auth_v2_kafka_proto_msgTypes[0].OneofWrappers = []any{
+		(*ChangedEvent_UsernameChanged)(nil),
+		(*ChangedEvent_AccountLocked)(nil),
+		(*ChangedEvent_EmailVerified)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_auth_v2_kafka_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_auth_v2_kafka_proto_goTypes,
+		DependencyIndexes: file_auth_v2_kafka_proto_depIdxs,
+		EnumInfos:         file_auth_v2_kafka_proto_enumTypes,
+		MessageInfos:      file_auth_v2_kafka_proto_msgTypes,
+	}.Build()
+	File_auth_v2_kafka_proto = out.File
+	file_auth_v2_kafka_proto_rawDesc = nil
+	file_auth_v2_kafka_proto_goTypes = nil
+	file_auth_v2_kafka_proto_depIdxs = nil
+}
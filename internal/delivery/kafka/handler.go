@@ -12,8 +12,6 @@ import (
 	"google.golang.org/grpc/codes"
 
 	"github.com/Karzoug/meower-common-go/ucerr"
-
-	gen "github.com/Karzoug/meower-user-service/internal/delivery/kafka/gen/auth/v1"
 )
 
 const (
@@ -21,12 +19,13 @@ const (
 	maxRetryTimeoutBeforeExit = 60 * time.Second
 )
 
-func (c consumer) userRegisteredHandler(ctx context.Context, event *gen.ChangedEvent, logger zerolog.Logger) error {
-	var id xid.ID
-	operation := func() error {
-		ctx, cancel := context.WithTimeout(ctx, defaultOperationTimeout)
-		defer cancel()
+// errUnprocessable is returned by handlers for events that fail on every retry,
+// such messages are skipped: sent to the dead letter topic if it is configured or only counted.
+var errUnprocessable = errors.New("unprocessable event")
 
+func (c consumer) userRegisteredHandler(ctx context.Context, event authEvent, logger zerolog.Logger) error {
+	var id xid.ID
+	operation := func(ctx context.Context) error {
 		var err error
 		id, err = c.userService.CreateByUsername(ctx, event.Username)
 		if err != nil {
@@ -51,11 +50,7 @@ func (c consumer) userRegisteredHandler(ctx context.Context, event *gen.ChangedE
 
 		return nil
 	}
-	if err := backoff.Retry(operation,
-		backoff.NewExponentialBackOff(
-			backoff.WithMaxElapsedTime(maxRetryTimeoutBeforeExit),
-		),
-	); err != nil {
+	if err := c.retry(ctx, event, operation); err != nil {
 		return fmt.Errorf("all retries for creating user failed: %w", err)
 	}
 
@@ -67,12 +62,9 @@ func (c consumer) userRegisteredHandler(ctx context.Context, event *gen.ChangedE
 	return nil
 }
 
-func (c consumer) userDeletedHandler(ctx context.Context, event *gen.ChangedEvent, logger zerolog.Logger) error {
+func (c consumer) userDeletedHandler(ctx context.Context, event authEvent, logger zerolog.Logger) error {
 	var id xid.ID
-	operation := func() error {
-		ctx, cancel := context.WithTimeout(ctx, defaultOperationTimeout)
-		defer cancel()
-
+	operation := func(ctx context.Context) error {
 		var err error
 		id, err = c.userService.DeleteByUsername(ctx, event.Username)
 		if err != nil {
@@ -94,11 +86,7 @@ func (c consumer) userDeletedHandler(ctx context.Context, event *gen.ChangedEven
 
 		return nil
 	}
-	if err := backoff.Retry(operation,
-		backoff.NewExponentialBackOff(
-			backoff.WithMaxElapsedTime(maxRetryTimeoutBeforeExit),
-		),
-	); err != nil {
+	if err := c.retry(ctx, event, operation); err != nil {
 		return fmt.Errorf("all retries for deleting user failed: %w", err)
 	}
 
@@ -109,3 +97,85 @@ func (c consumer) userDeletedHandler(ctx context.Context, event *gen.ChangedEven
 
 	return nil
 }
+
+// usernameChangedHandler renames the user. The change is already done if the user
+// is not found by the old username, but found by the new one: the message is redelivered.
+func (c consumer) usernameChangedHandler(ctx context.Context, event authEvent, logger zerolog.Logger) error {
+	var id xid.ID
+	operation := func(ctx context.Context) error {
+		var err error
+		id, err = c.userService.ChangeUsername(ctx, event.Username, event.NewUsername)
+		if err != nil {
+			var serr ucerr.Error
+			if errors.As(err, &serr) {
+				if serr.Code() == codes.NotFound {
+					if _, err := c.userService.GetShortProjectionByUsername(ctx, event.NewUsername); err == nil {
+						return nil
+					}
+				}
+				logger.Error().
+					Str("username", event.Username).
+					Str("new_username", event.NewUsername).
+					Err(serr.Unwrap()).
+					Msg("change username failed")
+
+				// the user is unknown or the new username is taken: retries do not help
+				if serr.Code() == codes.NotFound || serr.Code() == codes.AlreadyExists {
+					return backoff.Permanent(fmt.Errorf("%w: %w", errUnprocessable, err))
+				}
+			} else {
+				logger.Error().
+					Str("username", event.Username).
+					Str("new_username", event.NewUsername).
+					Err(err).
+					Msg("change username failed")
+			}
+
+			return err
+		}
+
+		return nil
+	}
+	if err := c.retry(ctx, event, operation); err != nil {
+		return fmt.Errorf("all retries for changing username failed: %w", err)
+	}
+
+	logger.Info().
+		Ctx(ctx).
+		Str("changed_user_id", id.String()).
+		Msg("processed message")
+
+	return nil
+}
+
+// acknowledgeHandler handles events of a known type that change nothing in the service.
+func (c consumer) acknowledgeHandler(ctx context.Context, event authEvent, logger zerolog.Logger) error {
+	logger.Info().
+		Ctx(ctx).
+		Str("change_type", event.ChangeType).
+		Msg("processed message: nothing to change")
+
+	return nil
+}
+
+// retry calls the operation with a timeout until it succeeds, the retry budget is over
+// or the context is done.
+func (c consumer) retry(ctx context.Context, event authEvent, operation func(context.Context) error) error {
+	return backoff.RetryNotify(
+		func() error {
+			ctx, cancel := context.WithTimeout(ctx, defaultOperationTimeout)
+			defer cancel()
+
+			return operation(ctx)
+		},
+		backoff.WithContext(
+			backoff.NewExponentialBackOff(
+				backoff.WithMaxElapsedTime(maxRetryTimeoutBeforeExit),
+			),
+			ctx,
+		),
+		func(error, time.Duration) {
+			c.metrics.handlerRetried(event.ChangeType)
+		},
+	)
+}
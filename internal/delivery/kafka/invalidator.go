@@ -0,0 +1,107 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/proto"
+
+	ck "github.com/Karzoug/meower-common-go/kafka"
+
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/broker"
+	userGen "github.com/Karzoug/meower-user-service/internal/delivery/kafka/gen/user/v1"
+)
+
+type cacheInvalidator interface {
+	Invalidate(id xid.ID)
+}
+
+type invalidationConsumer struct {
+	topic       string
+	source      broker.Source
+	invalidator cacheInvalidator
+	logger      zerolog.Logger
+}
+
+// NewInvalidationConsumer creates a consumer of the user change events emitted by the service
+// that drops changed users from the in-process cache. Every replica must read all events,
+// so the source is expected to read the topic from the latest offset in its own consumer group
+// without committing offsets. The source is closed when the consumer stops.
+func NewInvalidationConsumer(topic string, source broker.Source, invalidator cacheInvalidator, logger zerolog.Logger) invalidationConsumer {
+	logger = logger.With().
+		Str("component", "kafka invalidation consumer").
+		Logger()
+
+	return invalidationConsumer{
+		topic:       topic,
+		source:      source,
+		invalidator: invalidator,
+		logger:      logger,
+	}
+}
+
+func (c invalidationConsumer) Run(ctx context.Context) (err error) {
+	userChangedEventFngpnt := ck.MessageTypeHeaderValue(&userGen.ChangedEvent{})
+
+	defer func() {
+		if defErr := c.source.Close(); defErr != nil {
+			err = errors.Join(err,
+				fmt.Errorf("failed to close consumer: %w", defErr))
+		}
+	}()
+
+	if err := c.source.Subscribe(c.topic, nil); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+			msg, err := c.source.Poll(100 * time.Millisecond)
+			if err != nil {
+				if errors.Is(err, broker.ErrFatal) {
+					return fmt.Errorf("fatal error while read message: %w", err)
+				}
+				c.logger.Error().
+					Err(err).
+					Msg("failed to read message")
+				continue
+			}
+			if msg == nil {
+				continue
+			}
+
+			eventType, ok := msg.Header(ck.MessageTypeHeaderKey)
+			if !ok || string(eventType) != userChangedEventFngpnt {
+				continue
+			}
+
+			event := &userGen.ChangedEvent{}
+			if err := proto.Unmarshal(msg.Value, event); err != nil {
+				// the cache entry expires by ttl anyway, so do not stop the service
+				c.logger.Error().
+					Err(err).
+					Str("key", string(msg.Key)).
+					Msg("failed to deserialize payload")
+				continue
+			}
+
+			id, err := xid.FromString(event.Id)
+			if err != nil {
+				c.logger.Error().
+					Err(err).
+					Str("key", string(msg.Key)).
+					Msg("invalid user id in event")
+				continue
+			}
+
+			c.invalidator.Invalidate(id)
+		}
+	}
+}
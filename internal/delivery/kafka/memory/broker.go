@@ -0,0 +1,323 @@
+// Package memory is an in-memory message broker with a single member per consumer group.
+// It is intended for tests and local development.
+package memory
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/broker"
+)
+
+var errClosed = errors.New("source is closed")
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// Broker keeps messages of topics and committed offsets of consumer groups.
+type Broker struct {
+	mu         sync.Mutex
+	partitions int32
+	topics     map[string][][]broker.Message
+	committed  map[string]map[partitionKey]int64
+	// produced is closed and replaced when a message is produced
+	produced chan struct{}
+}
+
+// New creates a broker with the number of partitions of every topic,
+// topics are created on first use.
+func New(partitions int32) *Broker {
+	return &Broker{
+		partitions: max(partitions, 1),
+		topics:     make(map[string][][]broker.Message),
+		committed:  make(map[string]map[partitionKey]int64),
+		produced:   make(chan struct{}),
+	}
+}
+
+// Produce appends the message to the partition of the topic chosen by the key
+// and returns the position of the message.
+func (b *Broker) Produce(topic string, key, value []byte, headers ...broker.Header) broker.TopicPartition {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	partitions := b.topic(topic)
+
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	partition := int32(h.Sum32() % uint32(b.partitions)) //nolint:gosec
+
+	msg := broker.Message{
+		Topic:     topic,
+		Partition: partition,
+		Offset:    int64(len(partitions[partition])),
+		Key:       slices.Clone(key),
+		Value:     slices.Clone(value),
+		Headers:   slices.Clone(headers),
+		Timestamp: time.Now(),
+	}
+	partitions[partition] = append(partitions[partition], msg)
+
+	close(b.produced)
+	b.produced = make(chan struct{})
+
+	return msg.TopicPartition()
+}
+
+// Committed returns the committed offset of the group for the partition.
+func (b *Broker) Committed(groupID, topic string, partition int32) (int64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	offset, ok := b.committed[groupID][partitionKey{topic: topic, partition: partition}]
+	return offset, ok
+}
+
+// NewSource creates the member of the consumer group that reads from the earliest offset
+// if nothing is committed, stored offsets are committed at once as by auto commit without interval.
+func (b *Broker) NewSource(groupID string) *Source {
+	return &Source{
+		b:       b,
+		groupID: groupID,
+	}
+}
+
+// NewBroadcastSource creates a source that reads from the latest offset and never commits.
+func (b *Broker) NewBroadcastSource() *Source {
+	return &Source{
+		b:      b,
+		latest: true,
+	}
+}
+
+// topic returns partitions of the topic creating it if needed, b.mu must be held.
+func (b *Broker) topic(name string) [][]broker.Message {
+	partitions, ok := b.topics[name]
+	if !ok {
+		partitions = make([][]broker.Message, b.partitions)
+		b.topics[name] = partitions
+	}
+	return partitions
+}
+
+// Source is a source of messages of the broker.
+type Source struct {
+	b       *Broker
+	groupID string
+	latest  bool
+
+	mu        sync.Mutex
+	topic     string
+	rebalance broker.RebalanceFunc
+	// positions are offsets of the next messages to read by partition
+	positions []int64
+	// next is a partition to read first, partitions are read round-robin
+	next   int32
+	closed bool
+}
+
+var _ broker.Source = (*Source)(nil)
+
+// Subscribe assigns all partitions of the topic to the source.
+func (s *Source) Subscribe(topic string, rebalance broker.RebalanceFunc) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errClosed
+	}
+
+	s.b.mu.Lock()
+	partitions := s.b.topic(topic)
+	s.positions = make([]int64, len(partitions))
+	assigned := make([]broker.TopicPartition, len(partitions))
+	for i := range partitions {
+		p := int32(i) //nolint:gosec
+		switch offset, ok := s.b.committed[s.groupID][partitionKey{topic: topic, partition: p}]; {
+		case s.latest:
+			s.positions[p] = int64(len(partitions[p]))
+		case ok:
+			s.positions[p] = offset
+		}
+		assigned[p] = broker.TopicPartition{Topic: topic, Partition: p, Offset: s.positions[p]}
+	}
+	s.b.mu.Unlock()
+
+	s.topic = topic
+	s.rebalance = rebalance
+	s.mu.Unlock()
+
+	if rebalance != nil {
+		return rebalance(broker.RebalanceEvent{
+			Type:       broker.PartitionsAssigned,
+			Partitions: assigned,
+		})
+	}
+	return nil
+}
+
+func (s *Source) Poll(timeout time.Duration) (*broker.Message, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		msg, produced, err := s.read()
+		if msg != nil || err != nil {
+			return msg, err
+		}
+
+		select {
+		case <-produced:
+		case <-timer.C:
+			return nil, nil
+		}
+	}
+}
+
+// read returns the next message if any or the channel closed on the next produced message.
+func (s *Source) read() (*broker.Message, <-chan struct{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, nil, errClosed
+	}
+
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+
+	partitions := s.b.topics[s.topic]
+	for range s.positions {
+		p := s.next
+		s.next = (s.next + 1) % int32(len(s.positions)) //nolint:gosec
+
+		if s.positions[p] < int64(len(partitions[p])) {
+			msg := partitions[p][s.positions[p]]
+			s.positions[p]++
+			return &msg, nil, nil
+		}
+	}
+
+	return nil, s.b.produced, nil
+}
+
+func (s *Source) StoreOffsets(tps []broker.TopicPartition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errClosed
+	}
+	// offsets of the broadcast source are never committed
+	if s.latest {
+		return nil
+	}
+
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+
+	committed, ok := s.b.committed[s.groupID]
+	if !ok {
+		committed = make(map[partitionKey]int64)
+		s.b.committed[s.groupID] = committed
+	}
+	for _, tp := range tps {
+		if tp.Topic == s.topic {
+			committed[partitionKey{topic: tp.Topic, partition: tp.Partition}] = tp.Offset
+		}
+	}
+	return nil
+}
+
+// Commit is a no-op: stored offsets are already committed.
+func (s *Source) Commit() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errClosed
+	}
+	return nil
+}
+
+func (s *Source) Lag() ([]broker.PartitionLag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, errClosed
+	}
+
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+
+	partitions := s.b.topics[s.topic]
+	lags := make([]broker.PartitionLag, len(s.positions))
+	for i := range s.positions {
+		p := int32(i) //nolint:gosec
+		offset := s.b.committed[s.groupID][partitionKey{topic: s.topic, partition: p}]
+		lags[p] = broker.PartitionLag{
+			Topic:     s.topic,
+			Partition: p,
+			Lag:       max(int64(len(partitions[p]))-offset, 0),
+		}
+	}
+	return lags, nil
+}
+
+// Close revokes the assigned partitions.
+func (s *Source) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errClosed
+	}
+	rebalance := s.rebalance
+	revoked := make([]broker.TopicPartition, len(s.positions))
+	for i := range s.positions {
+		revoked[i] = broker.TopicPartition{Topic: s.topic, Partition: int32(i)} //nolint:gosec
+	}
+	s.mu.Unlock()
+
+	// the rebalance func may store offsets of the revoked partitions
+	var err error
+	if rebalance != nil && len(revoked) > 0 {
+		err = rebalance(broker.RebalanceEvent{
+			Type:       broker.PartitionsRevoked,
+			Partitions: revoked,
+		})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+
+	return err
+}
+
+// NewSink creates a sink producing messages to the broker.
+func (b *Broker) NewSink() Sink {
+	return Sink{b: b}
+}
+
+// Sink is a sink of messages of the broker.
+type Sink struct {
+	b *Broker
+}
+
+var _ broker.Sink = Sink{}
+
+func (s Sink) Produce(_ context.Context, msg *broker.Message) error {
+	s.b.Produce(msg.Topic, msg.Key, msg.Value, msg.Headers...)
+	return nil
+}
+
+func (s Sink) Close() error {
+	return nil
+}
@@ -0,0 +1,181 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/broker"
+)
+
+const (
+	skipReasonMissingType       = "missing_fngpnt"
+	skipReasonUnknownType       = "unknown_fngpnt"
+	skipReasonUnknownChangeType = "unknown_change_type"
+	skipReasonInvalidPayload    = "invalid_payload"
+	skipReasonUnprocessable     = "unprocessable"
+)
+
+type metrics struct {
+	meter metric.Meter
+
+	partitionAssignments metric.Int64Counter
+	processed            metric.Int64Counter
+	skipped              metric.Int64Counter
+	deadLettered         metric.Int64Counter
+	handlerDuration      metric.Float64Histogram
+	retries              metric.Int64Counter
+	lag                  metric.Int64ObservableGauge
+}
+
+func newMetrics() metrics {
+	meter := otel.GetMeterProvider().Meter(instrumentationName)
+
+	partitionAssignments, err := meter.Int64Counter("kafka.consumer.partition_assignments",
+		metric.WithDescription("Number of partitions assigned to or revoked from the consumer."),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	processed, err := meter.Int64Counter("kafka.consumer.messages.processed",
+		metric.WithDescription("Number of processed messages by change type and status."),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	skipped, err := meter.Int64Counter("kafka.consumer.messages.skipped",
+		metric.WithDescription("Number of messages skipped because of unknown message or change type or invalid payload."),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	deadLettered, err := meter.Int64Counter("kafka.consumer.messages.dead_lettered",
+		metric.WithDescription("Number of skipped messages sent to the dead letter topic."),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	handlerDuration, err := meter.Float64Histogram("kafka.consumer.handler.duration",
+		metric.WithDescription("Duration of message handling including retries."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	retries, err := meter.Int64Counter("kafka.consumer.handler.retries",
+		metric.WithDescription("Number of message handling retries."),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	lag, err := meter.Int64ObservableGauge("kafka.consumer.lag",
+		metric.WithDescription("Number of messages of an assigned partition after the committed offset."),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return metrics{
+		meter:                meter,
+		partitionAssignments: partitionAssignments,
+		processed:            processed,
+		skipped:              skipped,
+		deadLettered:         deadLettered,
+		handlerDuration:      handlerDuration,
+		retries:              retries,
+		lag:                  lag,
+	}
+}
+
+func (m metrics) partitionsAssigned(n int) {
+	m.partitionAssignments.Add(context.Background(), int64(n),
+		metric.WithAttributes(attribute.String("event", "assigned")))
+}
+
+// partitionsRevoked counts revoked partitions, lost partitions are revoked without commit.
+func (m metrics) partitionsRevoked(n int, lost bool) {
+	event := "revoked"
+	if lost {
+		event = "lost"
+	}
+	m.partitionAssignments.Add(context.Background(), int64(n),
+		metric.WithAttributes(attribute.String("event", event)))
+}
+
+func (m metrics) messageSkipped(topic, reason string) {
+	m.skipped.Add(context.Background(), 1,
+		metric.WithAttributes(
+			attribute.String("topic", topic),
+			attribute.String("reason", reason),
+		))
+}
+
+func (m metrics) messageDeadLettered(topic, reason string) {
+	m.deadLettered.Add(context.Background(), 1,
+		metric.WithAttributes(
+			attribute.String("topic", topic),
+			attribute.String("reason", reason),
+		))
+}
+
+func (m metrics) messageProcessed(ctx context.Context, event authEvent, d time.Duration, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+
+	m.processed.Add(ctx, 1,
+		metric.WithAttributes(
+			attribute.String("change_type", event.ChangeType),
+			attribute.String("schema_version", event.SchemaVersion),
+			attribute.String("status", status),
+		))
+	m.handlerDuration.Record(ctx, d.Seconds(),
+		metric.WithAttributes(attribute.String("change_type", event.ChangeType)))
+}
+
+func (m metrics) handlerRetried(changeType string) {
+	m.retries.Add(context.Background(), 1,
+		metric.WithAttributes(attribute.String("change_type", changeType)))
+}
+
+// registerLag reports the lag of partitions assigned to the source
+// until the returned func is called, it must be called before the source is closed.
+func (m metrics) registerLag(source broker.Source) (func(), error) {
+	reg, err := m.meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		lags, err := source.Lag()
+		if err != nil {
+			return err
+		}
+
+		for _, lag := range lags {
+			o.ObserveInt64(m.lag, lag.Lag,
+				metric.WithAttributes(
+					attribute.String("topic", lag.Topic),
+					attribute.String("partition", strconv.Itoa(int(lag.Partition))),
+				))
+		}
+
+		return nil
+	}, m.lag)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if err := reg.Unregister(); err != nil {
+			otel.Handle(err)
+		}
+	}, nil
+}
@@ -0,0 +1,171 @@
+package kafka
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/broker"
+)
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// partitionOffsets are offsets of dispatched but not yet stored messages of a partition.
+type partitionOffsets struct {
+	// epoch identifies the assignment of the partition: it changes when the partition is forgotten,
+	// so completions of messages dispatched before are told apart from redelivered ones
+	epoch uint64
+	// inflight are offsets in the order of dispatch, it is ascending within a partition
+	inflight []int64
+	done     map[int64]struct{}
+}
+
+// tracked is a dispatched message with the epoch of the partition it was added in.
+type tracked struct {
+	msg   *broker.Message
+	epoch uint64
+}
+
+// offsetTracker tracks messages processed concurrently and stores the offset
+// only after all messages before it in the partition are completed,
+// so no message is skipped after a crash.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[partitionKey]*partitionOffsets
+	store      func(broker.TopicPartition)
+	// inflight is a number of added but not completed messages,
+	// idle is closed when it drops to zero
+	inflight int
+	idle     chan struct{}
+	epoch    uint64
+}
+
+// newOffsetTracker creates a tracker that stores offsets with the store func,
+// the func is called under the lock, so offsets of a partition are stored in order.
+func newOffsetTracker(store func(broker.TopicPartition)) *offsetTracker {
+	return &offsetTracker{
+		partitions: make(map[partitionKey]*partitionOffsets),
+		store:      store,
+		idle:       closedChan(),
+	}
+}
+
+// add registers the dispatched message, it must be called in the order of consumption.
+// The returned value is passed to complete when the message is processed.
+func (t *offsetTracker) add(msg *broker.Message) tracked {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tp := msg.TopicPartition()
+	key := partitionKey{topic: tp.Topic, partition: tp.Partition}
+	p, ok := t.partitions[key]
+	if !ok {
+		t.epoch++
+		p = &partitionOffsets{epoch: t.epoch, done: make(map[int64]struct{})}
+		t.partitions[key] = p
+	}
+	p.inflight = append(p.inflight, tp.Offset)
+
+	if t.inflight == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.inflight++
+
+	return tracked{msg: msg, epoch: p.epoch}
+}
+
+// complete marks the message completed and stores the offset after
+// the lowest contiguous completed message of the partition if it has advanced.
+// Messages of forgotten partitions are ignored even if the partition is assigned again:
+// they are already not counted, and the offset may be redelivered and still in flight.
+func (t *offsetTracker) complete(m tracked) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tp := m.msg.TopicPartition()
+	p, ok := t.partitions[partitionKey{topic: tp.Topic, partition: tp.Partition}]
+	if !ok || p.epoch != m.epoch {
+		return
+	}
+	if _, ok := p.done[tp.Offset]; ok || !slices.Contains(p.inflight, tp.Offset) {
+		return
+	}
+	p.done[tp.Offset] = struct{}{}
+
+	t.inflight--
+	if t.inflight == 0 {
+		close(t.idle)
+	}
+
+	n := 0
+	for _, offset := range p.inflight {
+		if _, ok := p.done[offset]; !ok {
+			break
+		}
+		delete(p.done, offset)
+		n++
+	}
+	if n == 0 {
+		return
+	}
+
+	last := p.inflight[n-1]
+	p.inflight = p.inflight[n:]
+
+	t.store(broker.TopicPartition{
+		Topic:     tp.Topic,
+		Partition: tp.Partition,
+		Offset:    last + 1,
+	})
+}
+
+// waitIdle waits until all added messages are completed or the context is done.
+func (t *offsetTracker) waitIdle(ctx context.Context) error {
+	t.mu.Lock()
+	if t.inflight == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	idle := t.idle
+	t.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// forget drops offsets of the revoked partitions: messages of them completed later are not stored.
+func (t *offsetTracker) forget(tps []broker.TopicPartition) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, tp := range tps {
+		key := partitionKey{topic: tp.Topic, partition: tp.Partition}
+		p, ok := t.partitions[key]
+		if !ok {
+			continue
+		}
+		delete(t.partitions, key)
+
+		t.inflight -= len(p.inflight) - len(p.done)
+	}
+	if t.inflight == 0 {
+		select {
+		case <-t.idle:
+		default:
+			close(t.idle)
+		}
+	}
+}
+
+func closedChan() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
@@ -0,0 +1,161 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/broker"
+)
+
+func TestOffsetTracker(t *testing.T) {
+	tp := func(partition int32, offset int64) broker.TopicPartition {
+		return broker.TopicPartition{Topic: "auth", Partition: partition, Offset: offset}
+	}
+
+	tests := []struct {
+		name     string
+		added    []broker.TopicPartition
+		complete []int
+		want     []int64
+	}{
+		{
+			name:     "in order",
+			added:    []broker.TopicPartition{tp(0, 10), tp(0, 11), tp(0, 12)},
+			complete: []int{0, 1, 2},
+			want:     []int64{11, 12, 13},
+		},
+		{
+			name:     "out of order",
+			added:    []broker.TopicPartition{tp(0, 10), tp(0, 11), tp(0, 12)},
+			complete: []int{2, 1, 0},
+			want:     []int64{13},
+		},
+		{
+			name:     "gap is not skipped",
+			added:    []broker.TopicPartition{tp(0, 10), tp(0, 11), tp(0, 12)},
+			complete: []int{0, 2},
+			want:     []int64{11},
+		},
+		{
+			name:     "completed twice",
+			added:    []broker.TopicPartition{tp(0, 10), tp(0, 11)},
+			complete: []int{0, 0, 1},
+			want:     []int64{11, 12},
+		},
+		{
+			name:     "partitions are independent",
+			added:    []broker.TopicPartition{tp(0, 10), tp(1, 20), tp(0, 11)},
+			complete: []int{2, 1},
+			want:     []int64{21},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stored []int64
+			tracker := newOffsetTracker(func(tp broker.TopicPartition) {
+				stored = append(stored, tp.Offset)
+			})
+
+			added := make([]tracked, len(tt.added))
+			for i, tp := range tt.added {
+				added[i] = tracker.add(message(tp))
+			}
+			for _, i := range tt.complete {
+				tracker.complete(added[i])
+			}
+
+			if !slices.Equal(stored, tt.want) {
+				t.Errorf("stored offsets = %v, want %v", stored, tt.want)
+			}
+		})
+	}
+}
+
+func TestOffsetTrackerWaitIdle(t *testing.T) {
+	tracker := newOffsetTracker(func(broker.TopicPartition) {})
+
+	if err := tracker.waitIdle(context.Background()); err != nil {
+		t.Fatalf("waitIdle() without messages error = %v", err)
+	}
+
+	tp0 := broker.TopicPartition{Topic: "auth", Partition: 0, Offset: 1}
+	tp1 := broker.TopicPartition{Topic: "auth", Partition: 1, Offset: 1}
+	m0 := tracker.add(message(tp0))
+	tracker.add(message(tp1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := tracker.waitIdle(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("waitIdle() with in-flight messages error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- tracker.waitIdle(context.Background())
+	}()
+
+	tracker.complete(m0)
+	// the revoked partition is not waited for
+	tracker.forget([]broker.TopicPartition{tp1})
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("waitIdle() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waitIdle() is not done after all messages are completed or forgotten")
+	}
+}
+
+func TestOffsetTrackerReassign(t *testing.T) {
+	var stored []int64
+	tracker := newOffsetTracker(func(tp broker.TopicPartition) {
+		stored = append(stored, tp.Offset)
+	})
+	tp := func(offset int64) broker.TopicPartition {
+		return broker.TopicPartition{Topic: "auth", Partition: 0, Offset: offset}
+	}
+
+	old10 := tracker.add(message(tp(10)))
+	old11 := tracker.add(message(tp(11)))
+
+	// the partition is revoked while the messages are in flight and assigned again,
+	// the messages are redelivered from the committed offset
+	tracker.forget([]broker.TopicPartition{tp(0)})
+	new10 := tracker.add(message(tp(10)))
+	new11 := tracker.add(message(tp(11)))
+
+	// completions of the messages dispatched before the revocation are ignored
+	tracker.complete(old10)
+	tracker.complete(old11)
+	if len(stored) != 0 {
+		t.Fatalf("stored offsets after stale completions = %v, want none", stored)
+	}
+	if err := waitIdleNow(tracker); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("waitIdle() with redelivered messages in flight error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	tracker.complete(new11)
+	tracker.complete(new10)
+	if want := []int64{12}; !slices.Equal(stored, want) {
+		t.Errorf("stored offsets = %v, want %v", stored, want)
+	}
+	if err := waitIdleNow(tracker); err != nil {
+		t.Errorf("waitIdle() after all messages are completed error = %v", err)
+	}
+}
+
+func waitIdleNow(tracker *offsetTracker) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	return tracker.waitIdle(ctx)
+}
+
+func message(tp broker.TopicPartition) *broker.Message {
+	return &broker.Message{Topic: tp.Topic, Partition: tp.Partition, Offset: tp.Offset}
+}
@@ -0,0 +1,78 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/broker"
+)
+
+// rebalance is called by the consumer on partition assignment changes.
+// Before partitions are revoked, in-flight messages are drained and stored offsets are committed,
+// so the new owner of the partitions continues exactly after the processed messages.
+func (c consumer) rebalance(ctx context.Context, offsets *offsetTracker, ev broker.RebalanceEvent) error {
+	switch ev.Type {
+	case broker.PartitionsAssigned:
+		c.metrics.partitionsAssigned(len(ev.Partitions))
+		c.logger.Info().
+			Strs("partitions", partitionsStrings(ev.Partitions)).
+			Msg("partitions assigned")
+	case broker.PartitionsRevoked:
+		c.metrics.partitionsRevoked(len(ev.Partitions), false)
+		c.logger.Info().
+			Strs("partitions", partitionsStrings(ev.Partitions)).
+			Msg("partitions revoked")
+
+		c.drainAndCommit(ctx, offsets, false)
+		// messages of the partitions completed later are ignored by the tracker,
+		// even if the partitions are assigned again and the messages are redelivered
+		offsets.forget(ev.Partitions)
+	case broker.PartitionsLost:
+		// offsets of lost partitions may be already committed by the new owner
+		c.metrics.partitionsRevoked(len(ev.Partitions), true)
+		c.logger.Warn().
+			Strs("partitions", partitionsStrings(ev.Partitions)).
+			Msg("partitions lost")
+
+		c.drainAndCommit(ctx, offsets, true)
+		offsets.forget(ev.Partitions)
+	}
+
+	return nil
+}
+
+// drainAndCommit waits for in-flight messages no longer than the drain timeout
+// and synchronously commits stored offsets unless the assignment is lost.
+func (c consumer) drainAndCommit(ctx context.Context, offsets *offsetTracker, lost bool) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(c.cfg.DrainTimeoutSeconds)*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if err := offsets.waitIdle(ctx); err != nil {
+		c.logger.Warn().
+			Err(context.Cause(ctx)).
+			Msg("drain in-flight messages: not finished, they will be processed again")
+	} else {
+		c.logger.Info().
+			Dur("duration", time.Since(start)).
+			Msg("drain in-flight messages: done")
+	}
+
+	if lost {
+		return
+	}
+
+	if err := c.source.Commit(); err != nil {
+		c.logger.Error().
+			Err(err).
+			Msg("failed to commit offsets")
+	}
+}
+
+func partitionsStrings(tps []broker.TopicPartition) []string {
+	res := make([]string, len(tps))
+	for i := range tps {
+		res[i] = tps[i].String()
+	}
+	return res
+}
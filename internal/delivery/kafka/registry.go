@@ -0,0 +1,148 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/proto"
+
+	ck "github.com/Karzoug/meower-common-go/kafka"
+
+	gen "github.com/Karzoug/meower-user-service/internal/delivery/kafka/gen/auth/v1"
+	genV2 "github.com/Karzoug/meower-user-service/internal/delivery/kafka/gen/auth/v2"
+)
+
+// change types of auth events, they are the enum names without the prefix in lower case
+const (
+	changeTypeRegistered      = "registered"
+	changeTypeDeleted         = "deleted"
+	changeTypeUsernameChanged = "username_changed"
+	changeTypeAccountLocked   = "account_locked"
+	changeTypeEmailVerified   = "email_verified"
+)
+
+// authEvent is an auth change event decoded from any of the supported schema versions.
+type authEvent struct {
+	// SchemaVersion is a version of the schema of the message, e.g. v1,
+	// it is set by the consumer after decoding
+	SchemaVersion string
+	// ChangeType is a change type label, e.g. registered
+	ChangeType  string
+	Username    string
+	NewUsername string
+	LockReason  string
+}
+
+type handlerFunc func(ctx context.Context, event authEvent, logger zerolog.Logger) error
+
+// schema decodes payloads of a message type.
+type schema struct {
+	version string
+	decode  func(payload []byte) (authEvent, error)
+}
+
+type handlerKey struct {
+	fngpnt     string
+	changeType string
+}
+
+// registry maps message type fingerprints to schemas
+// and fingerprints with change types to handlers.
+type registry struct {
+	schemas  map[string]schema
+	handlers map[handlerKey]handlerFunc
+}
+
+func newRegistry() registry {
+	return registry{
+		schemas:  make(map[string]schema),
+		handlers: make(map[handlerKey]handlerFunc),
+	}
+}
+
+// addSchema registers the message type and returns the fingerprint of it.
+func (r registry) addSchema(version string, msg proto.Message, decode func([]byte) (authEvent, error)) string {
+	fngpnt := ck.MessageTypeHeaderValue(msg)
+	r.schemas[fngpnt] = schema{
+		version: version,
+		decode:  decode,
+	}
+	return fngpnt
+}
+
+// handle registers the handler of the change type of the message type.
+func (r registry) handle(fngpnt, changeType string, h handlerFunc) {
+	r.handlers[handlerKey{fngpnt: fngpnt, changeType: changeType}] = h
+}
+
+func (r registry) schema(fngpnt string) (schema, bool) {
+	s, ok := r.schemas[fngpnt]
+	return s, ok
+}
+
+func (r registry) handler(fngpnt, changeType string) (handlerFunc, bool) {
+	h, ok := r.handlers[handlerKey{fngpnt: fngpnt, changeType: changeType}]
+	return h, ok
+}
+
+// registerHandlers registers handlers of all supported auth events,
+// the same change type of different schema versions is handled the same way.
+func (c consumer) registerHandlers() registry {
+	r := newRegistry()
+
+	v1 := r.addSchema("v1", &gen.ChangedEvent{}, decodeV1)
+	r.handle(v1, changeTypeRegistered, c.userRegisteredHandler)
+	r.handle(v1, changeTypeDeleted, c.userDeletedHandler)
+
+	v2 := r.addSchema("v2", &genV2.ChangedEvent{}, decodeV2)
+	r.handle(v2, changeTypeRegistered, c.userRegisteredHandler)
+	r.handle(v2, changeTypeDeleted, c.userDeletedHandler)
+	r.handle(v2, changeTypeUsernameChanged, c.usernameChangedHandler)
+	// the service keeps neither account locks nor emails
+	r.handle(v2, changeTypeAccountLocked, c.acknowledgeHandler)
+	r.handle(v2, changeTypeEmailVerified, c.acknowledgeHandler)
+
+	return r
+}
+
+func decodeV1(payload []byte) (authEvent, error) {
+	event := &gen.ChangedEvent{}
+	if err := proto.Unmarshal(payload, event); err != nil {
+		return authEvent{}, err
+	}
+
+	return authEvent{
+		ChangeType: changeTypeLabel(event.ChangeType),
+		Username:   event.Username,
+	}, nil
+}
+
+func decodeV2(payload []byte) (authEvent, error) {
+	event := &genV2.ChangedEvent{}
+	if err := proto.Unmarshal(payload, event); err != nil {
+		return authEvent{}, err
+	}
+
+	res := authEvent{
+		ChangeType: changeTypeLabel(event.ChangeType),
+		Username:   event.Username,
+	}
+	switch event.ChangeType {
+	case genV2.ChangeType_CHANGE_TYPE_USERNAME_CHANGED:
+		res.NewUsername = event.GetUsernameChanged().GetNewUsername()
+		if res.NewUsername == "" {
+			return authEvent{}, fmt.Errorf("no new username in %s event", res.ChangeType)
+		}
+	case genV2.ChangeType_CHANGE_TYPE_ACCOUNT_LOCKED:
+		res.LockReason = event.GetAccountLocked().GetReason()
+	}
+
+	return res, nil
+}
+
+// changeTypeLabel returns the change type without the enum prefix, e.g. registered.
+func changeTypeLabel(changeType fmt.Stringer) string {
+	return strings.ToLower(strings.TrimPrefix(changeType.String(), "CHANGE_TYPE_"))
+}
@@ -0,0 +1,65 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/broker"
+)
+
+const instrumentationName = "github.com/Karzoug/meower-user-service/internal/delivery/kafka"
+
+// headerCarrier adapts kafka message headers to the propagation carrier.
+type headerCarrier struct {
+	msg *broker.Message
+}
+
+var _ propagation.TextMapCarrier = headerCarrier{}
+
+func (c headerCarrier) Get(key string) string {
+	v, _ := c.msg.Header(key)
+	return string(v)
+}
+
+func (c headerCarrier) Set(key, value string) {
+	for i := range c.msg.Headers {
+		if c.msg.Headers[i].Key == key {
+			c.msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.msg.Headers = append(c.msg.Headers, broker.Header{Key: key, Value: []byte(value)})
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, len(c.msg.Headers))
+	for i := range c.msg.Headers {
+		keys[i] = c.msg.Headers[i].Key
+	}
+	return keys
+}
+
+// startProcessSpan extracts W3C trace context and baggage from the message headers
+// and starts a span of the message processing as a child of the producer span.
+func startProcessSpan(ctx context.Context, tracer trace.Tracer, groupID string, msg *broker.Message) (context.Context, trace.Span) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, headerCarrier{msg: msg})
+
+	return tracer.Start(ctx, msg.Topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypeDeliver,
+			semconv.MessagingOperationName("process"),
+			semconv.MessagingDestinationName(msg.Topic),
+			semconv.MessagingDestinationPartitionID(strconv.Itoa(int(msg.Partition))),
+			semconv.MessagingKafkaConsumerGroup(groupID),
+			semconv.MessagingKafkaMessageKey(string(msg.Key)),
+			semconv.MessagingKafkaMessageOffset(int(msg.Offset)),
+			semconv.MessagingMessageBodySize(len(msg.Value)),
+		))
+}
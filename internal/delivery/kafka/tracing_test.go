@@ -0,0 +1,46 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/broker"
+)
+
+func TestStartProcessSpan(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+
+	msg := &broker.Message{
+		Topic: "auth",
+		Headers: []broker.Header{
+			{Key: "traceparent", Value: []byte("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")},
+			{Key: "baggage", Value: []byte("user_agent=auth")},
+		},
+	}
+
+	ctx, span := startProcessSpan(context.Background(), tracer, "user-service", msg)
+	defer span.End()
+
+	if got, want := span.SpanContext().TraceID().String(), "4bf92f3577b34da6a3ce929d0e0e4736"; got != want {
+		t.Errorf("trace id = %s, want %s", got, want)
+	}
+	if got := span.(sdktrace.ReadOnlySpan).Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent span id = %s, want %s", got, "00f067aa0ba902b7")
+	}
+	if got := span.(sdktrace.ReadOnlySpan).SpanKind(); got != trace.SpanKindConsumer {
+		t.Errorf("span kind = %v, want %v", got, trace.SpanKindConsumer)
+	}
+	if got := baggage.FromContext(ctx).Member("user_agent").Value(); got != "auth" {
+		t.Errorf("baggage user_agent = %q, want %q", got, "auth")
+	}
+}
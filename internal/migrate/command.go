@@ -0,0 +1,73 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/caarlos0/env/v11"
+	"github.com/rs/zerolog"
+
+	"github.com/Karzoug/meower-common-go/postgresql"
+)
+
+const usage = "usage: migrate up|down|status|version"
+
+var ErrUsage = errors.New(usage)
+
+type commandConfig struct {
+	PG      postgresql.Config `envPrefix:"PG_"`
+	Migrate Config            `envPrefix:"MIGRATE_"`
+}
+
+// RunCommand runs the migrate subcommand with the config from environment variables,
+// args are the subcommand arguments.
+func RunCommand(ctx context.Context, args []string, out io.Writer, logger zerolog.Logger) error {
+	if len(args) != 1 {
+		return ErrUsage
+	}
+
+	cfg, err := env.ParseAs[commandConfig]()
+	if err != nil {
+		return err
+	}
+
+	mg, err := New(cfg.Migrate, cfg.PG.URI, logger)
+	if err != nil {
+		return err
+	}
+	defer mg.Close(ctx) //nolint:errcheck
+
+	switch args[0] {
+	case "up":
+		return mg.Up(ctx)
+	case "down":
+		return mg.Down(ctx)
+	case "status":
+		s, err := mg.Status()
+		if err != nil {
+			return err
+		}
+
+		state := "up to date"
+		switch {
+		case s.Dirty:
+			state = "dirty"
+		case s.Pending():
+			state = "pending migrations"
+		}
+		_, err = fmt.Fprintf(out, "version: %d\nlatest: %d\nstate: %s\n", s.Version, s.Latest, state)
+		return err
+	case "version":
+		s, err := mg.Status()
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintln(out, s.Version)
+		return err
+	default:
+		return ErrUsage
+	}
+}
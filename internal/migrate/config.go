@@ -0,0 +1,8 @@
+package migrate
+
+type Config struct {
+	// Auto applies pending migrations on start, replicas wait for each other by the advisory lock
+	Auto bool `env:"AUTO" envDefault:"false"`
+	// LockTimeoutSeconds is a time to wait for the advisory lock held by another replica
+	LockTimeoutSeconds int `env:"LOCK_TIMEOUT_SECONDS" envDefault:"60"`
+}
@@ -0,0 +1,197 @@
+// Package migrate applies the database migrations embedded into the binary.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	pgxMigrate "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/rs/zerolog"
+
+	"github.com/Karzoug/meower-user-service/migrations"
+)
+
+// ErrSchemaBehind means that the database schema is older than the binary expects.
+var ErrSchemaBehind = errors.New("database schema is behind")
+
+// Status is a state of the database schema.
+type Status struct {
+	// Version is a version of the last applied migration, it is zero if none is applied
+	Version uint
+	// Dirty means that the last migration failed and the schema must be fixed manually
+	Dirty bool
+	// Latest is a version of the last migration embedded into the binary
+	Latest uint
+}
+
+// Pending reports whether there are migrations to apply.
+func (s Status) Pending() bool {
+	return s.Version < s.Latest
+}
+
+// Migrator applies the embedded migrations. The database driver holds a Postgres
+// advisory lock while migrating, so concurrent replicas never apply migrations at the same time.
+type Migrator struct {
+	m      *migrate.Migrate
+	latest uint
+}
+
+func New(cfg Config, uri string, logger zerolog.Logger) (Migrator, error) {
+	const op = "migrate: new migrator"
+
+	connCfg, err := pgx.ParseConfig(uri)
+	if err != nil {
+		return Migrator{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	src, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		return Migrator{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	latest, err := latestVersion(src)
+	if err != nil {
+		return Migrator{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	db := stdlib.OpenDB(*connCfg)
+	drv, err := pgxMigrate.WithInstance(db, &pgxMigrate.Config{})
+	if err != nil {
+		_ = db.Close()
+		return Migrator{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", src, "pgx5", drv)
+	if err != nil {
+		_ = drv.Close()
+		return Migrator{}, fmt.Errorf("%s: %w", op, err)
+	}
+	m.LockTimeout = time.Duration(cfg.LockTimeoutSeconds) * time.Second
+	m.Log = migrateLogger{logger: logger.With().Str("component", "migrate").Logger()}
+
+	return Migrator{
+		m:      m,
+		latest: latest,
+	}, nil
+}
+
+// Up applies all pending migrations.
+func (mg Migrator) Up(ctx context.Context) error {
+	const op = "migrate: up"
+
+	if err := mg.run(ctx, mg.m.Up); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Down rolls back the last applied migration.
+func (mg Migrator) Down(ctx context.Context) error {
+	const op = "migrate: down"
+
+	if err := mg.run(ctx, func() error { return mg.m.Steps(-1) }); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// run runs fn and stops it at a safe point when the context is done.
+func (mg Migrator) run(ctx context.Context, fn func() error) error {
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			mg.m.GracefulStop <- true
+		case <-done:
+		}
+	}()
+
+	if err := fn(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+
+	return ctx.Err()
+}
+
+func (mg Migrator) Status() (Status, error) {
+	const op = "migrate: status"
+
+	version, dirty, err := mg.m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return Status{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return Status{
+		Version: version,
+		Dirty:   dirty,
+		Latest:  mg.latest,
+	}, nil
+}
+
+// Check returns ErrSchemaBehind if the schema is dirty or older than the embedded migrations.
+// A newer schema is fine: it is expected while a newer version of the service is rolled out.
+func (mg Migrator) Check() error {
+	const op = "migrate: check"
+
+	s, err := mg.Status()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	switch {
+	case s.Dirty:
+		return fmt.Errorf("%s: %w: version %d is dirty", op, ErrSchemaBehind, s.Version)
+	case s.Pending():
+		return fmt.Errorf("%s: %w: version %d, expected %d", op, ErrSchemaBehind, s.Version, s.Latest)
+	}
+
+	return nil
+}
+
+func (mg Migrator) Close(_ context.Context) error {
+	srcErr, dbErr := mg.m.Close()
+	return errors.Join(srcErr, dbErr)
+}
+
+func latestVersion(src source.Driver) (uint, error) {
+	version, err := src.First()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
+
+type migrateLogger struct {
+	logger zerolog.Logger
+}
+
+func (l migrateLogger) Printf(format string, v ...any) {
+	l.logger.Info().Msg(strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
+
+func (l migrateLogger) Verbose() bool {
+	return l.logger.GetLevel() <= zerolog.DebugLevel
+}
@@ -0,0 +1,41 @@
+package migrate
+
+import (
+	"io/fs"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+
+	"github.com/Karzoug/meower-user-service/migrations"
+)
+
+func TestLatestVersion(t *testing.T) {
+	names, err := fs.Glob(migrations.FS, "*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want uint
+	for _, name := range names {
+		v, err := strconv.ParseUint(strings.SplitN(name, "_", 2)[0], 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = max(want, uint(v))
+	}
+
+	src, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := latestVersion(src)
+	if err != nil {
+		t.Fatalf("latestVersion() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("latestVersion() = %d, want %d", got, want)
+	}
+}
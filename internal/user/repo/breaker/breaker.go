@@ -0,0 +1,67 @@
+// Package breaker wraps the cache and the repository in circuit breakers.
+package breaker
+
+import (
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/sony/gobreaker"
+)
+
+// Breaker is a circuit breaker of a service dependency.
+type Breaker struct {
+	cb           *gobreaker.TwoStepCircuitBreaker
+	isSuccessful func(err error) bool
+}
+
+func newBreaker(name string, cfg Config, isSuccessful func(err error) bool, logger zerolog.Logger) *Breaker {
+	logger = logger.With().
+		Str("component", "circuit breaker").
+		Str("name", name).
+		Logger()
+
+	b := &Breaker{
+		cb: gobreaker.NewTwoStepCircuitBreaker(gobreaker.Settings{
+			Name:        name,
+			MaxRequests: cfg.HalfOpenRequests,
+			Timeout:     time.Duration(cfg.OpenTimeoutSeconds) * time.Second,
+			ReadyToTrip: func(counts gobreaker.Counts) bool {
+				return counts.ConsecutiveFailures >= cfg.FailureThreshold
+			},
+			OnStateChange: func(_ string, from, to gobreaker.State) {
+				logger.Warn().
+					Str("from", from.String()).
+					Str("to", to.String()).
+					Msg("state changed")
+			},
+		}),
+		isSuccessful: isSuccessful,
+	}
+	registerMetrics(b)
+
+	return b
+}
+
+// Name returns a name of the dependency.
+func (b *Breaker) Name() string {
+	return b.cb.Name()
+}
+
+// Available reports whether the breaker lets requests through.
+func (b *Breaker) Available() bool {
+	return b.cb.State() != gobreaker.StateOpen
+}
+
+// allow returns a function to report the result of the request,
+// or false if the breaker rejects the request.
+func (b *Breaker) allow() (func(err error) error, bool) {
+	done, err := b.cb.Allow()
+	if err != nil {
+		return nil, false
+	}
+
+	return func(err error) error {
+		done(b.isSuccessful(err))
+		return err
+	}, true
+}
@@ -0,0 +1,149 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+
+	"github.com/Karzoug/meower-user-service/internal/user/entity"
+	"github.com/Karzoug/meower-user-service/internal/user/repo"
+	"github.com/Karzoug/meower-user-service/internal/user/repo/lru"
+)
+
+const cacheName = "cache"
+
+type cache struct {
+	*Breaker
+	next lru.Cache
+}
+
+// NewUserCache wraps the cache in a circuit breaker. While the breaker is open,
+// reads are misses and sets are skipped without calls to the cache.
+// Deletes are always passed to the cache: a lost invalidation leaves a stale entry.
+func NewUserCache(cfg Config, next lru.Cache, logger zerolog.Logger) cache {
+	return cache{
+		Breaker: newBreaker(cacheName, cfg, isCacheSuccessful, logger),
+		next:    next,
+	}
+}
+
+func (c cache) GetOne(ctx context.Context, id xid.ID) (entity.UserShortProjection, error) {
+	done, ok := c.allow()
+	if !ok {
+		return entity.UserShortProjection{}, repo.ErrRecordNotFound
+	}
+
+	u, err := c.next.GetOne(ctx, id)
+	return u, done(err)
+}
+
+func (c cache) GetOneWithExpiration(ctx context.Context, id xid.ID) (entity.UserShortProjection, time.Time, error) {
+	done, ok := c.allow()
+	if !ok {
+		return entity.UserShortProjection{}, time.Time{}, repo.ErrRecordNotFound
+	}
+
+	u, expiresAt, err := c.next.GetOneWithExpiration(ctx, id)
+	return u, expiresAt, done(err)
+}
+
+func (c cache) GetMany(ctx context.Context, ids []xid.ID) (users []entity.UserShortProjection, missed []xid.ID, err error) {
+	done, ok := c.allow()
+	if !ok {
+		return []entity.UserShortProjection{}, ids, nil
+	}
+
+	users, missed, err = c.next.GetMany(ctx, ids)
+	return users, missed, done(err)
+}
+
+func (c cache) Set(ctx context.Context, id xid.ID, u entity.UserShortProjection, ttl int32) error {
+	done, ok := c.allow()
+	if !ok {
+		return nil
+	}
+
+	return done(c.next.Set(ctx, id, u, ttl))
+}
+
+func (c cache) SetMany(ctx context.Context, users []entity.UserShortProjection, ttl int32) error {
+	done, ok := c.allow()
+	if !ok {
+		return nil
+	}
+
+	return done(c.next.SetMany(ctx, users, ttl))
+}
+
+func (c cache) Delete(ctx context.Context, id xid.ID) error {
+	return c.next.Delete(ctx, id)
+}
+
+func (c cache) SetNotFound(ctx context.Context, id xid.ID, ttl int32) error {
+	return c.next.SetNotFound(ctx, id, ttl)
+}
+
+func (c cache) GetUser(ctx context.Context, id xid.ID) (entity.User, error) {
+	done, ok := c.allow()
+	if !ok {
+		return entity.User{}, repo.ErrRecordNotFound
+	}
+
+	u, err := c.next.GetUser(ctx, id)
+	return u, done(err)
+}
+
+func (c cache) SetUser(ctx context.Context, u entity.User, ttl int32) error {
+	done, ok := c.allow()
+	if !ok {
+		return nil
+	}
+
+	return done(c.next.SetUser(ctx, u, ttl))
+}
+
+func (c cache) DeleteUser(ctx context.Context, id xid.ID) error {
+	return c.next.DeleteUser(ctx, id)
+}
+
+func (c cache) GetIDByUsername(ctx context.Context, username string) (xid.ID, error) {
+	done, ok := c.allow()
+	if !ok {
+		return xid.NilID(), repo.ErrRecordNotFound
+	}
+
+	id, err := c.next.GetIDByUsername(ctx, username)
+	return id, done(err)
+}
+
+func (c cache) GetManyIDsByUsernames(ctx context.Context, usernames []string) (ids map[string]xid.ID, missed []string, err error) {
+	done, ok := c.allow()
+	if !ok {
+		return map[string]xid.ID{}, usernames, nil
+	}
+
+	ids, missed, err = c.next.GetManyIDsByUsernames(ctx, usernames)
+	return ids, missed, done(err)
+}
+
+func (c cache) SetIDByUsername(ctx context.Context, username string, id xid.ID, ttl int32) error {
+	done, ok := c.allow()
+	if !ok {
+		return nil
+	}
+
+	return done(c.next.SetIDByUsername(ctx, username, id, ttl))
+}
+
+func (c cache) DeleteIDByUsername(ctx context.Context, username string) error {
+	return c.next.DeleteIDByUsername(ctx, username)
+}
+
+func isCacheSuccessful(err error) bool {
+	return err == nil ||
+		errors.Is(err, repo.ErrRecordNotFound) ||
+		errors.Is(err, repo.ErrRecordNotFoundCached)
+}
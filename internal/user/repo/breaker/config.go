@@ -0,0 +1,11 @@
+package breaker
+
+type Config struct {
+	// FailureThreshold is a number of consecutive failures that opens the breaker
+	FailureThreshold uint32 `env:"FAILURE_THRESHOLD" envDefault:"5"`
+	// OpenTimeoutSeconds is a time the breaker stays open before it lets probe requests through
+	OpenTimeoutSeconds int `env:"OPEN_TIMEOUT_SECONDS" envDefault:"10"`
+	// HalfOpenRequests is a number of probe requests allowed in the half-open state,
+	// the breaker is closed again if all of them succeed
+	HalfOpenRequests uint32 `env:"HALF_OPEN_REQUESTS" envDefault:"1"`
+}
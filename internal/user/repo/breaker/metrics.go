@@ -0,0 +1,39 @@
+package breaker
+
+import (
+	"context"
+
+	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const meterName = "github.com/Karzoug/meower-user-service/internal/user/repo/breaker"
+
+// registerMetrics reports the breaker state: 0 is closed, 1 is half-open, 2 is open.
+func registerMetrics(b *Breaker) {
+	meter := otel.GetMeterProvider().Meter(meterName)
+
+	_, err := meter.Int64ObservableGauge("circuit_breaker.state",
+		metric.WithDescription("State of the circuit breaker: 0 is closed, 1 is half-open, 2 is open."),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(stateValue(b.cb.State()), metric.WithAttributes(attribute.String("name", b.Name())))
+			return nil
+		}),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+}
+
+func stateValue(s gobreaker.State) int64 {
+	switch s {
+	case gobreaker.StateHalfOpen:
+		return 1
+	case gobreaker.StateOpen:
+		return 2
+	default:
+		return 0
+	}
+}
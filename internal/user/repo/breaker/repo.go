@@ -0,0 +1,171 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+
+	"github.com/Karzoug/meower-user-service/internal/user/entity"
+	"github.com/Karzoug/meower-user-service/internal/user/repo"
+)
+
+const repoName = "postgres"
+
+// Repository is a user repository wrapped by the circuit breaker.
+type Repository interface {
+	Create(ctx context.Context, user entity.User) (xid.ID, error)
+	GetOne(ctx context.Context, id xid.ID) (entity.User, error)
+	GetOneShortProjection(ctx context.Context, id xid.ID) (entity.UserShortProjection, error)
+	GetOneShortProjectionByUsername(ctx context.Context, username string) (entity.UserShortProjection, error)
+	GetManyShortProjections(ctx context.Context, ids []xid.ID) ([]entity.UserShortProjection, error)
+	GetManyShortProjectionsByUsernames(ctx context.Context, usernames []string) ([]entity.UserShortProjection, error)
+	Update(ctx context.Context, u entity.User) (time.Time, error)
+	UpdateUsername(ctx context.Context, username, newUsername string) (xid.ID, error)
+	DeleteByUsername(ctx context.Context, username string) (xid.ID, error)
+	ForEachRecentShortProjections(ctx context.Context, limit, batchSize int, fn func([]entity.UserShortProjection) error) error
+}
+
+type userRepo struct {
+	*Breaker
+	next Repository
+}
+
+// NewUserRepo wraps the repository in a circuit breaker.
+// While the breaker is open, calls fail fast with repo.ErrUnavailable.
+func NewUserRepo(cfg Config, next Repository, logger zerolog.Logger) userRepo {
+	return userRepo{
+		Breaker: newBreaker(repoName, cfg, isRepoSuccessful, logger),
+		next:    next,
+	}
+}
+
+func (r userRepo) Create(ctx context.Context, user entity.User) (xid.ID, error) {
+	done, ok := r.allow()
+	if !ok {
+		return xid.NilID(), errUnavailable
+	}
+
+	id, err := r.next.Create(ctx, user)
+	return id, done(err)
+}
+
+func (r userRepo) GetOne(ctx context.Context, id xid.ID) (entity.User, error) {
+	done, ok := r.allow()
+	if !ok {
+		return entity.User{}, errUnavailable
+	}
+
+	u, err := r.next.GetOne(ctx, id)
+	return u, done(err)
+}
+
+func (r userRepo) GetOneShortProjection(ctx context.Context, id xid.ID) (entity.UserShortProjection, error) {
+	done, ok := r.allow()
+	if !ok {
+		return entity.UserShortProjection{}, errUnavailable
+	}
+
+	u, err := r.next.GetOneShortProjection(ctx, id)
+	return u, done(err)
+}
+
+func (r userRepo) GetOneShortProjectionByUsername(ctx context.Context, username string) (entity.UserShortProjection, error) {
+	done, ok := r.allow()
+	if !ok {
+		return entity.UserShortProjection{}, errUnavailable
+	}
+
+	u, err := r.next.GetOneShortProjectionByUsername(ctx, username)
+	return u, done(err)
+}
+
+func (r userRepo) GetManyShortProjections(ctx context.Context, ids []xid.ID) ([]entity.UserShortProjection, error) {
+	done, ok := r.allow()
+	if !ok {
+		return nil, errUnavailable
+	}
+
+	users, err := r.next.GetManyShortProjections(ctx, ids)
+	return users, done(err)
+}
+
+func (r userRepo) GetManyShortProjectionsByUsernames(ctx context.Context, usernames []string) ([]entity.UserShortProjection, error) {
+	done, ok := r.allow()
+	if !ok {
+		return nil, errUnavailable
+	}
+
+	users, err := r.next.GetManyShortProjectionsByUsernames(ctx, usernames)
+	return users, done(err)
+}
+
+func (r userRepo) Update(ctx context.Context, u entity.User) (time.Time, error) {
+	done, ok := r.allow()
+	if !ok {
+		return time.Time{}, errUnavailable
+	}
+
+	updatedAt, err := r.next.Update(ctx, u)
+	return updatedAt, done(err)
+}
+
+func (r userRepo) UpdateUsername(ctx context.Context, username, newUsername string) (xid.ID, error) {
+	done, ok := r.allow()
+	if !ok {
+		return xid.NilID(), errUnavailable
+	}
+
+	id, err := r.next.UpdateUsername(ctx, username, newUsername)
+	return id, done(err)
+}
+
+func (r userRepo) DeleteByUsername(ctx context.Context, username string) (xid.ID, error) {
+	done, ok := r.allow()
+	if !ok {
+		return xid.NilID(), errUnavailable
+	}
+
+	id, err := r.next.DeleteByUsername(ctx, username)
+	return id, done(err)
+}
+
+func (r userRepo) ForEachRecentShortProjections(ctx context.Context,
+	limit, batchSize int,
+	fn func([]entity.UserShortProjection) error,
+) error {
+	done, ok := r.allow()
+	if !ok {
+		return errUnavailable
+	}
+
+	var fnErr error
+	err := r.next.ForEachRecentShortProjections(ctx, limit, batchSize,
+		func(users []entity.UserShortProjection) error {
+			fnErr = fn(users)
+			return fnErr
+		})
+	// only errors of the database count: fn fails by its own dependencies
+	// and the stream may be stopped by the caller, e.g. when its time budget is over
+	if fnErr != nil || ctx.Err() != nil {
+		done(nil)
+		return err
+	}
+
+	return done(err)
+}
+
+var errUnavailable = fmt.Errorf("%s circuit breaker is open: %w", repoName, repo.ErrUnavailable)
+
+// isRepoSuccessful reports whether the error is not a failure of the database:
+// expected errors and requests canceled by the caller do not open the breaker.
+func isRepoSuccessful(err error) bool {
+	return err == nil ||
+		errors.Is(err, repo.ErrRecordNotFound) ||
+		errors.Is(err, repo.ErrRecordAlreadyExists) ||
+		errors.Is(err, repo.ErrNoAffected) ||
+		errors.Is(err, context.Canceled)
+}
@@ -0,0 +1,79 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Karzoug/meower-user-service/internal/user/entity"
+)
+
+// streamRepo streams one batch of users and fails with err if it is set.
+type streamRepo struct {
+	Repository
+	err error
+}
+
+func (r streamRepo) ForEachRecentShortProjections(ctx context.Context,
+	_, _ int,
+	fn func([]entity.UserShortProjection) error,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if r.err != nil {
+		return r.err
+	}
+	return fn([]entity.UserShortProjection{{}})
+}
+
+func TestUserRepoForEachRecentShortProjections(t *testing.T) {
+	errDB := errors.New("connection refused")
+	errFn := errors.New("cache is unavailable")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		repoErr  error
+		fnErr    error
+		wantOpen bool
+	}{
+		{
+			name:  "fn errors",
+			ctx:   context.Background(),
+			fnErr: errFn,
+		},
+		{
+			name: "stopped by caller",
+			ctx:  canceled,
+		},
+		{
+			name:     "database errors",
+			ctx:      context.Background(),
+			repoErr:  errDB,
+			wantOpen: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewUserRepo(Config{FailureThreshold: 3, OpenTimeoutSeconds: 60, HalfOpenRequests: 1},
+				streamRepo{err: tt.repoErr}, zerolog.Nop())
+
+			for range 3 {
+				err := r.ForEachRecentShortProjections(tt.ctx, 10, 10,
+					func([]entity.UserShortProjection) error { return tt.fnErr })
+				if err == nil {
+					t.Fatal("ForEachRecentShortProjections() error = nil, want error")
+				}
+			}
+
+			if got := !r.Available(); got != tt.wantOpen {
+				t.Errorf("breaker is open = %t, want %t", got, tt.wantOpen)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+// Package codec encodes users and user short projections for shared caches
+// and builds the keys of them, so all cache backends share the same keys.
+package codec
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rs/xid"
+	"golang.org/x/text/unicode/norm"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/Karzoug/meower-user-service/internal/user/entity"
+)
+
+// SchemaVersion is a version of the user short projection encoding:
+// it is the first byte of the value and a part of the key,
+// so replicas with different versions never read entries of each other by mistake.
+const SchemaVersion byte = 1
+
+// Field numbers of the user protobuf message,
+// the user short projection message is the user message without the last fields.
+const (
+	fieldID protowire.Number = iota + 1
+	fieldUsername
+	fieldName
+	fieldImageURL
+	fieldStatusText
+	fieldUpdatedAt
+)
+
+var (
+	keyPrefix     = "usp:v" + strconv.Itoa(int(SchemaVersion)) + ":"
+	userKeyPrefix = "u:v" + strconv.Itoa(int(SchemaVersion)) + ":"
+
+	usernameKeyPrefix = "username:"
+
+	ErrUnknownSchemaVersion = errors.New("unknown schema version")
+)
+
+// Key returns a cache key of the user short projection with the current schema version.
+func Key(id xid.ID) string {
+	return keyPrefix + id.String()
+}
+
+// UserKey returns a cache key of the user with the current schema version.
+func UserKey(id xid.ID) string {
+	return userKeyPrefix + id.String()
+}
+
+// UsernameKey returns a cache key of the username index entry. Keys of some caches can't contain
+// spaces or control characters and are limited to 250 bytes, so the key is the hash of the username
+// in the NFC form. The case is kept: usernames are case sensitive in the database.
+// Different usernames that have the same NFC form share the entry: the service checks
+// the username of the user found by the id.
+func UsernameKey(username string) string {
+	sum := sha256.Sum256([]byte(norm.NFC.String(username)))
+	return usernameKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+// LegacyKey is a key of gob encoded entries set before schema versioning.
+func LegacyKey(id xid.ID) string {
+	return id.String()
+}
+
+// Encode encodes the user short projection as the schema version byte
+// followed by the protobuf message.
+func Encode(u entity.UserShortProjection) []byte {
+	b := make([]byte, 0, 1+2+len(u.ID)+
+		2+len(u.Username)+2+len(u.Name)+2+len(u.ImageURL)+2+len(u.StatusText))
+
+	b = append(b, SchemaVersion)
+	b = protowire.AppendTag(b, fieldID, protowire.BytesType)
+	b = protowire.AppendBytes(b, u.ID.Bytes())
+	b = appendString(b, fieldUsername, u.Username)
+	b = appendString(b, fieldName, u.Name)
+	b = appendString(b, fieldImageURL, u.ImageURL)
+	b = appendString(b, fieldStatusText, u.StatusText)
+
+	return b
+}
+
+// EncodeUser encodes the user as the user short projection
+// followed by the update time in microseconds.
+func EncodeUser(u entity.User) []byte {
+	b := Encode(u.UserShortProjection)
+	b = protowire.AppendTag(b, fieldUpdatedAt, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(u.UpdatedAt.UnixMicro())) //nolint:gosec
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// Decode decodes the user short projection encoded by Encode.
+// Unknown fields are skipped, so a field may be added without a new schema version.
+func Decode(b []byte) (entity.UserShortProjection, error) {
+	u, err := DecodeUser(b)
+	if err != nil {
+		return entity.UserShortProjection{}, err
+	}
+
+	return u.UserShortProjection, nil
+}
+
+// DecodeUser decodes the user encoded by EncodeUser.
+func DecodeUser(b []byte) (entity.User, error) {
+	if len(b) == 0 || b[0] != SchemaVersion {
+		return entity.User{}, ErrUnknownSchemaVersion
+	}
+	b = b[1:]
+
+	var u entity.User
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return entity.User{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch {
+		case typ == protowire.VarintType && num == fieldUpdatedAt:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return entity.User{}, protowire.ParseError(n)
+			}
+			b = b[n:]
+
+			u.UpdatedAt = time.UnixMicro(int64(v)).UTC() //nolint:gosec
+			continue
+		case typ != protowire.BytesType:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return entity.User{}, protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return entity.User{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch num {
+		case fieldID:
+			id, err := xid.FromBytes(v)
+			if err != nil {
+				return entity.User{}, fmt.Errorf("invalid id: %w", err)
+			}
+			u.ID = id
+		case fieldUsername:
+			u.Username = string(v)
+		case fieldName:
+			u.Name = string(v)
+		case fieldImageURL:
+			u.ImageURL = string(v)
+		case fieldStatusText:
+			u.StatusText = string(v)
+		}
+	}
+
+	return u, nil
+}
+
+// DecodeLegacy decodes gob encoded entries set before schema versioning.
+func DecodeLegacy(b []byte) (entity.UserShortProjection, error) {
+	var u entity.UserShortProjection
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&u); err != nil {
+		return entity.UserShortProjection{}, err
+	}
+
+	return u, nil
+}
@@ -0,0 +1,201 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+
+	"github.com/Karzoug/meower-user-service/internal/user/entity"
+)
+
+func testShortProjection() entity.UserShortProjection {
+	return entity.UserShortProjection{
+		ID:         xid.New(),
+		Username:   "alice",
+		Name:       "Alice Liddell",
+		ImageURL:   "https://example.com/images/alice.png",
+		StatusText: "down the rabbit hole",
+	}
+}
+
+func encodeLegacyShortProjection(tb testing.TB, u entity.UserShortProjection) []byte {
+	tb.Helper()
+
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(u); err != nil {
+		tb.Fatal(err)
+	}
+
+	return b.Bytes()
+}
+
+func TestCodec(t *testing.T) {
+	tests := []struct {
+		name string
+		user entity.UserShortProjection
+	}{
+		{name: "all fields", user: testShortProjection()},
+		{name: "empty optional fields", user: entity.UserShortProjection{ID: xid.New(), Username: "bob", Name: "bob"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Encode(tt.user)
+			if b[0] != SchemaVersion {
+				t.Fatalf("first byte = %d, want schema version %d", b[0], SchemaVersion)
+			}
+
+			got, err := Decode(b)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if got != tt.user {
+				t.Errorf("decode = %+v, want %+v", got, tt.user)
+			}
+		})
+	}
+}
+
+func TestUserCodec(t *testing.T) {
+	u := entity.User{
+		UserShortProjection: testShortProjection(),
+		UpdatedAt:           time.Now().UTC().Truncate(time.Microsecond),
+	}
+
+	got, err := DecodeUser(EncodeUser(u))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.UserShortProjection != u.UserShortProjection || !got.UpdatedAt.Equal(u.UpdatedAt) {
+		t.Errorf("decode = %+v, want %+v", got, u)
+	}
+
+	// the user short projection decoder skips the update time
+	short, err := Decode(EncodeUser(u))
+	if err != nil {
+		t.Fatalf("decode short projection: %v", err)
+	}
+	if short != u.UserShortProjection {
+		t.Errorf("decode short projection = %+v, want %+v", short, u.UserShortProjection)
+	}
+}
+
+func TestDecodeUnknownSchemaVersion(t *testing.T) {
+	b := Encode(testShortProjection())
+	b[0] = SchemaVersion + 1
+
+	if _, err := Decode(b); err == nil {
+		t.Error("decode of unknown schema version: want error")
+	}
+}
+
+func TestDecodeLegacy(t *testing.T) {
+	u := testShortProjection()
+
+	got, err := DecodeLegacy(encodeLegacyShortProjection(t, u))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got != u {
+		t.Errorf("decode = %+v, want %+v", got, u)
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	u := testShortProjection()
+
+	b.Run("gob", func(b *testing.B) {
+		b.ReportAllocs()
+		var size int
+		for range b.N {
+			size = len(encodeLegacyShortProjection(b, u))
+		}
+		b.ReportMetric(float64(size), "bytes/value")
+	})
+	b.Run("proto", func(b *testing.B) {
+		b.ReportAllocs()
+		var size int
+		for range b.N {
+			size = len(Encode(u))
+		}
+		b.ReportMetric(float64(size), "bytes/value")
+	})
+}
+
+func BenchmarkDecode(b *testing.B) {
+	u := testShortProjection()
+
+	b.Run("gob", func(b *testing.B) {
+		v := encodeLegacyShortProjection(b, u)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for range b.N {
+			if _, err := DecodeLegacy(v); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("proto", func(b *testing.B) {
+		v := Encode(u)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for range b.N {
+			if _, err := Decode(v); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestUsernameKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+	}{
+		{
+			name:     "plain",
+			username: "gopher",
+		},
+		{
+			name:     "with space",
+			username: "go pher",
+		},
+		{
+			name:     "with control characters",
+			username: "go\r\npher\x00",
+		},
+		{
+			name:     "longer than key limit",
+			username: strings.Repeat("гофер", 30),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := UsernameKey(tt.username)
+
+			if len(key) > 250 {
+				t.Errorf("UsernameKey() length = %d, want at most 250", len(key))
+			}
+			for _, r := range key {
+				if r <= ' ' || r >= 0x7f {
+					t.Fatalf("UsernameKey() = %q has illegal character %q", key, r)
+				}
+			}
+		})
+	}
+
+	// the same username in other normal form has the same key
+	if UsernameKey("Cafe\u0301") != UsernameKey("Caf\u00e9") {
+		t.Error("UsernameKey() differs for canonically equal usernames")
+	}
+	// usernames are case sensitive
+	if UsernameKey("Alice") == UsernameKey("alice") {
+		t.Error("UsernameKey() is the same for usernames in different case")
+	}
+	if UsernameKey("go pher") == UsernameKey("gopher") {
+		t.Error("UsernameKey() is the same for different usernames")
+	}
+}
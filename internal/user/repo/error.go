@@ -6,4 +6,8 @@ var (
 	ErrNoAffected          = errors.New("no affected")
 	ErrRecordAlreadyExists = errors.New("record already exists")
 	ErrRecordNotFound      = errors.New("record not found")
+	// ErrRecordNotFoundCached means that the cache knows the record does not exist.
+	ErrRecordNotFoundCached = errors.New("record not found (cached)")
+	// ErrUnavailable means that the storage is known to be unavailable and was not called.
+	ErrUnavailable = errors.New("unavailable")
 )
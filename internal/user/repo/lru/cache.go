@@ -0,0 +1,182 @@
+package lru
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/rs/xid"
+
+	"github.com/Karzoug/meower-user-service/internal/user/entity"
+	"github.com/Karzoug/meower-user-service/internal/user/repo"
+)
+
+// Cache is a shared short projections cache wrapped by the in-process tier.
+type Cache interface {
+	GetOne(ctx context.Context, id xid.ID) (entity.UserShortProjection, error)
+	GetOneWithExpiration(ctx context.Context, id xid.ID) (u entity.UserShortProjection, expiresAt time.Time, err error)
+	GetMany(ctx context.Context, ids []xid.ID) (users []entity.UserShortProjection, missed []xid.ID, err error)
+	Set(ctx context.Context, id xid.ID, u entity.UserShortProjection, ttl int32) error
+	SetMany(ctx context.Context, users []entity.UserShortProjection, ttl int32) error
+	Delete(ctx context.Context, id xid.ID) error
+	SetNotFound(ctx context.Context, id xid.ID, ttl int32) error
+	GetUser(ctx context.Context, id xid.ID) (entity.User, error)
+	SetUser(ctx context.Context, u entity.User, ttl int32) error
+	DeleteUser(ctx context.Context, id xid.ID) error
+	GetIDByUsername(ctx context.Context, username string) (xid.ID, error)
+	GetManyIDsByUsernames(ctx context.Context, usernames []string) (ids map[string]xid.ID, missed []string, err error)
+	SetIDByUsername(ctx context.Context, username string, id xid.ID, ttl int32) error
+	DeleteIDByUsername(ctx context.Context, username string) error
+}
+
+type cache struct {
+	local   *expirable.LRU[xid.ID, entity.UserShortProjection]
+	next    Cache
+	metrics metrics
+}
+
+// NewUserCache creates a two-tier cache: a size-bounded in-process LRU in front of the next cache.
+// Username index and full user methods are passed to the next cache as is.
+func NewUserCache(cfg Config, next Cache) cache {
+	return cache{
+		local:   expirable.NewLRU[xid.ID, entity.UserShortProjection](cfg.Size, nil, time.Duration(cfg.TTLSeconds)*time.Second),
+		next:    next,
+		metrics: newMetrics(),
+	}
+}
+
+func (c cache) GetOne(ctx context.Context, id xid.ID) (entity.UserShortProjection, error) {
+	if u, ok := c.local.Get(id); ok {
+		c.metrics.hit(tierLocal, 1)
+		return u, nil
+	}
+	c.metrics.miss(tierLocal, 1)
+
+	u, err := c.next.GetOne(ctx, id)
+	if err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			c.metrics.miss(tierRemote, 1)
+		}
+		return entity.UserShortProjection{}, err
+	}
+	c.metrics.hit(tierRemote, 1)
+
+	c.local.Add(id, u)
+
+	return u, nil
+}
+
+// GetOneWithExpiration returns the zero expiration for entries of the in-process tier:
+// they live shortly, so the expiration of the next cache is not tracked.
+func (c cache) GetOneWithExpiration(ctx context.Context, id xid.ID) (entity.UserShortProjection, time.Time, error) {
+	if u, ok := c.local.Get(id); ok {
+		c.metrics.hit(tierLocal, 1)
+		return u, time.Time{}, nil
+	}
+	c.metrics.miss(tierLocal, 1)
+
+	u, expiresAt, err := c.next.GetOneWithExpiration(ctx, id)
+	if err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			c.metrics.miss(tierRemote, 1)
+		}
+		return entity.UserShortProjection{}, time.Time{}, err
+	}
+	c.metrics.hit(tierRemote, 1)
+
+	c.local.Add(id, u)
+
+	return u, expiresAt, nil
+}
+
+func (c cache) GetMany(ctx context.Context, ids []xid.ID) (users []entity.UserShortProjection, missed []xid.ID, err error) {
+	users = make([]entity.UserShortProjection, 0, len(ids))
+	localMissed := make([]xid.ID, 0)
+	for _, id := range ids {
+		if u, ok := c.local.Get(id); ok {
+			users = append(users, u)
+		} else {
+			localMissed = append(localMissed, id)
+		}
+	}
+	c.metrics.hit(tierLocal, len(users))
+	c.metrics.miss(tierLocal, len(localMissed))
+
+	if len(localMissed) == 0 {
+		return users, localMissed, nil
+	}
+
+	remoteUsers, missed, err := c.next.GetMany(ctx, localMissed)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.metrics.hit(tierRemote, len(remoteUsers))
+	c.metrics.miss(tierRemote, len(missed))
+
+	for i := range remoteUsers {
+		c.local.Add(remoteUsers[i].ID, remoteUsers[i])
+	}
+
+	return append(users, remoteUsers...), missed, nil
+}
+
+func (c cache) Set(ctx context.Context, id xid.ID, u entity.UserShortProjection, ttl int32) error {
+	c.local.Add(id, u)
+
+	return c.next.Set(ctx, id, u, ttl)
+}
+
+func (c cache) SetMany(ctx context.Context, users []entity.UserShortProjection, ttl int32) error {
+	for i := range users {
+		c.local.Add(users[i].ID, users[i])
+	}
+
+	return c.next.SetMany(ctx, users, ttl)
+}
+
+func (c cache) Delete(ctx context.Context, id xid.ID) error {
+	c.local.Remove(id)
+
+	return c.next.Delete(ctx, id)
+}
+
+func (c cache) SetNotFound(ctx context.Context, id xid.ID, ttl int32) error {
+	c.local.Remove(id)
+
+	return c.next.SetNotFound(ctx, id, ttl)
+}
+
+// Invalidate removes the user short projection only from the in-process tier.
+// It is called on user change events emitted by any replica of the service.
+func (c cache) Invalidate(id xid.ID) {
+	c.local.Remove(id)
+}
+
+func (c cache) GetUser(ctx context.Context, id xid.ID) (entity.User, error) {
+	return c.next.GetUser(ctx, id)
+}
+
+func (c cache) SetUser(ctx context.Context, u entity.User, ttl int32) error {
+	return c.next.SetUser(ctx, u, ttl)
+}
+
+func (c cache) DeleteUser(ctx context.Context, id xid.ID) error {
+	return c.next.DeleteUser(ctx, id)
+}
+
+func (c cache) GetIDByUsername(ctx context.Context, username string) (xid.ID, error) {
+	return c.next.GetIDByUsername(ctx, username)
+}
+
+func (c cache) GetManyIDsByUsernames(ctx context.Context, usernames []string) (ids map[string]xid.ID, missed []string, err error) {
+	return c.next.GetManyIDsByUsernames(ctx, usernames)
+}
+
+func (c cache) SetIDByUsername(ctx context.Context, username string, id xid.ID, ttl int32) error {
+	return c.next.SetIDByUsername(ctx, username, id, ttl)
+}
+
+func (c cache) DeleteIDByUsername(ctx context.Context, username string) error {
+	return c.next.DeleteIDByUsername(ctx, username)
+}
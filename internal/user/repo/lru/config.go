@@ -0,0 +1,11 @@
+package lru
+
+type Config struct {
+	// Enabled turns on the in-process cache tier in front of the shared cache
+	Enabled bool `env:"ENABLED" envDefault:"false"`
+	// Size is a maximum number of user short projections kept in memory
+	Size int `env:"SIZE" envDefault:"10000"`
+	// TTLSeconds is a ttl of in-memory entries, it should be short
+	// because other replicas learn about changes only from user change events
+	TTLSeconds int `env:"TTL_SECONDS" envDefault:"5"`
+}
@@ -0,0 +1,58 @@
+package lru
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const meterName = "github.com/Karzoug/meower-user-service/internal/user/repo/lru"
+
+const (
+	tierLocal  = "local"
+	tierRemote = "remote"
+)
+
+type metrics struct {
+	hits   metric.Int64Counter
+	misses metric.Int64Counter
+}
+
+func newMetrics() metrics {
+	meter := otel.GetMeterProvider().Meter(meterName)
+
+	hits, err := meter.Int64Counter("short_projections_cache.hits",
+		metric.WithDescription("Number of user short projections found in the cache tier."),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	misses, err := meter.Int64Counter("short_projections_cache.misses",
+		metric.WithDescription("Number of user short projections not found in the cache tier."),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return metrics{
+		hits:   hits,
+		misses: misses,
+	}
+}
+
+func (m metrics) hit(tier string, n int) {
+	if n == 0 {
+		return
+	}
+	m.hits.Add(context.Background(), int64(n), metric.WithAttributes(attribute.String("tier", tier)))
+}
+
+func (m metrics) miss(tier string, n int) {
+	if n == 0 {
+		return
+	}
+	m.misses.Add(context.Background(), int64(n), metric.WithAttributes(attribute.String("tier", tier)))
+}
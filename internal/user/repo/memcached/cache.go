@@ -1,10 +1,10 @@
 package memcached
 
 import (
-	"bytes"
-	"encoding/gob"
+	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/bradfitz/gomemcache/memcache"
 	"github.com/rs/xid"
@@ -13,83 +13,340 @@ import (
 
 	"github.com/Karzoug/meower-user-service/internal/user/entity"
 	"github.com/Karzoug/meower-user-service/internal/user/repo"
+	"github.com/Karzoug/meower-user-service/internal/user/repo/codec"
+	"github.com/Karzoug/meower-user-service/internal/user/repo/telemetry"
 )
 
 type cache struct {
-	client memcached.Client
+	cfg       Config
+	client    memcached.Client
+	telemetry telemetry.Cache
 }
 
-func NewUserCache(client memcached.Client) cache {
+func NewUserCache(cfg Config, client memcached.Client) cache {
 	return cache{
-		client: client,
+		cfg:       cfg,
+		client:    client,
+		telemetry: telemetry.NewCache("memcached"),
 	}
 }
 
-func (c cache) GetOne(id xid.ID) (entity.UserShortProjection, error) {
+func (c cache) GetOne(ctx context.Context, id xid.ID) (entity.UserShortProjection, error) {
+	ui, _, err := c.GetOneWithExpiration(ctx, id)
+	return ui, err
+}
+
+// GetOneWithExpiration returns a user short projection and the time when the entry expires.
+// The expiration is kept in the item flags, it is zero for entries set without it.
+func (c cache) GetOneWithExpiration(ctx context.Context, id xid.ID) (_ entity.UserShortProjection, _ time.Time, err error) {
 	const op = "memcached: get one user short projection"
 
-	item, err := c.client.Get(id.String())
+	_, call := c.telemetry.Start(ctx, op)
+	defer func() { call.End(err) }()
+
+	decode := codec.Decode
+	item, err := c.client.Get(codec.Key(id))
+	if errors.Is(err, memcache.ErrCacheMiss) && c.cfg.ReadLegacyEntries {
+		decode = codec.DecodeLegacy
+		item, err = c.client.Get(codec.LegacyKey(id))
+	}
 	if err != nil {
 		if errors.Is(err, memcache.ErrCacheMiss) {
-			return entity.UserShortProjection{}, repo.ErrRecordNotFound
+			return entity.UserShortProjection{}, time.Time{}, repo.ErrRecordNotFound
 		}
-		return entity.UserShortProjection{}, fmt.Errorf("%s: %w", op, err)
+		return entity.UserShortProjection{}, time.Time{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	b := bytes.NewReader(item.Value)
-	var ui entity.UserShortProjection
-	if err := gob.NewDecoder(b).Decode(&ui); err != nil {
-		return entity.UserShortProjection{}, fmt.Errorf("%s: %w", op, err)
+	if isNotFoundMarker(item) {
+		return entity.UserShortProjection{}, time.Time{}, repo.ErrRecordNotFoundCached
 	}
 
-	return ui, nil
+	ui, err := decode(item.Value)
+	if err != nil {
+		return entity.UserShortProjection{}, time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var expiresAt time.Time
+	if item.Flags != 0 {
+		expiresAt = time.Unix(int64(item.Flags), 0)
+	}
+
+	return ui, expiresAt, nil
 }
 
-func (c cache) GetMany(ids []xid.ID) (users []entity.UserShortProjection, missed []xid.ID, err error) {
+// GetMany returns cached user short projections and ids missed in the cache.
+// Ids that are neither returned nor missed are known to be not found.
+func (c cache) GetMany(ctx context.Context, ids []xid.ID) (users []entity.UserShortProjection, missed []xid.ID, err error) {
 	const op = "memcached: get many user short projections"
 
+	_, call := c.telemetry.Start(ctx, op)
+	defer func() {
+		call.SetItems(len(users))
+		call.End(err)
+	}()
+
+	users, missed, err = c.getMany(ids, codec.Key, codec.Decode)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(missed) == 0 || !c.cfg.ReadLegacyEntries {
+		return users, missed, nil
+	}
+
+	legacyUsers, missed, err := c.getMany(missed, codec.LegacyKey, codec.DecodeLegacy)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return append(users, legacyUsers...), missed, nil
+}
+
+func (c cache) getMany(
+	ids []xid.ID,
+	key func(xid.ID) string,
+	decode func([]byte) (entity.UserShortProjection, error),
+) (users []entity.UserShortProjection, missed []xid.ID, err error) {
 	keys := make([]string, len(ids))
 	for i, id := range ids {
-		keys[i] = id.String()
+		keys[i] = key(id)
 	}
 
 	items, err := c.client.GetMulti(keys)
 	if err != nil {
-		return nil, nil, fmt.Errorf("%s: %w", op, err)
+		return nil, nil, err
 	}
 
-	res := make([]entity.UserShortProjection, 0, len(items))
+	users = make([]entity.UserShortProjection, 0, len(items))
+	missed = make([]xid.ID, 0)
+	for i, key := range keys {
+		item, ok := items[key]
+		if !ok {
+			missed = append(missed, ids[i])
+			continue
+		}
+		if isNotFoundMarker(item) {
+			continue
+		}
 
-	for _, item := range items {
-		b := bytes.NewReader(item.Value)
-		var ui entity.UserShortProjection
-		if err := gob.NewDecoder(b).Decode(&ui); err != nil {
-			return nil, nil, fmt.Errorf("%s: %w", op, err)
+		ui, err := decode(item.Value)
+		if err != nil {
+			return nil, nil, err
 		}
 
-		res = append(res, ui)
+		users = append(users, ui)
 	}
 
-	missed = make([]xid.ID, 0)
-	for _, key := range keys {
-		if _, ok := items[key]; !ok {
-			id, _ := xid.FromString(key)
-			missed = append(missed, id)
+	return users, missed, nil
+}
+
+func (c cache) Set(ctx context.Context, id xid.ID, u entity.UserShortProjection, ttl int32) (err error) {
+	const op = "memcached: set user short projection"
+
+	_, call := c.telemetry.Start(ctx, op)
+	defer func() { call.End(err) }()
+
+	var expiresAt uint32
+	if ttl > 0 {
+		expiresAt = uint32(time.Now().Unix() + int64(ttl)) //nolint:gosec
+	}
+
+	return c.client.Set(&memcache.Item{
+		Key:        codec.Key(id),
+		Value:      codec.Encode(u),
+		Flags:      expiresAt,
+		Expiration: ttl,
+	})
+}
+
+// SetMany sets user short projections one by one: memcached has no multi set command.
+func (c cache) SetMany(ctx context.Context, users []entity.UserShortProjection, ttl int32) (err error) {
+	const op = "memcached: set many user short projections"
+
+	ctx, call := c.telemetry.Start(ctx, op)
+	call.SetItems(len(users))
+	defer func() { call.End(err) }()
+
+	var errs []error
+	for i := range users {
+		if err := c.Set(ctx, users[i].ID, users[i], ttl); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
-	return res, missed, nil
+	return errors.Join(errs...)
 }
 
-func (c cache) Set(id xid.ID, u entity.UserShortProjection, ttl int32) error {
-	var b bytes.Buffer
-	if err := gob.NewEncoder(&b).Encode(u); err != nil {
-		return err
+func (c cache) Delete(ctx context.Context, id xid.ID) (err error) {
+	const op = "memcached: delete user short projection"
+
+	_, call := c.telemetry.Start(ctx, op)
+	defer func() { call.End(err) }()
+
+	if err := c.client.Delete(codec.Key(id)); err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// otherwise the legacy entry becomes visible again
+	if c.cfg.ReadLegacyEntries {
+		if err := c.client.Delete(codec.LegacyKey(id)); err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+			return fmt.Errorf("%s: %w", op, err)
+		}
 	}
 
+	return nil
+}
+
+// SetNotFound replaces the user short projection with a marker that the user does not exist.
+func (c cache) SetNotFound(ctx context.Context, id xid.ID, ttl int32) (err error) {
+	const op = "memcached: set not found user short projection"
+
+	_, call := c.telemetry.Start(ctx, op)
+	defer func() { call.End(err) }()
+
 	return c.client.Set(&memcache.Item{
-		Key:        id.String(),
-		Value:      b.Bytes(),
+		Key:        codec.Key(id),
+		Value:      []byte{},
 		Expiration: ttl,
 	})
 }
+
+func (c cache) GetUser(ctx context.Context, id xid.ID) (_ entity.User, err error) {
+	const op = "memcached: get user"
+
+	_, call := c.telemetry.Start(ctx, op)
+	defer func() { call.End(err) }()
+
+	item, err := c.client.Get(codec.UserKey(id))
+	if err != nil {
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			return entity.User{}, repo.ErrRecordNotFound
+		}
+		return entity.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	u, err := codec.DecodeUser(item.Value)
+	if err != nil {
+		return entity.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return u, nil
+}
+
+func (c cache) SetUser(ctx context.Context, u entity.User, ttl int32) (err error) {
+	const op = "memcached: set user"
+
+	_, call := c.telemetry.Start(ctx, op)
+	defer func() { call.End(err) }()
+
+	return c.client.Set(&memcache.Item{
+		Key:        codec.UserKey(u.ID),
+		Value:      codec.EncodeUser(u),
+		Expiration: ttl,
+	})
+}
+
+func (c cache) DeleteUser(ctx context.Context, id xid.ID) (err error) {
+	const op = "memcached: delete user"
+
+	_, call := c.telemetry.Start(ctx, op)
+	defer func() { call.End(err) }()
+
+	if err := c.client.Delete(codec.UserKey(id)); err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (c cache) GetIDByUsername(ctx context.Context, username string) (_ xid.ID, err error) {
+	const op = "memcached: get user id by username"
+
+	_, call := c.telemetry.Start(ctx, op)
+	defer func() { call.End(err) }()
+
+	item, err := c.client.Get(codec.UsernameKey(username))
+	if err != nil {
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			return xid.NilID(), repo.ErrRecordNotFound
+		}
+		return xid.NilID(), fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := xid.FromBytes(item.Value)
+	if err != nil {
+		return xid.NilID(), fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (c cache) GetManyIDsByUsernames(ctx context.Context, usernames []string) (ids map[string]xid.ID, missed []string, err error) {
+	const op = "memcached: get many user ids by usernames"
+
+	_, call := c.telemetry.Start(ctx, op)
+	defer func() {
+		call.SetItems(len(ids))
+		call.End(err)
+	}()
+
+	keys := make([]string, len(usernames))
+	for i, username := range usernames {
+		keys[i] = codec.UsernameKey(username)
+	}
+
+	items, err := c.client.GetMulti(keys)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	ids = make(map[string]xid.ID, len(items))
+	missed = make([]string, 0)
+	for i, key := range keys {
+		item, ok := items[key]
+		if !ok {
+			missed = append(missed, usernames[i])
+			continue
+		}
+
+		id, err := xid.FromBytes(item.Value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+		ids[usernames[i]] = id
+	}
+
+	return ids, missed, nil
+}
+
+func (c cache) SetIDByUsername(ctx context.Context, username string, id xid.ID, ttl int32) (err error) {
+	const op = "memcached: set user id by username"
+
+	_, call := c.telemetry.Start(ctx, op)
+	defer func() { call.End(err) }()
+
+	return c.client.Set(&memcache.Item{
+		Key:        codec.UsernameKey(username),
+		Value:      id.Bytes(),
+		Expiration: ttl,
+	})
+}
+
+func (c cache) DeleteIDByUsername(ctx context.Context, username string) (err error) {
+	const op = "memcached: delete user id by username"
+
+	_, call := c.telemetry.Start(ctx, op)
+	defer func() { call.End(err) }()
+
+	if err := c.client.Delete(codec.UsernameKey(username)); err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// isNotFoundMarker reports whether the item is set by SetNotFound:
+// an encoded user short projection is never empty.
+func isNotFoundMarker(item *memcache.Item) bool {
+	return len(item.Value) == 0
+}
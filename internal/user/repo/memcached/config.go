@@ -0,0 +1,7 @@
+package memcached
+
+type Config struct {
+	// ReadLegacyEntries enables reading gob encoded entries set by the previous
+	// versions of the service, it can be disabled when they expire after the rollout
+	ReadLegacyEntries bool `env:"READ_LEGACY_ENTRIES" envDefault:"true"`
+}
@@ -0,0 +1,264 @@
+// Package memory is an in-memory user repository with the same semantics as the postgresql one.
+// It is intended for tests and local development.
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+
+	"github.com/Karzoug/meower-user-service/internal/user/entity"
+	repoerr "github.com/Karzoug/meower-user-service/internal/user/repo"
+	"github.com/Karzoug/meower-user-service/internal/user/repo/telemetry"
+)
+
+// Change types of outbox records, they are the same as the postgresql ones.
+const (
+	ChangeTypeCreate = "create"
+	ChangeTypeUpdate = "update"
+	ChangeTypeDelete = "delete"
+)
+
+// OutboxRecord is a user change recorded in the same transaction as the change itself.
+type OutboxRecord struct {
+	ID         int
+	ChangeType string
+	UserID     xid.ID
+	CreatedAt  time.Time
+	// TraceContext is a propagated trace context of the change, it is nil if the change is not traced
+	TraceContext map[string]string
+}
+
+type repo struct {
+	mu          sync.RWMutex
+	users       map[xid.ID]entity.User
+	usernameIDs map[string]xid.ID
+	outbox      []OutboxRecord
+}
+
+func NewUserRepo() *repo {
+	return &repo{
+		users:       make(map[xid.ID]entity.User),
+		usernameIDs: make(map[string]xid.ID),
+	}
+}
+
+func (r *repo) Create(ctx context.Context, user entity.User) (xid.ID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[user.ID]; ok {
+		return user.ID, repoerr.ErrRecordAlreadyExists
+	}
+	if _, ok := r.usernameIDs[user.Username]; ok {
+		return user.ID, repoerr.ErrRecordAlreadyExists
+	}
+
+	user.UpdatedAt = now()
+	r.users[user.ID] = user
+	r.usernameIDs[user.Username] = user.ID
+	r.record(ctx, ChangeTypeCreate, user.ID)
+
+	return user.ID, nil
+}
+
+func (r *repo) GetOne(_ context.Context, id xid.ID) (entity.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return entity.User{}, repoerr.ErrRecordNotFound
+	}
+
+	return u, nil
+}
+
+func (r *repo) GetOneShortProjection(_ context.Context, id xid.ID) (entity.UserShortProjection, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return entity.UserShortProjection{}, repoerr.ErrRecordNotFound
+	}
+
+	return u.UserShortProjection, nil
+}
+
+func (r *repo) GetOneShortProjectionByUsername(_ context.Context, username string) (entity.UserShortProjection, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	id, ok := r.usernameIDs[username]
+	if !ok {
+		return entity.UserShortProjection{}, repoerr.ErrRecordNotFound
+	}
+
+	return r.users[id].UserShortProjection, nil
+}
+
+func (r *repo) GetManyShortProjections(_ context.Context, ids []xid.ID) ([]entity.UserShortProjection, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	us := make([]entity.UserShortProjection, 0, len(ids))
+	for _, id := range uniq(ids) {
+		if u, ok := r.users[id]; ok {
+			us = append(us, u.UserShortProjection)
+		}
+	}
+
+	return us, nil
+}
+
+func (r *repo) GetManyShortProjectionsByUsernames(_ context.Context, usernames []string) ([]entity.UserShortProjection, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	us := make([]entity.UserShortProjection, 0, len(usernames))
+	for _, username := range uniq(usernames) {
+		if id, ok := r.usernameIDs[username]; ok {
+			us = append(us, r.users[id].UserShortProjection)
+		}
+	}
+
+	return us, nil
+}
+
+// Update updates the user and returns the new update time of it.
+// The username is not changed as in the postgresql repository.
+func (r *repo) Update(ctx context.Context, user entity.User) (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[user.ID]
+	if !ok {
+		return time.Time{}, repoerr.ErrRecordNotFound
+	}
+
+	u.Name = user.Name
+	u.ImageURL = user.ImageURL
+	u.StatusText = user.StatusText
+	u.UpdatedAt = now()
+	r.users[u.ID] = u
+	r.record(ctx, ChangeTypeUpdate, u.ID)
+
+	return u.UpdatedAt, nil
+}
+
+// UpdateUsername changes the username of the user and returns the id of it.
+func (r *repo) UpdateUsername(ctx context.Context, username, newUsername string) (xid.ID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, ok := r.usernameIDs[username]
+	if !ok {
+		return xid.NilID(), repoerr.ErrRecordNotFound
+	}
+	if _, ok := r.usernameIDs[newUsername]; ok {
+		return xid.NilID(), repoerr.ErrRecordAlreadyExists
+	}
+
+	u := r.users[id]
+	u.Username = newUsername
+	u.UpdatedAt = now()
+	r.users[id] = u
+	delete(r.usernameIDs, username)
+	r.usernameIDs[newUsername] = id
+	r.record(ctx, ChangeTypeUpdate, id)
+
+	return id, nil
+}
+
+func (r *repo) DeleteByUsername(ctx context.Context, username string) (xid.ID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, ok := r.usernameIDs[username]
+	if !ok {
+		return xid.NilID(), repoerr.ErrNoAffected
+	}
+
+	delete(r.usernameIDs, username)
+	delete(r.users, id)
+	r.record(ctx, ChangeTypeDelete, id)
+
+	return id, nil
+}
+
+// ForEachRecentShortProjections calls fn with batches of up to limit short projections
+// of the most recently updated users.
+func (r *repo) ForEachRecentShortProjections(ctx context.Context,
+	limit, batchSize int,
+	fn func([]entity.UserShortProjection) error,
+) error {
+	r.mu.RLock()
+	users := make([]entity.User, 0, len(r.users))
+	for _, u := range r.users {
+		users = append(users, u)
+	}
+	r.mu.RUnlock()
+
+	slices.SortFunc(users, func(a, b entity.User) int {
+		return cmp.Or(b.UpdatedAt.Compare(a.UpdatedAt), b.ID.Compare(a.ID))
+	})
+	users = users[:min(limit, len(users))]
+
+	for batch := range slices.Chunk(users, max(batchSize, 1)) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		us := make([]entity.UserShortProjection, len(batch))
+		for i := range batch {
+			us[i] = batch[i].UserShortProjection
+		}
+		if err := fn(us); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Outbox returns all recorded user changes in the order of changes.
+func (r *repo) Outbox() []OutboxRecord {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return slices.Clone(r.outbox)
+}
+
+func (r *repo) record(ctx context.Context, changeType string, id xid.ID) {
+	r.outbox = append(r.outbox, OutboxRecord{
+		ID:           len(r.outbox) + 1,
+		ChangeType:   changeType,
+		UserID:       id,
+		CreatedAt:    now(),
+		TraceContext: telemetry.TraceContext(ctx),
+	})
+}
+
+// now returns the current time with the precision of the postgresql timestamp.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func uniq[T comparable](s []T) []T {
+	seen := make(map[T]struct{}, len(s))
+	res := make([]T, 0, len(s))
+	for _, v := range s {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		res = append(res, v)
+	}
+
+	return res
+}
@@ -0,0 +1,26 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rs/xid"
+
+	"github.com/Karzoug/meower-user-service/internal/user/repo/repotest"
+)
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(*testing.T) (repotest.Repository, repotest.OutboxFunc) {
+		r := NewUserRepo()
+
+		return r, func(_ context.Context, id xid.ID) ([]string, error) {
+			var changes []string
+			for _, rec := range r.Outbox() {
+				if rec.UserID == id {
+					changes = append(changes, rec.ChangeType)
+				}
+			}
+			return changes, nil
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package cdc
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// identifierRe matches names allowed for replication slots,
+// publications use the same rule to be safe to put into replication commands
+var identifierRe = regexp.MustCompile(`^[a-z0-9_]{1,63}$`)
+
+type Config struct {
+	// SlotName is a name of the logical replication slot, the slot keeps the position
+	// of the last published change and is created if it does not exist
+	SlotName string `env:"SLOT_NAME" envDefault:"user_service_cdc"`
+	// Publication is a name of the publication of the users table, it is created if it does not exist
+	Publication string `env:"PUBLICATION" envDefault:"user_service_cdc"`
+	// StatusIntervalSeconds is an interval between reports of the published position to the server
+	StatusIntervalSeconds int `env:"STATUS_INTERVAL_SECONDS" envDefault:"10"`
+}
+
+// Validate reports all invalid settings at once.
+func (cfg Config) Validate() error {
+	var errs []error
+
+	if !identifierRe.MatchString(cfg.SlotName) {
+		errs = append(errs, fmt.Errorf("slot name %q must consist of lower case letters, numbers and underscores", cfg.SlotName))
+	}
+	if !identifierRe.MatchString(cfg.Publication) {
+		errs = append(errs, fmt.Errorf("publication %q must consist of lower case letters, numbers and underscores", cfg.Publication))
+	}
+	if cfg.StatusIntervalSeconds <= 0 {
+		errs = append(errs, fmt.Errorf("status interval %ds must be positive", cfg.StatusIntervalSeconds))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid cdc config: %w", err)
+	}
+	return nil
+}
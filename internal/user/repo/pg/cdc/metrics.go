@@ -0,0 +1,35 @@
+package cdc
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const instrumentationName = "github.com/Karzoug/meower-user-service/internal/user/repo/pg/cdc"
+
+type metrics struct {
+	published metric.Int64Counter
+}
+
+func newMetrics() metrics {
+	meter := otel.GetMeterProvider().Meter(instrumentationName)
+
+	published, err := meter.Int64Counter("cdc.events.published",
+		metric.WithDescription("Number of user change events captured from the WAL and published."),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return metrics{
+		published: published,
+	}
+}
+
+func (m metrics) eventsPublished(ctx context.Context, n int) {
+	if n > 0 {
+		m.published.Add(ctx, int64(n))
+	}
+}
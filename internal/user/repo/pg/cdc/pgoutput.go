@@ -0,0 +1,268 @@
+package cdc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// messages of the pgoutput plugin of protocol version 1
+const (
+	msgBegin    = 'B'
+	msgCommit   = 'C'
+	msgRelation = 'R'
+	msgInsert   = 'I'
+	msgUpdate   = 'U'
+	msgDelete   = 'D'
+	msgMessage  = 'M'
+)
+
+// messageTransactional is the flag of logical decoding messages written within a transaction
+const messageTransactional = 1
+
+// kinds of tuples and of tuple columns
+const (
+	tupleNew      = 'N'
+	tupleKey      = 'K'
+	tupleOld      = 'O'
+	columnNull    = 'n'
+	columnToasted = 'u'
+	columnText    = 't'
+	columnBinary  = 'b'
+)
+
+var errShortMessage = errors.New("pgoutput message is too short")
+
+type relation struct {
+	namespace string
+	name      string
+	columns   []string
+}
+
+// begin starts a transaction, changes are followed by the commit of it.
+type begin struct{}
+
+type commit struct {
+	// end is the position after the transaction, it is confirmed when all changes are published
+	end lsn
+}
+
+// logicalMessage is a transactional message written by pg_logical_emit_message,
+// it is decoded in the order of writing among the changes of the transaction.
+type logicalMessage struct {
+	prefix  string
+	content []byte
+}
+
+// rowChange is an insert, update or delete of a row of a published table.
+type rowChange struct {
+	kind      byte
+	namespace string
+	table     string
+	// values are the text values of the new row or of the key of the deleted row,
+	// null and unchanged toasted values are missing
+	values map[string]string
+}
+
+// decoder decodes pgoutput messages, it keeps relations sent before changes of them.
+type decoder struct {
+	relations map[uint32]relation
+}
+
+func newDecoder() decoder {
+	return decoder{
+		relations: make(map[uint32]relation),
+	}
+}
+
+// decode returns begin, commit, rowChange, logicalMessage or nil for messages that are not needed.
+func (d decoder) decode(data []byte) (any, error) {
+	if len(data) == 0 {
+		return nil, errShortMessage
+	}
+
+	r := &reader{data: data[1:]}
+	var (
+		msg any
+		err error
+	)
+	switch data[0] {
+	case msgBegin:
+		msg = begin{}
+	case msgCommit:
+		r.byte()   // flags
+		r.uint64() // commit position
+		msg = commit{end: lsn(r.uint64())}
+	case msgRelation:
+		d.decodeRelation(r)
+	case msgInsert:
+		msg, err = d.decodeChange(r, msgInsert)
+	case msgUpdate:
+		msg, err = d.decodeChange(r, msgUpdate)
+	case msgDelete:
+		msg, err = d.decodeChange(r, msgDelete)
+	case msgMessage:
+		msg = d.decodeMessage(r)
+	default:
+		// origin, type and truncate messages
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("%c message: %w", data[0], r.err)
+	}
+
+	return msg, nil
+}
+
+// decodeMessage returns the logical decoding message or nil if it is not transactional:
+// such messages are not related to changes.
+func (d decoder) decodeMessage(r *reader) any {
+	flags := r.byte()
+	r.uint64() // message position
+	msg := logicalMessage{
+		prefix: r.cstring(),
+	}
+	msg.content = r.bytes(int(r.uint32()))
+
+	if flags&messageTransactional == 0 || r.err != nil {
+		return nil
+	}
+	return msg
+}
+
+func (d decoder) decodeRelation(r *reader) {
+	id := r.uint32()
+	rel := relation{
+		namespace: r.cstring(),
+		name:      r.cstring(),
+	}
+	r.byte() // replica identity
+	rel.columns = make([]string, 0, r.uint16())
+	for i := 0; i < cap(rel.columns) && r.err == nil; i++ {
+		r.byte() // flags
+		rel.columns = append(rel.columns, r.cstring())
+		r.uint32() // type
+		r.uint32() // type modifier
+	}
+
+	if r.err == nil {
+		d.relations[id] = rel
+	}
+}
+
+// decodeChange decodes the new row of inserts and updates and the old key of deletes,
+// the old row of updates is skipped.
+func (d decoder) decodeChange(r *reader, kind byte) (any, error) {
+	id := r.uint32()
+	rel, ok := d.relations[id]
+	if !ok && r.err == nil {
+		return nil, fmt.Errorf("%c message of unknown relation %d", kind, id)
+	}
+
+	tuple := r.byte()
+	if kind == msgUpdate && (tuple == tupleKey || tuple == tupleOld) {
+		d.decodeTuple(r, rel)
+		tuple = r.byte()
+	}
+	if kind == msgDelete && tuple != tupleKey && tuple != tupleOld ||
+		kind != msgDelete && tuple != tupleNew {
+		if r.err == nil {
+			return nil, fmt.Errorf("%c message with unexpected tuple %q", kind, tuple)
+		}
+		return nil, nil
+	}
+
+	return rowChange{
+		kind:      kind,
+		namespace: rel.namespace,
+		table:     rel.name,
+		values:    d.decodeTuple(r, rel),
+	}, nil
+}
+
+func (d decoder) decodeTuple(r *reader, rel relation) map[string]string {
+	n := int(r.uint16())
+	values := make(map[string]string, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		switch kind := r.byte(); kind {
+		case columnNull, columnToasted:
+		case columnText, columnBinary:
+			value := r.bytes(int(r.uint32()))
+			if kind == columnText && i < len(rel.columns) {
+				values[rel.columns[i]] = string(value)
+			}
+		default:
+			if r.err == nil {
+				r.err = fmt.Errorf("unknown column kind %q", kind)
+			}
+		}
+	}
+
+	return values
+}
+
+// reader reads big endian values, the first error is kept and zero values are returned after it.
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.data) < n {
+		r.err = errShortMessage
+		return nil
+	}
+
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) byte() byte {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) uint64() uint64 {
+	if b := r.bytes(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *reader) cstring() string {
+	if r.err != nil {
+		return ""
+	}
+	for i, b := range r.data {
+		if b == 0 {
+			s := string(r.data[:i])
+			r.data = r.data[i+1:]
+			return s
+		}
+	}
+
+	r.err = errShortMessage
+	return ""
+}
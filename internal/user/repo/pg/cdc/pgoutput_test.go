@@ -0,0 +1,210 @@
+package cdc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"maps"
+	"testing"
+)
+
+func TestDecoder(t *testing.T) {
+	d := newDecoder()
+
+	if _, err := d.decode(relationMsg(16385, "public", "users", "id", "name", "image_url")); err != nil {
+		t.Fatalf("decode relation: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want any
+	}{
+		{
+			name: "begin",
+			data: msg(msgBegin, u64(1), u64(2), u32(3)),
+			want: begin{},
+		},
+		{
+			name: "insert",
+			data: msg(msgInsert, u32(16385), []byte{tupleNew},
+				tuple(text("c1"), text("alice"), []byte{columnNull})),
+			want: rowChange{
+				kind:      msgInsert,
+				namespace: "public",
+				table:     "users",
+				values:    map[string]string{"id": "c1", "name": "alice"},
+			},
+		},
+		{
+			name: "update with old key",
+			data: msg(msgUpdate, u32(16385),
+				[]byte{tupleKey}, tuple(text("c0"), []byte{columnNull}, []byte{columnNull}),
+				[]byte{tupleNew}, tuple(text("c1"), text("bob"), []byte{columnToasted})),
+			want: rowChange{
+				kind:      msgUpdate,
+				namespace: "public",
+				table:     "users",
+				values:    map[string]string{"id": "c1", "name": "bob"},
+			},
+		},
+		{
+			name: "delete",
+			data: msg(msgDelete, u32(16385), []byte{tupleKey},
+				tuple(text("c1"), []byte{columnNull}, []byte{columnNull})),
+			want: rowChange{
+				kind:      msgDelete,
+				namespace: "public",
+				table:     "users",
+				values:    map[string]string{"id": "c1"},
+			},
+		},
+		{
+			name: "commit",
+			data: msg(msgCommit, []byte{0}, u64(10), u64(0x1_0000_0020), u64(0)),
+			want: commit{end: 0x1_0000_0020},
+		},
+		{
+			name: "transactional message",
+			data: msg(msgMessage, []byte{messageTransactional}, u64(10), cstring("prefix"), u32(2), []byte("{}")),
+			want: logicalMessage{prefix: "prefix", content: []byte("{}")},
+		},
+		{
+			name: "non-transactional message is ignored",
+			data: msg(msgMessage, []byte{0}, u64(10), cstring("prefix"), u32(2), []byte("{}")),
+			want: nil,
+		},
+		{
+			name: "truncate is ignored",
+			data: msg('T', u32(1), []byte{0}, u32(16385)),
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.decode(tt.data)
+			if err != nil {
+				t.Fatalf("decode() error = %v", err)
+			}
+
+			if wantMsg, ok := tt.want.(logicalMessage); ok {
+				gotMsg, ok := got.(logicalMessage)
+				if !ok || gotMsg.prefix != wantMsg.prefix || !bytes.Equal(gotMsg.content, wantMsg.content) {
+					t.Errorf("decode() = %#v, want %#v", got, tt.want)
+				}
+				return
+			}
+
+			gotChange, ok := got.(rowChange)
+			wantChange, wantOK := tt.want.(rowChange)
+			if ok != wantOK {
+				t.Fatalf("decode() = %#v, want %#v", got, tt.want)
+			}
+			if ok {
+				if gotChange.kind != wantChange.kind ||
+					gotChange.namespace != wantChange.namespace ||
+					gotChange.table != wantChange.table ||
+					!maps.Equal(gotChange.values, wantChange.values) {
+					t.Errorf("decode() = %#v, want %#v", got, tt.want)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("decode() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	d := newDecoder()
+	if _, err := d.decode(relationMsg(1, "public", "users", "id")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{
+			name: "empty",
+			data: nil,
+		},
+		{
+			name: "truncated commit",
+			data: msg(msgCommit, []byte{0}, u64(10)),
+		},
+		{
+			name: "unknown relation",
+			data: msg(msgInsert, u32(2), []byte{tupleNew}, tuple(text("c1"))),
+		},
+		{
+			name: "truncated tuple",
+			data: msg(msgInsert, u32(1), []byte{tupleNew}, u16(1), []byte{columnText}, u32(10), []byte("c1")),
+		},
+		{
+			name: "truncated message",
+			data: msg(msgMessage, []byte{messageTransactional}, u64(10), cstring("prefix"), u32(10), []byte("{}")),
+		},
+		{
+			name: "unexpected tuple",
+			data: msg(msgDelete, u32(1), []byte{tupleNew}, tuple(text("c1"))),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := d.decode(tt.data); err == nil {
+				t.Error("decode() error = nil, want error")
+			}
+		})
+	}
+
+	if _, err := d.decode(msg(msgCommit, []byte{0})); !errors.Is(err, errShortMessage) {
+		t.Errorf("decode() error = %v, want %v", err, errShortMessage)
+	}
+}
+
+func relationMsg(id uint32, namespace, name string, columns ...string) []byte {
+	parts := [][]byte{u32(id), cstring(namespace), cstring(name), {'d'}, u16(uint16(len(columns)))}
+	for _, column := range columns {
+		parts = append(parts, []byte{0}, cstring(column), u32(25), u32(0xffffffff))
+	}
+
+	return msg(msgRelation, parts...)
+}
+
+func tuple(columns ...[]byte) []byte {
+	return append(u16(uint16(len(columns))), concat(columns...)...)
+}
+
+func text(value string) []byte {
+	return concat([]byte{columnText}, u32(uint32(len(value))), []byte(value))
+}
+
+func msg(kind byte, parts ...[]byte) []byte {
+	return append([]byte{kind}, concat(parts...)...)
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func cstring(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+func u16(v uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, v)
+}
+
+func u32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+func u64(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
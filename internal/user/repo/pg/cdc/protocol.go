@@ -0,0 +1,221 @@
+package cdc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// messages of the streaming replication protocol sent in copy data
+const (
+	msgXLogData          = 'w'
+	msgPrimaryKeepalive  = 'k'
+	msgStandbyStatus     = 'r'
+	xLogDataHeaderLen    = 1 + 8 + 8 + 8
+	keepaliveLen         = 1 + 8 + 8 + 1
+	standbyStatusDataLen = 1 + 8 + 8 + 8 + 8 + 1
+)
+
+// postgresEpoch is the start of the time of the replication protocol
+var postgresEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// lsn is a position in the write-ahead log.
+type lsn uint64
+
+func (l lsn) String() string {
+	return fmt.Sprintf("%X/%X", uint32(l>>32), uint32(l))
+}
+
+// connectReplication opens a connection in the logical replication mode,
+// it accepts both replication commands and simple queries.
+func connectReplication(ctx context.Context, uri string) (*pgconn.PgConn, error) {
+	cfg, err := pgconn.ParseConfig(uri)
+	if err != nil {
+		return nil, err
+	}
+	cfg.RuntimeParams["replication"] = "database"
+
+	return pgconn.ConnectConfig(ctx, cfg)
+}
+
+// exists reports whether the query returns any rows.
+func exists(ctx context.Context, conn *pgconn.PgConn, query string) (bool, error) {
+	row, err := firstRow(ctx, conn, query)
+	return row != nil, err
+}
+
+// firstRow returns the text values of the first row of the query or nil if there are no rows.
+func firstRow(ctx context.Context, conn *pgconn.PgConn, query string) ([]string, error) {
+	results, err := conn.Exec(ctx, query).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 || len(results[0].Rows) == 0 {
+		return nil, nil
+	}
+
+	row := make([]string, len(results[0].Rows[0]))
+	for i, value := range results[0].Rows[0] {
+		row[i] = string(value)
+	}
+	return row, nil
+}
+
+// setUp creates the publication of the users table and the replication slot if they do not exist
+// and verifies them.
+// Names are validated by the config, so they are put into the queries as is.
+func setUp(ctx context.Context, conn *pgconn.PgConn, cfg Config) error {
+	ok, err := exists(ctx, conn,
+		fmt.Sprintf("SELECT 1 FROM pg_publication WHERE pubname = '%s'", cfg.Publication))
+	if err != nil {
+		return fmt.Errorf("failed to check publication: %w", err)
+	}
+	if !ok {
+		if _, err := conn.Exec(ctx,
+			fmt.Sprintf("CREATE PUBLICATION %s FOR TABLE users", cfg.Publication)).ReadAll(); err != nil {
+			return fmt.Errorf("failed to create publication: %w", err)
+		}
+	}
+
+	ok, err = exists(ctx, conn,
+		fmt.Sprintf("SELECT 1 FROM pg_replication_slots WHERE slot_name = '%s'", cfg.SlotName))
+	if err != nil {
+		return fmt.Errorf("failed to check replication slot: %w", err)
+	}
+	if !ok {
+		if _, err := conn.Exec(ctx,
+			fmt.Sprintf("CREATE_REPLICATION_SLOT %s LOGICAL pgoutput NOEXPORT_SNAPSHOT", cfg.SlotName)).ReadAll(); err != nil {
+			return fmt.Errorf("failed to create replication slot: %w", err)
+		}
+	}
+
+	return verify(ctx, conn, cfg)
+}
+
+// verify checks that changes of the users table can be streamed from the slot:
+// the slot and the publication may be created before by someone else with other settings.
+func verify(ctx context.Context, conn *pgconn.PgConn, cfg Config) error {
+	row, err := firstRow(ctx, conn, "SELECT current_setting('wal_level')")
+	if err != nil {
+		return fmt.Errorf("failed to check wal level: %w", err)
+	}
+	if row == nil || row[0] != "logical" {
+		return fmt.Errorf("wal level is %s, want logical", strings.Join(row, ""))
+	}
+
+	row, err = firstRow(ctx, conn, fmt.Sprintf(
+		"SELECT slot_type, plugin, database = current_database() FROM pg_replication_slots WHERE slot_name = '%s'",
+		cfg.SlotName))
+	if err != nil {
+		return fmt.Errorf("failed to check replication slot: %w", err)
+	}
+	switch {
+	case row == nil:
+		return fmt.Errorf("replication slot %s does not exist", cfg.SlotName)
+	case row[0] != "logical" || row[1] != "pgoutput":
+		return fmt.Errorf("replication slot %s is %s of plugin %s, want logical of pgoutput", cfg.SlotName, row[0], row[1])
+	case row[2] != "t":
+		return fmt.Errorf("replication slot %s belongs to another database", cfg.SlotName)
+	}
+
+	ok, err := exists(ctx, conn, fmt.Sprintf(
+		"SELECT 1 FROM pg_publication_tables WHERE pubname = '%s' AND tablename = '%s'",
+		cfg.Publication, usersTable))
+	if err != nil {
+		return fmt.Errorf("failed to check publication: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("publication %s does not include table %s", cfg.Publication, usersTable)
+	}
+
+	return nil
+}
+
+// startReplication starts streaming changes of the publication and logical decoding messages
+// from the position confirmed to the slot last time, messages are sent by PostgreSQL 14 and later.
+func startReplication(ctx context.Context, conn *pgconn.PgConn, cfg Config) error {
+	conn.Frontend().SendQuery(&pgproto3.Query{
+		String: fmt.Sprintf("START_REPLICATION SLOT %s LOGICAL 0/0 (proto_version '1', publication_names '%s', messages 'true')",
+			cfg.SlotName, cfg.Publication),
+	})
+	if err := conn.Frontend().Flush(); err != nil {
+		return err
+	}
+
+	var pgErr *pgconn.PgError
+	for {
+		msg, err := conn.ReceiveMessage(ctx)
+		if err != nil {
+			return err
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.CopyBothResponse:
+			return nil
+		case *pgproto3.ErrorResponse:
+			// the connection is ready for the next command after the error
+			pgErr = pgconn.ErrorResponseToPgError(msg)
+		case *pgproto3.ReadyForQuery:
+			if pgErr != nil {
+				return pgErr
+			}
+			return errors.New("replication is not started")
+		case *pgproto3.NoticeResponse, *pgproto3.ParameterStatus:
+		default:
+			return fmt.Errorf("unexpected message %T", msg)
+		}
+	}
+}
+
+// isSlotActive reports whether the slot is used by another connection.
+func isSlotActive(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ObjectInUse
+}
+
+// sendStandbyStatus confirms that all changes up to the position are published,
+// the server keeps the position in the slot and may remove older WAL.
+func sendStandbyStatus(conn *pgconn.PgConn, pos lsn) error {
+	data := make([]byte, standbyStatusDataLen)
+	data[0] = msgStandbyStatus
+	binary.BigEndian.PutUint64(data[1:], uint64(pos))  // written
+	binary.BigEndian.PutUint64(data[9:], uint64(pos))  // flushed
+	binary.BigEndian.PutUint64(data[17:], uint64(pos)) // applied
+	binary.BigEndian.PutUint64(data[25:], uint64(time.Since(postgresEpoch).Microseconds()))
+
+	conn.Frontend().Send(&pgproto3.CopyData{Data: data})
+	return conn.Frontend().Flush()
+}
+
+// keepalive is a heartbeat of the server.
+type keepalive struct {
+	walEnd         lsn
+	replyRequested bool
+}
+
+func parseKeepalive(data []byte) (keepalive, error) {
+	if len(data) < keepaliveLen {
+		return keepalive{}, errors.New("keepalive message is too short")
+	}
+
+	return keepalive{
+		walEnd:         lsn(binary.BigEndian.Uint64(data[1:])),
+		replyRequested: data[17] != 0,
+	}, nil
+}
+
+// parseXLogData returns the pgoutput message of the WAL data message.
+func parseXLogData(data []byte) ([]byte, error) {
+	if len(data) < xLogDataHeaderLen {
+		return nil, errors.New("wal data message is too short")
+	}
+
+	return data[xLogDataHeaderLen:], nil
+}
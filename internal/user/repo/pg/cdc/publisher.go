@@ -0,0 +1,331 @@
+// Package cdc publishes user change events captured from the WAL of the users table
+// by a logical replication slot of the pgoutput plugin, it replaces the outbox table.
+package cdc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/proto"
+
+	ck "github.com/Karzoug/meower-common-go/kafka"
+
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/broker"
+	userGen "github.com/Karzoug/meower-user-service/internal/delivery/kafka/gen/user/v1"
+	"github.com/Karzoug/meower-user-service/internal/user/repo/telemetry"
+)
+
+const (
+	usersTable                = "users"
+	idColumn                  = "id"
+	closeTimeout              = 5 * time.Second
+	defaultOperationTimeout   = 5 * time.Second
+	maxRetryTimeoutBeforeExit = 60 * time.Second
+)
+
+type publisher struct {
+	cfg     Config
+	conn    *pgconn.PgConn
+	sink    broker.Sink
+	topic   string
+	fngpnt  string
+	metrics metrics
+	logger  zerolog.Logger
+}
+
+// NewPublisher connects to the database by uri in the replication mode, creates
+// the publication and the replication slot if they do not exist and verifies them,
+// so the service does not start if changes can't be captured. The user must have
+// the replication attribute and the server must be PostgreSQL 14 or later running with logical wal level.
+// Events are sent to the topic by the sink, the connection is closed when the publisher stops.
+func NewPublisher(ctx context.Context, cfg Config, uri string, sink broker.Sink, topic string, logger zerolog.Logger) (publisher, error) {
+	const op = "create cdc publisher"
+
+	logger = logger.With().
+		Str("component", "cdc publisher").
+		Logger()
+
+	if err := cfg.Validate(); err != nil {
+		return publisher{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	conn, err := connectReplication(ctx, uri)
+	if err != nil {
+		return publisher{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := setUp(ctx, conn, cfg); err != nil {
+		return publisher{}, errors.Join(
+			fmt.Errorf("%s: %w", op, err),
+			conn.Close(context.Background()))
+	}
+
+	return publisher{
+		cfg:     cfg,
+		conn:    conn,
+		sink:    sink,
+		topic:   topic,
+		fngpnt:  ck.MessageTypeHeaderValue(&userGen.ChangedEvent{}),
+		metrics: newMetrics(),
+		logger:  logger,
+	}, nil
+}
+
+// Run streams changes and publishes them when transactions commit, the position after
+// the transaction is confirmed to the slot only after all events of it are sent.
+// Changes are sent again after restart if the position is not confirmed yet.
+// The publisher waits while the slot is used by another replica of the service.
+func (p publisher) Run(ctx context.Context) (err error) {
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+		defer cancel()
+
+		if defErr := p.conn.Close(ctx); defErr != nil {
+			err = errors.Join(err,
+				fmt.Errorf("failed to close replication connection: %w", defErr))
+		}
+	}()
+
+	statusInterval := time.Duration(p.cfg.StatusIntervalSeconds) * time.Second
+	// only one replica of the service streams from the slot, others wait for it to be released
+	for {
+		err := startReplication(ctx, p.conn, p.cfg)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if !isSlotActive(err) {
+			return fmt.Errorf("failed to start replication: %w", err)
+		}
+
+		p.logger.Debug().
+			Str("slot", p.cfg.SlotName).
+			Msg("slot is used by another replica: waiting")
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(statusInterval):
+		}
+	}
+	p.logger.Info().
+		Str("slot", p.cfg.SlotName).
+		Str("publication", p.cfg.Publication).
+		Msg("started replication")
+
+	var (
+		dec        = newDecoder()
+		nextStatus = time.Now().Add(statusInterval)
+		// confirmed is the position up to which all changes are published
+		confirmed lsn
+		inTx      bool
+		events    []*broker.Message
+		// traceContext is emitted by the repository before the change of the user it belongs to
+		traceContext map[string]string
+	)
+	defer func() {
+		// the position is kept by the server on graceful stop, it is not critical if it fails
+		if err := sendStandbyStatus(p.conn, confirmed); err != nil {
+			p.logger.Warn().
+				Err(err).
+				Msg("failed to confirm position on stop")
+			return
+		}
+		p.logger.Info().
+			Stringer("position", confirmed).
+			Msg("stopped replication")
+	}()
+
+	for {
+		if !time.Now().Before(nextStatus) {
+			if err := sendStandbyStatus(p.conn, confirmed); err != nil {
+				return fmt.Errorf("failed to confirm position: %w", err)
+			}
+			nextStatus = time.Now().Add(statusInterval)
+		}
+
+		receiveCtx, cancel := context.WithDeadline(ctx, nextStatus)
+		msg, err := p.conn.ReceiveMessage(receiveCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if pgconn.Timeout(err) {
+				continue
+			}
+			return fmt.Errorf("failed to receive replication message: %w", err)
+		}
+
+		var data []byte
+		switch msg := msg.(type) {
+		case *pgproto3.CopyData:
+			data = msg.Data
+		case *pgproto3.ErrorResponse:
+			return fmt.Errorf("replication failed: %w", pgconn.ErrorResponseToPgError(msg))
+		default:
+			p.logger.Warn().
+				Str("type", fmt.Sprintf("%T", msg)).
+				Msg("unexpected replication message")
+			continue
+		}
+		if len(data) == 0 {
+			continue
+		}
+
+		switch data[0] {
+		case msgPrimaryKeepalive:
+			ka, err := parseKeepalive(data)
+			if err != nil {
+				return err
+			}
+			// everything sent before is published if no transaction is in progress,
+			// confirming it lets the server remove WAL of changes of other tables
+			if !inTx && ka.walEnd > confirmed {
+				confirmed = ka.walEnd
+			}
+			if ka.replyRequested {
+				nextStatus = time.Time{}
+			}
+		case msgXLogData:
+			payload, err := parseXLogData(data)
+			if err != nil {
+				return err
+			}
+			decoded, err := dec.decode(payload)
+			if err != nil {
+				return fmt.Errorf("failed to decode change: %w", err)
+			}
+
+			switch decoded := decoded.(type) {
+			case begin:
+				inTx = true
+				events = events[:0]
+				traceContext = nil
+			case logicalMessage:
+				if decoded.prefix == telemetry.TraceContextMessagePrefix {
+					traceContext = p.traceContext(decoded.content)
+				}
+			case rowChange:
+				if event := p.event(decoded, traceContext); event != nil {
+					events = append(events, event)
+				}
+				traceContext = nil
+			case commit:
+				if err := p.publish(ctx, events); err != nil {
+					if ctx.Err() != nil {
+						return nil
+					}
+					return err
+				}
+				inTx = false
+				confirmed = decoded.end
+			}
+		}
+	}
+}
+
+// traceContext decodes the trace context of the following change, it is not critical if it fails.
+func (p publisher) traceContext(content []byte) map[string]string {
+	var tc map[string]string
+	if err := json.Unmarshal(content, &tc); err != nil {
+		p.logger.Warn().
+			Err(err).
+			Msg("failed to decode trace context of change: skipped")
+		return nil
+	}
+
+	return tc
+}
+
+// event returns the user change event of the row change with the trace context as headers
+// or nil if it is not a change of a user.
+func (p publisher) event(change rowChange, traceContext map[string]string) *broker.Message {
+	if change.table != usersTable {
+		return nil
+	}
+
+	var changeType userGen.ChangeType
+	switch change.kind {
+	case msgInsert:
+		changeType = userGen.ChangeType_CHANGE_TYPE_CREATED
+	case msgUpdate:
+		changeType = userGen.ChangeType_CHANGE_TYPE_UPDATED
+	case msgDelete:
+		changeType = userGen.ChangeType_CHANGE_TYPE_DELETED
+	}
+
+	id, ok := change.values[idColumn]
+	if !ok {
+		p.logger.Error().
+			Str("change_type", changeType.String()).
+			Msg("no user id in change: skipped")
+		return nil
+	}
+
+	payload, err := proto.Marshal(&userGen.ChangedEvent{
+		Id:         id,
+		ChangeType: changeType,
+	})
+	if err != nil {
+		p.logger.Error().
+			Err(err).
+			Str("user_id", id).
+			Msg("failed to serialize event: skipped")
+		return nil
+	}
+
+	headers := make([]broker.Header, 0, 1+len(traceContext))
+	headers = append(headers, broker.Header{Key: ck.MessageTypeHeaderKey, Value: []byte(p.fngpnt)})
+	for _, key := range slices.Sorted(maps.Keys(traceContext)) {
+		headers = append(headers, broker.Header{Key: key, Value: []byte(traceContext[key])})
+	}
+
+	return &broker.Message{
+		Topic:   p.topic,
+		Key:     []byte(id),
+		Value:   payload,
+		Headers: headers,
+	}
+}
+
+// publish sends the events of the transaction in order.
+func (p publisher) publish(ctx context.Context, events []*broker.Message) error {
+	for _, event := range events {
+		if err := backoff.RetryNotify(
+			func() error {
+				ctx, cancel := context.WithTimeout(ctx, defaultOperationTimeout)
+				defer cancel()
+
+				return p.sink.Produce(ctx, event)
+			},
+			backoff.WithContext(
+				backoff.NewExponentialBackOff(
+					backoff.WithMaxElapsedTime(maxRetryTimeoutBeforeExit),
+				),
+				ctx,
+			),
+			func(err error, _ time.Duration) {
+				p.logger.Error().
+					Err(err).
+					Str("key", string(event.Key)).
+					Msg("failed to publish event")
+			},
+		); err != nil {
+			return fmt.Errorf("all retries for publishing event failed: %w", err)
+		}
+	}
+	p.metrics.eventsPublished(ctx, len(events))
+
+	return nil
+}
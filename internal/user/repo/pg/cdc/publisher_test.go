@@ -0,0 +1,240 @@
+package cdc
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/proto"
+
+	ck "github.com/Karzoug/meower-common-go/kafka"
+	"github.com/Karzoug/meower-common-go/postgresql"
+
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/broker"
+	userGen "github.com/Karzoug/meower-user-service/internal/delivery/kafka/gen/user/v1"
+	"github.com/Karzoug/meower-user-service/internal/delivery/kafka/memory"
+	"github.com/Karzoug/meower-user-service/internal/user/entity"
+	"github.com/Karzoug/meower-user-service/internal/user/repo/pg"
+)
+
+const userTopic = "user"
+
+// TestPublisher runs against a migrated database given by PG_TEST_URI,
+// the server must run with logical wal level and the user must have the replication attribute.
+// The slot and the publication of the test are dropped after it.
+func TestPublisher(t *testing.T) {
+	uri := os.Getenv("PG_TEST_URI")
+	if uri == "" {
+		t.Skip("PG_TEST_URI is not set")
+	}
+
+	db, err := postgresql.NewDB(context.Background(), postgresql.Config{URI: uri})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close(context.Background()) })
+
+	name := "test_cdc_" + xid.New().String()
+	cfg := Config{
+		SlotName:              name,
+		Publication:           name,
+		StatusIntervalSeconds: 1,
+	}
+	t.Cleanup(func() {
+		_, _ = db.Exec(context.Background(), "SELECT pg_drop_replication_slot($1)", name)
+		_, _ = db.Exec(context.Background(), "DROP PUBLICATION IF EXISTS "+name)
+	})
+
+	repo := pg.NewUserRepo(db, nil, false)
+	mb := memory.New(1)
+	source := mb.NewSource("test")
+	if err := source.Subscribe(userTopic, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := runPublisher(t, cfg, uri, mb)
+
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator()) })
+	spanCtx := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	ctx := context.Background()
+	user := entity.NewUser("cdc-" + xid.New().String())
+	if _, err := repo.Create(trace.ContextWithSpanContext(ctx, spanCtx), user); err != nil {
+		t.Fatal(err)
+	}
+	user.Name = "renamed"
+	if _, err := repo.Update(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.DeleteByUsername(ctx, user.Username); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []userGen.ChangeType{
+		userGen.ChangeType_CHANGE_TYPE_CREATED,
+		userGen.ChangeType_CHANGE_TYPE_UPDATED,
+		userGen.ChangeType_CHANGE_TYPE_DELETED,
+	} {
+		got, msg := nextEvent(t, source, user.ID)
+		if got.ChangeType != want {
+			t.Errorf("event change type = %v, want %v", got.ChangeType, want)
+		}
+
+		// only the creation is traced
+		_, traced := msg.Header("traceparent")
+		if wantTraced := want == userGen.ChangeType_CHANGE_TYPE_CREATED; traced != wantTraced {
+			t.Errorf("event %v has trace context = %t, want %t", got.ChangeType, traced, wantTraced)
+		}
+	}
+
+	var outbox int
+	if err := db.QueryRow(ctx, "SELECT count(*) FROM outbox WHERE user_id = $1", user.ID).Scan(&outbox); err != nil {
+		t.Fatal(err)
+	}
+	if outbox != 0 {
+		t.Errorf("outbox records = %d, want 0", outbox)
+	}
+
+	// published changes are confirmed to the slot and not sent again after restart
+	stop()
+	next := entity.NewUser("cdc-" + xid.New().String())
+	if _, err := repo.Create(ctx, next); err != nil {
+		t.Fatal(err)
+	}
+	stop = runPublisher(t, cfg, uri, mb)
+	defer stop()
+
+	// events of the deleted user would be read first if they were sent again
+	if got, _ := nextEvent(t, source, user.ID, next.ID); got.Id != next.ID.String() ||
+		got.ChangeType != userGen.ChangeType_CHANGE_TYPE_CREATED {
+		t.Errorf("event after restart = %v %s, want %v %s",
+			got.ChangeType, got.Id, userGen.ChangeType_CHANGE_TYPE_CREATED, next.ID)
+	}
+}
+
+// TestNewPublisherVerifiesSlot runs against a database given by PG_TEST_URI like TestPublisher.
+func TestNewPublisherVerifiesSlot(t *testing.T) {
+	uri := os.Getenv("PG_TEST_URI")
+	if uri == "" {
+		t.Skip("PG_TEST_URI is not set")
+	}
+
+	db, err := postgresql.NewDB(context.Background(), postgresql.Config{URI: uri})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close(context.Background()) })
+
+	// the slot of another plugin can't be streamed by the publisher
+	name := "test_cdc_" + xid.New().String()
+	if _, err := db.Exec(context.Background(),
+		"SELECT pg_create_logical_replication_slot($1, 'test_decoding')", name); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = db.Exec(context.Background(), "SELECT pg_drop_replication_slot($1)", name)
+		_, _ = db.Exec(context.Background(), "DROP PUBLICATION IF EXISTS "+name)
+	})
+
+	cfg := Config{
+		SlotName:              name,
+		Publication:           name,
+		StatusIntervalSeconds: 1,
+	}
+	if _, err := NewPublisher(context.Background(), cfg, uri, memory.New(1).NewSink(), userTopic, zerolog.Nop()); err == nil {
+		t.Error("NewPublisher() error = nil, want error")
+	}
+}
+
+func TestEvent(t *testing.T) {
+	p := publisher{topic: userTopic, fngpnt: "fngpnt", logger: zerolog.Nop()}
+	change := rowChange{
+		kind:      msgUpdate,
+		namespace: "public",
+		table:     usersTable,
+		values:    map[string]string{idColumn: "c1", "name": "alice"},
+	}
+
+	msg := p.event(change, map[string]string{
+		"traceparent": "00-01000000000000000000000000000000-0100000000000000-01",
+		"baggage":     "k=v",
+	})
+	if msg == nil {
+		t.Fatal("event() = nil")
+	}
+	if string(msg.Key) != "c1" || msg.Topic != userTopic {
+		t.Errorf("event() key = %s, topic = %s, want c1, %s", msg.Key, msg.Topic, userTopic)
+	}
+	var keys []string
+	for _, h := range msg.Headers {
+		keys = append(keys, h.Key)
+	}
+	if want := []string{ck.MessageTypeHeaderKey, "baggage", "traceparent"}; !slices.Equal(keys, want) {
+		t.Errorf("event() headers = %v, want %v", keys, want)
+	}
+
+	if msg := p.event(rowChange{kind: msgInsert, table: "outbox", values: map[string]string{idColumn: "1"}}, nil); msg != nil {
+		t.Errorf("event() of other table = %v, want nil", msg)
+	}
+}
+
+// runPublisher runs the publisher to the broker until the returned func is called.
+func runPublisher(t *testing.T, cfg Config, uri string, mb *memory.Broker) func() {
+	t.Helper()
+
+	p, err := NewPublisher(context.Background(), cfg, uri, mb.NewSink(), userTopic, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Run(ctx)
+	}()
+
+	return func() {
+		t.Helper()
+
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	}
+}
+
+// nextEvent returns the next event of any of the users and the message of it,
+// events of other users changed by concurrent tests are skipped.
+func nextEvent(t *testing.T, source broker.Source, ids ...xid.ID) (*userGen.ChangedEvent, *broker.Message) {
+	t.Helper()
+
+	for {
+		msg, err := source.Poll(10 * time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg == nil {
+			t.Fatal("no event published")
+		}
+
+		event := &userGen.ChangedEvent{}
+		if err := proto.Unmarshal(msg.Value, event); err != nil {
+			t.Fatal(err)
+		}
+		if slices.ContainsFunc(ids, func(id xid.ID) bool { return id.String() == event.Id }) {
+			return event, msg
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package pg
+
+import (
+	"errors"
+	"fmt"
+)
+
+type ReplicaConfig struct {
+	// URI is a connection string of the read replica, all reads go to the primary if it is empty
+	URI string `env:"URI"`
+	// MaxLagSeconds is a replication lag above which reads go to the primary
+	MaxLagSeconds float64 `env:"MAX_LAG_SECONDS" envDefault:"5"`
+	// LagCheckIntervalSeconds is an interval between replication lag checks
+	LagCheckIntervalSeconds int `env:"LAG_CHECK_INTERVAL_SECONDS" envDefault:"1"`
+}
+
+// Validate reports all invalid settings at once.
+func (cfg ReplicaConfig) Validate() error {
+	var errs []error
+
+	if cfg.MaxLagSeconds < 0 {
+		errs = append(errs, fmt.Errorf("max lag %gs must not be negative", cfg.MaxLagSeconds))
+	}
+	if cfg.LagCheckIntervalSeconds <= 0 {
+		errs = append(errs, fmt.Errorf("lag check interval %ds must be positive", cfg.LagCheckIntervalSeconds))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid postgresql replica config: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package pg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/caarlos0/env/v11"
+)
+
+func TestReplicaConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr []string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name: "zero lag check interval",
+			env: map[string]string{
+				"LAG_CHECK_INTERVAL_SECONDS": "0",
+			},
+			wantErr: []string{"lag check interval 0s"},
+		},
+		{
+			name: "negative settings",
+			env: map[string]string{
+				"MAX_LAG_SECONDS":            "-1",
+				"LAG_CHECK_INTERVAL_SECONDS": "-1",
+			},
+			wantErr: []string{"max lag -1s", "lag check interval -1s"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			environment := map[string]string{}
+			for k, v := range tt.env {
+				environment[k] = v
+			}
+			cfg, err := env.ParseAsWithOptions[ReplicaConfig](env.Options{Environment: environment})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = cfg.Validate()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() error = nil, want %v", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
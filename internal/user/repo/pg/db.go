@@ -0,0 +1,33 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Karzoug/meower-common-go/postgresql"
+)
+
+// NewDB connects to the primary database with queries traced.
+func NewDB(ctx context.Context, cfg postgresql.Config) (postgresql.DB, error) {
+	const op = "postgresql: new db"
+
+	pgxCfg, err := pgxpool.ParseConfig(cfg.URI)
+	if err != nil {
+		return postgresql.DB{}, fmt.Errorf("%s: %w", op, err)
+	}
+	pgxCfg.ConnConfig.Tracer = newQueryTracer(poolPrimary)
+
+	pool, err := pgxpool.NewWithConfig(ctx, pgxCfg)
+	if err != nil {
+		return postgresql.DB{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return postgresql.DB{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return postgresql.DB{Pool: pool}, nil
+}
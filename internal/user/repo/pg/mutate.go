@@ -2,9 +2,11 @@ package pg
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -12,12 +14,18 @@ import (
 
 	"github.com/Karzoug/meower-user-service/internal/user/entity"
 	repoerr "github.com/Karzoug/meower-user-service/internal/user/repo"
+	"github.com/Karzoug/meower-user-service/internal/user/repo/telemetry"
 )
 
+// changeType is a type of the change recorded in the outbox table, the values are a contract
+// with the outbox relay and the consumers of user events. The update type is recorded on changes
+// of profiles and usernames since the local cache tier is invalidated by them: the relay must publish it
+// as CHANGE_TYPE_UPDATED, consumers that know only create and delete must skip it.
 type changeType string
 
 const (
 	changeTypeCreate changeType = "create"
+	changeTypeUpdate changeType = "update"
 	changeTypeDelete changeType = "delete"
 )
 
@@ -27,17 +35,20 @@ func (r repo) Create(ctx context.Context, user entity.User) (xid.ID, error) {
 		queryCreate = `
 INSERT INTO users (id, username, name, image_url, status_text)
 VALUES (@id, @username, @name, @image_url, @status_text)`
-		queryOutbox = `
-INSERT INTO outbox (change_type, user_id)
-VALUES (@change_type, @user_id)`
 	)
 
+	ctx = withOperation(ctx, op)
+
 	tx, err := r.db.Begin(ctx)
 	if err != nil {
 		return xid.NilID(), fmt.Errorf("%s: %w", op, err)
 	}
 	defer tx.Rollback(context.Background())
 
+	if err := r.emitTraceContext(ctx, tx); err != nil {
+		return xid.NilID(), fmt.Errorf("%s: %w", op, err)
+	}
+
 	tag, err := tx.Exec(ctx, queryCreate,
 		pgx.NamedArgs{
 			"id":          user.ID,
@@ -60,12 +71,7 @@ VALUES (@change_type, @user_id)`
 		return xid.NilID(), repoerr.ErrNoAffected
 	}
 
-	_, err = tx.Exec(ctx, queryOutbox,
-		pgx.NamedArgs{
-			"change_type": changeTypeCreate,
-			"user_id":     user.ID,
-		})
-	if err != nil {
+	if err := r.writeOutbox(ctx, tx, changeTypeCreate, user.ID); err != nil {
 		return xid.NilID(), fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -82,17 +88,20 @@ func (r repo) DeleteByUsername(ctx context.Context, username string) (xid.ID, er
 		queryDelete = `
 DELETE FROM users WHERE username = @username
 RETURNING id`
-		queryOutbox = `
-INSERT INTO outbox (change_type, user_id)
-VALUES (@change_type, @user_id)`
 	)
 
+	ctx = withOperation(ctx, op)
+
 	tx, err := r.db.Begin(ctx)
 	if err != nil {
 		return xid.NilID(), fmt.Errorf("%s: %w", op, err)
 	}
 	defer tx.Rollback(context.Background())
 
+	if err := r.emitTraceContext(ctx, tx); err != nil {
+		return xid.NilID(), fmt.Errorf("%s: %w", op, err)
+	}
+
 	var id xid.ID
 	if err := tx.
 		QueryRow(ctx, queryDelete,
@@ -100,15 +109,13 @@ VALUES (@change_type, @user_id)`
 				"username": username,
 			}).
 		Scan(&id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return xid.NilID(), repoerr.ErrNoAffected
+		}
 		return xid.NilID(), fmt.Errorf("%s: %w", op, err)
 	}
 
-	_, err = tx.Exec(ctx, queryOutbox,
-		pgx.NamedArgs{
-			"change_type": changeTypeDelete,
-			"user_id":     id,
-		})
-	if err != nil {
+	if err := r.writeOutbox(ctx, tx, changeTypeDelete, id); err != nil {
 		return xid.NilID(), fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -119,29 +126,154 @@ VALUES (@change_type, @user_id)`
 	return id, nil
 }
 
-func (r repo) Update(ctx context.Context, user entity.User) error {
+// Update updates the user and returns the new update time of it.
+func (r repo) Update(ctx context.Context, user entity.User) (time.Time, error) {
 	const (
-		op    = "postgresql: update user"
-		query = `
+		op          = "postgresql: update user"
+		queryUpdate = `
 UPDATE users
 SET name = @name, image_url = @image_url, status_text = @status_text
-WHERE id = @id`
+WHERE id = @id
+RETURNING updated_at`
 	)
 
-	tag, err := r.db.Exec(ctx, query,
+	ctx = withOperation(ctx, op)
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(context.Background())
+
+	if err := r.emitTraceContext(ctx, tx); err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var updatedAt time.Time
+	err = tx.QueryRow(ctx, queryUpdate,
 		pgx.NamedArgs{
 			"id":          user.ID,
 			"name":        user.Name,
 			"image_url":   user.ImageURL,
 			"status_text": user.StatusText,
-		})
+		}).Scan(&updatedAt)
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, repoerr.ErrRecordNotFound
+		}
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if tag.RowsAffected() == 0 {
-		return repoerr.ErrRecordNotFound
+	if err := r.writeOutbox(ctx, tx, changeTypeUpdate, user.ID); err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return updatedAt, nil
+}
+
+// UpdateUsername changes the username of the user and returns the id of it.
+func (r repo) UpdateUsername(ctx context.Context, username, newUsername string) (xid.ID, error) {
+	const (
+		op          = "postgresql: update username"
+		queryUpdate = `
+UPDATE users
+SET username = @new_username
+WHERE username = @username
+RETURNING id`
+	)
+
+	ctx = withOperation(ctx, op)
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return xid.NilID(), fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(context.Background())
+
+	if err := r.emitTraceContext(ctx, tx); err != nil {
+		return xid.NilID(), fmt.Errorf("%s: %w", op, err)
+	}
+
+	var id xid.ID
+	if err := tx.
+		QueryRow(ctx, queryUpdate,
+			pgx.NamedArgs{
+				"username":     username,
+				"new_username": newUsername,
+			}).
+		Scan(&id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return xid.NilID(), repoerr.ErrRecordNotFound
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if strings.HasPrefix(pgErr.Code, "23") && pgErr.TableName == "users" {
+				return xid.NilID(), repoerr.ErrRecordAlreadyExists
+			}
+		}
+		return xid.NilID(), fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := r.writeOutbox(ctx, tx, changeTypeUpdate, id); err != nil {
+		return xid.NilID(), fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return xid.NilID(), fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// writeOutbox records the change of the user in the outbox table within the transaction,
+// nothing is written if changes are captured from the WAL instead.
+func (r repo) writeOutbox(ctx context.Context, tx pgx.Tx, ct changeType, id xid.ID) error {
+	const query = `
+INSERT INTO outbox (change_type, user_id, trace_context)
+VALUES (@change_type, @user_id, @trace_context)`
+
+	if !r.outbox {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, query,
+		pgx.NamedArgs{
+			"change_type":   ct,
+			"user_id":       id,
+			"trace_context": telemetry.TraceContext(ctx),
+		})
+
+	return err
+}
+
+// emitTraceContext writes the trace context of the following change of the user to the WAL
+// within the transaction, so the cdc publisher sends it with the event. Nothing is written
+// if the change is recorded in the outbox table or is not traced.
+func (r repo) emitTraceContext(ctx context.Context, tx pgx.Tx) error {
+	const query = `SELECT pg_logical_emit_message(true, @prefix::text, @content::text)`
+
+	if r.outbox {
+		return nil
+	}
+	tc := telemetry.TraceContext(ctx)
+	if len(tc) == 0 {
+		return nil
 	}
 
-	return nil
+	content, err := json.Marshal(tc)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, query,
+		pgx.NamedArgs{
+			"prefix":  telemetry.TraceContextMessagePrefix,
+			"content": string(content),
+		})
+
+	return err
 }
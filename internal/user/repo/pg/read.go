@@ -12,6 +12,7 @@ import (
 	repoerr "github.com/Karzoug/meower-user-service/internal/user/repo"
 )
 
+// GetOne always reads from the primary: the owner must see own writes.
 func (r repo) GetOne(ctx context.Context, id xid.ID) (entity.User, error) {
 	const (
 		op    = "postgresql: gen one user"
@@ -21,6 +22,8 @@ FROM users
 WHERE id = @id`
 	)
 
+	ctx = withOperation(ctx, op)
+
 	row, err := r.db.Query(ctx, query,
 		pgx.NamedArgs{
 			"id": id,
@@ -51,15 +54,17 @@ FROM users
 WHERE id = @id`
 	)
 
-	row, err := r.db.Query(ctx, query,
+	ctx = withOperation(ctx, op)
+
+	var u entity.UserShortProjection
+	err := r.queryReplica(ctx, query,
 		pgx.NamedArgs{
 			"id": id,
+		},
+		func(rows pgx.Rows) (err error) {
+			u, err = pgx.CollectOneRow(rows, pgx.RowToStructByNameLax[entity.UserShortProjection])
+			return err
 		})
-	if err != nil {
-		return entity.UserShortProjection{}, fmt.Errorf("%s: %w", op, err)
-	}
-
-	u, err := pgx.CollectOneRow(row, pgx.RowToStructByNameLax[entity.UserShortProjection])
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return entity.UserShortProjection{}, repoerr.ErrRecordNotFound
@@ -81,15 +86,17 @@ FROM users
 WHERE username = @username`
 	)
 
-	row, err := r.db.Query(ctx, query,
+	ctx = withOperation(ctx, op)
+
+	var u entity.UserShortProjection
+	err := r.queryReplica(ctx, query,
 		pgx.NamedArgs{
 			"username": username,
+		},
+		func(rows pgx.Rows) (err error) {
+			u, err = pgx.CollectOneRow(rows, pgx.RowToStructByNameLax[entity.UserShortProjection])
+			return err
 		})
-	if err != nil {
-		return entity.UserShortProjection{}, fmt.Errorf("%s: %w", op, err)
-	}
-
-	u, err := pgx.CollectOneRow(row, pgx.RowToStructByNameLax[entity.UserShortProjection])
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return entity.UserShortProjection{}, repoerr.ErrRecordNotFound
@@ -111,18 +118,108 @@ FROM users
 WHERE id = any(@ids)`
 	)
 
-	row, err := r.db.Query(ctx, query,
+	ctx = withOperation(ctx, op)
+
+	var us []entity.UserShortProjection
+	err := r.queryReplica(ctx, query,
 		pgx.NamedArgs{
 			"ids": ids,
+		},
+		func(rows pgx.Rows) (err error) {
+			us, err = pgx.CollectRows(rows, pgx.RowToStructByNameLax[entity.UserShortProjection])
+			return err
 		})
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	us, err := pgx.CollectRows(row, pgx.RowToStructByNameLax[entity.UserShortProjection])
+	return us, nil
+}
+
+func (r repo) GetManyShortProjectionsByUsernames(ctx context.Context, usernames []string) ([]entity.UserShortProjection, error) {
+	const (
+		op    = "postgresql: gen many user short projections by usernames"
+		query = `
+SELECT id, username, name, image_url, status_text
+FROM users
+WHERE username = any(@usernames)`
+	)
+
+	ctx = withOperation(ctx, op)
+
+	var us []entity.UserShortProjection
+	err := r.queryReplica(ctx, query,
+		pgx.NamedArgs{
+			"usernames": usernames,
+		},
+		func(rows pgx.Rows) (err error) {
+			us, err = pgx.CollectRows(rows, pgx.RowToStructByNameLax[entity.UserShortProjection])
+			return err
+		})
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
 	return us, nil
 }
+
+// ForEachRecentShortProjections streams up to limit short projections of the most recently updated users
+// and calls fn with batches of them. The rows are not buffered, so a slow fn slows down the stream.
+// If the replica fails in the middle of the stream, it is started again on the primary,
+// so fn may get the same users twice.
+func (r repo) ForEachRecentShortProjections(ctx context.Context,
+	limit, batchSize int,
+	fn func([]entity.UserShortProjection) error,
+) error {
+	const (
+		op    = "postgresql: for each recent user short projection"
+		query = `
+SELECT id, username, name, image_url, status_text
+FROM users
+ORDER BY updated_at DESC
+LIMIT @limit`
+	)
+
+	ctx = withOperation(ctx, op)
+
+	err := r.queryReplica(ctx, query,
+		pgx.NamedArgs{
+			"limit": limit,
+		},
+		func(rows pgx.Rows) error {
+			defer rows.Close()
+
+			batch := make([]entity.UserShortProjection, 0, batchSize)
+			for rows.Next() {
+				u, err := pgx.RowToStructByNameLax[entity.UserShortProjection](rows)
+				if err != nil {
+					return err
+				}
+
+				batch = append(batch, u)
+				if len(batch) < batchSize {
+					continue
+				}
+				if err := fn(batch); err != nil {
+					return stopError{err: err}
+				}
+				batch = make([]entity.UserShortProjection, 0, batchSize)
+			}
+			if err := rows.Err(); err != nil {
+				return err
+			}
+
+			if len(batch) != 0 {
+				if err := fn(batch); err != nil {
+					return stopError{err: err}
+				}
+			}
+
+			return nil
+		})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+// Replica is a read replica pool that is available only while it is reachable
+// and its replication lag is below the maximum.
+type Replica struct {
+	cfg       ReplicaConfig
+	pool      *pgxpool.Pool
+	available atomic.Bool
+	logger    zerolog.Logger
+}
+
+// NewReplica creates a replica pool, it connects lazily:
+// the replica is unavailable until the first successful lag check.
+func NewReplica(cfg ReplicaConfig, logger zerolog.Logger) (*Replica, error) {
+	const op = "postgresql: new replica"
+
+	pgxCfg, err := pgxpool.ParseConfig(cfg.URI)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	pgxCfg.ConnConfig.Tracer = newQueryTracer(poolReplica)
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), pgxCfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Replica{
+		cfg:  cfg,
+		pool: pool,
+		logger: logger.With().
+			Str("component", "postgresql replica").
+			Logger(),
+	}, nil
+}
+
+// Name returns a name of the replica for health checks.
+func (r *Replica) Name() string {
+	return "postgres-replica"
+}
+
+// Available reports whether the replica passed the last lag check.
+func (r *Replica) Available() bool {
+	return r.available.Load()
+}
+
+// Run checks the replication lag until the context is done.
+func (r *Replica) Run(ctx context.Context) error {
+	interval := time.Duration(r.cfg.LagCheckIntervalSeconds) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.check(ctx, interval)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Replica) check(ctx context.Context, timeout time.Duration) {
+	// the replay timestamp does not change while the primary is idle,
+	// so a replica that replayed all received wal is not lagging
+	const query = `
+SELECT CASE
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END::float8`
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var lag float64
+	err := r.pool.QueryRow(ctx, query).Scan(&lag)
+	if ctx.Err() != nil && err != nil {
+		return
+	}
+
+	available := err == nil && lag <= r.cfg.MaxLagSeconds
+	if r.available.Swap(available) == available {
+		return
+	}
+
+	switch {
+	case err != nil:
+		r.logger.Warn().
+			Err(err).
+			Msg("unavailable: reads go to the primary")
+	case !available:
+		r.logger.Warn().
+			Float64("lag seconds", lag).
+			Msg("lagging: reads go to the primary")
+	default:
+		r.logger.Info().
+			Float64("lag seconds", lag).
+			Msg("available: projection reads go to the replica")
+	}
+}
+
+func (r *Replica) Close(_ context.Context) error {
+	r.pool.Close()
+	return nil
+}
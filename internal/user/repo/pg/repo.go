@@ -1,13 +1,70 @@
 package pg
 
 import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+
 	"github.com/Karzoug/meower-common-go/postgresql"
+
+	repoerr "github.com/Karzoug/meower-user-service/internal/user/repo"
 )
 
 type repo struct {
-	db postgresql.DB
+	db      postgresql.DB
+	replica *Replica
+	outbox  bool
+}
+
+// NewUserRepo creates a repository, short projection reads go to the replica
+// while it is available. The replica is optional and may be nil.
+// Changes are recorded in the outbox table only if outbox is true,
+// otherwise they are expected to be captured from the WAL.
+func NewUserRepo(db postgresql.DB, replica *Replica, outbox bool) repo {
+	return repo{
+		db:      db,
+		replica: replica,
+		outbox:  outbox,
+	}
+}
+
+// queryReplica runs a read query on the replica if it is available and reads the rows with read,
+// the query is run again on the primary if the replica is not available or it fails
+// before all rows are read. So read may be called twice and must not keep the state of the first call.
+// Reads started on the replica are recorded to the read source of the context:
+// the replica may lag behind, so the caller must not cache their results for long.
+func (r repo) queryReplica(ctx context.Context, query string, args pgx.NamedArgs, read func(pgx.Rows) error) error {
+	if r.replica != nil && r.replica.Available() {
+		rows, err := r.replica.pool.Query(ctx, query, args)
+		if err == nil {
+			repoerr.MarkReplicaRead(ctx)
+			err = read(rows)
+		}
+
+		var stopErr stopError
+		switch {
+		case err == nil, errors.Is(err, pgx.ErrNoRows), errors.As(err, &stopErr), ctx.Err() != nil:
+			return err
+		}
+	}
+
+	rows, err := r.db.Query(ctx, query, args)
+	if err != nil {
+		return err
+	}
+	return read(rows)
+}
+
+// stopError is an error of the caller that stops reading rows, the query is not run again on it.
+type stopError struct {
+	err error
+}
+
+func (e stopError) Error() string {
+	return e.err.Error()
 }
 
-func NewUserRepo(db postgresql.DB) repo {
-	return repo{db: db}
+func (e stopError) Unwrap() error {
+	return e.err
 }
@@ -0,0 +1,76 @@
+package pg
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+
+	"github.com/Karzoug/meower-common-go/postgresql"
+
+	"github.com/Karzoug/meower-user-service/internal/user/repo/repotest"
+)
+
+// TestConformance runs against a migrated database given by PG_TEST_URI,
+// all users and outbox records are deleted before every test.
+// The database is also used as a replica without lag to run the tests with replica reads.
+func TestConformance(t *testing.T) {
+	uri := os.Getenv("PG_TEST_URI")
+	if uri == "" {
+		t.Skip("PG_TEST_URI is not set")
+	}
+
+	db, err := postgresql.NewDB(context.Background(), postgresql.Config{URI: uri})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close(context.Background()) })
+
+	replica, err := NewReplica(ReplicaConfig{URI: uri, MaxLagSeconds: 1}, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = replica.Close(context.Background()) })
+
+	replica.check(context.Background(), time.Second)
+	if !replica.Available() {
+		t.Fatal("replica is not available")
+	}
+
+	t.Run("primary", func(t *testing.T) {
+		runConformance(t, db, nil)
+	})
+	t.Run("replica", func(t *testing.T) {
+		runConformance(t, db, replica)
+	})
+}
+
+func runConformance(t *testing.T, db postgresql.DB, replica *Replica) {
+	repotest.Run(t, func(t *testing.T) (repotest.Repository, repotest.OutboxFunc) {
+		t.Helper()
+
+		if _, err := db.Exec(context.Background(), "TRUNCATE users, outbox"); err != nil {
+			t.Fatal(err)
+		}
+
+		return NewUserRepo(db, replica, true), func(ctx context.Context, id xid.ID) ([]string, error) {
+			rows, err := db.Query(ctx, `
+SELECT change_type
+FROM outbox
+WHERE user_id = @user_id
+ORDER BY id`,
+				pgx.NamedArgs{
+					"user_id": id,
+				})
+			if err != nil {
+				return nil, err
+			}
+
+			return pgx.CollectRows(rows, pgx.RowTo[string])
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/Karzoug/meower-user-service/internal/user/repo/pg"
+
+const (
+	poolPrimary = "primary"
+	poolReplica = "replica"
+)
+
+type (
+	operationKey  struct{}
+	queryStartKey struct{}
+)
+
+type queryStart struct {
+	span  trace.Span
+	attrs metric.MeasurementOption
+	start time.Time
+}
+
+// withOperation names queries of the context by the repository operation.
+func withOperation(ctx context.Context, op string) context.Context {
+	return context.WithValue(ctx, operationKey{}, op)
+}
+
+// queryTracer starts a span for every query and records query latency and row counts
+// labelled by the repository operation.
+type queryTracer struct {
+	pool     string
+	tracer   trace.Tracer
+	duration metric.Float64Histogram
+	rows     metric.Int64Histogram
+}
+
+func newQueryTracer(pool string) queryTracer {
+	meter := otel.GetMeterProvider().Meter(instrumentationName)
+
+	duration, err := meter.Float64Histogram("db.query.duration",
+		metric.WithDescription("Duration of database queries."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	rows, err := meter.Int64Histogram("db.query.rows",
+		metric.WithDescription("Number of rows returned or affected by database queries."),
+		metric.WithExplicitBucketBoundaries(0, 1, 5, 10, 25, 50, 100, 250, 500, 1000),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return queryTracer{
+		pool:     pool,
+		tracer:   otel.GetTracerProvider().Tracer(instrumentationName),
+		duration: duration,
+		rows:     rows,
+	}
+}
+
+func (t queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	op, ok := ctx.Value(operationKey{}).(string)
+	if !ok {
+		op = "postgresql: query"
+	}
+
+	ctx, span := t.tracer.Start(ctx, op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBQueryText(data.SQL),
+			attribute.String("db.pool", t.pool),
+		))
+
+	return context.WithValue(ctx, queryStartKey{}, queryStart{
+		span: span,
+		attrs: metric.WithAttributeSet(attribute.NewSet(
+			attribute.String("operation", op),
+			attribute.String("pool", t.pool),
+		)),
+		start: time.Now(),
+	})
+}
+
+func (t queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	qs, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+	defer qs.span.End()
+
+	t.duration.Record(ctx, time.Since(qs.start).Seconds(), qs.attrs)
+
+	// no rows is a result of the query, not its failure
+	if data.Err != nil && !errors.Is(data.Err, pgx.ErrNoRows) {
+		qs.span.RecordError(data.Err)
+		qs.span.SetStatus(codes.Error, data.Err.Error())
+		return
+	}
+
+	rows := data.CommandTag.RowsAffected()
+	t.rows.Record(ctx, rows, qs.attrs)
+	qs.span.SetAttributes(attribute.Int64("db.rows", rows))
+}
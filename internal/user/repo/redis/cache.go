@@ -0,0 +1,386 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/rs/xid"
+
+	"github.com/Karzoug/meower-user-service/internal/user/entity"
+	"github.com/Karzoug/meower-user-service/internal/user/repo"
+	"github.com/Karzoug/meower-user-service/internal/user/repo/codec"
+	"github.com/Karzoug/meower-user-service/internal/user/repo/telemetry"
+)
+
+// timeout is a timeout of a single cache call
+const timeout = time.Second
+
+type cache struct {
+	client    goredis.UniversalClient
+	telemetry telemetry.Cache
+}
+
+func NewUserCache(client goredis.UniversalClient) cache {
+	return cache{
+		client:    client,
+		telemetry: telemetry.NewCache("redis"),
+	}
+}
+
+func (c cache) GetOne(ctx context.Context, id xid.ID) (entity.UserShortProjection, error) {
+	ui, _, err := c.GetOneWithExpiration(ctx, id)
+	return ui, err
+}
+
+// GetOneWithExpiration returns a user short projection and the time when the entry expires.
+// The expiration is zero for entries set without ttl.
+func (c cache) GetOneWithExpiration(ctx context.Context, id xid.ID) (_ entity.UserShortProjection, _ time.Time, err error) {
+	const op = "redis: get one user short projection"
+
+	ctx, call := c.telemetry.Start(ctx, op)
+	defer func() { call.End(err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	key := codec.Key(id)
+
+	var (
+		get  *goredis.StringCmd
+		pttl *goredis.DurationCmd
+	)
+	_, err = c.client.Pipelined(ctx, func(p goredis.Pipeliner) error {
+		get = p.Get(ctx, key)
+		pttl = p.PTTL(ctx, key)
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, goredis.Nil) {
+			return entity.UserShortProjection{}, time.Time{}, repo.ErrRecordNotFound
+		}
+		return entity.UserShortProjection{}, time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	b, err := get.Bytes()
+	if err != nil {
+		return entity.UserShortProjection{}, time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if isNotFoundMarker(b) {
+		return entity.UserShortProjection{}, time.Time{}, repo.ErrRecordNotFoundCached
+	}
+
+	ui, err := codec.Decode(b)
+	if err != nil {
+		return entity.UserShortProjection{}, time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var expiresAt time.Time
+	// negative values mean no expiration or the key expired between the commands
+	if ttl := pttl.Val(); ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	return ui, expiresAt, nil
+}
+
+// GetMany returns cached user short projections and ids missed in the cache.
+// Ids that are neither returned nor missed are known to be not found.
+func (c cache) GetMany(ctx context.Context, ids []xid.ID) (users []entity.UserShortProjection, missed []xid.ID, err error) {
+	const op = "redis: get many user short projections"
+
+	if len(ids) == 0 {
+		return []entity.UserShortProjection{}, []xid.ID{}, nil
+	}
+
+	ctx, call := c.telemetry.Start(ctx, op)
+	defer func() {
+		call.SetItems(len(users))
+		call.End(err)
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = codec.Key(id)
+	}
+
+	vals, err := c.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	users = make([]entity.UserShortProjection, 0, len(vals))
+	missed = make([]xid.ID, 0)
+	for i, val := range vals {
+		s, ok := val.(string)
+		if !ok {
+			missed = append(missed, ids[i])
+			continue
+		}
+		if isNotFoundMarker([]byte(s)) {
+			continue
+		}
+
+		ui, err := codec.Decode([]byte(s))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		users = append(users, ui)
+	}
+
+	return users, missed, nil
+}
+
+func (c cache) Set(ctx context.Context, id xid.ID, u entity.UserShortProjection, ttl int32) (err error) {
+	const op = "redis: set user short projection"
+
+	ctx, call := c.telemetry.Start(ctx, op)
+	defer func() { call.End(err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := c.client.Set(ctx, codec.Key(id), codec.Encode(u), expiration(ttl)).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SetMany sets user short projections in a single pipeline.
+func (c cache) SetMany(ctx context.Context, users []entity.UserShortProjection, ttl int32) (err error) {
+	const op = "redis: set many user short projections"
+
+	if len(users) == 0 {
+		return nil
+	}
+
+	ctx, call := c.telemetry.Start(ctx, op)
+	call.SetItems(len(users))
+	defer func() { call.End(err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err = c.client.Pipelined(ctx, func(p goredis.Pipeliner) error {
+		for i := range users {
+			p.Set(ctx, codec.Key(users[i].ID), codec.Encode(users[i]), expiration(ttl))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (c cache) Delete(ctx context.Context, id xid.ID) (err error) {
+	const op = "redis: delete user short projection"
+
+	ctx, call := c.telemetry.Start(ctx, op)
+	defer func() { call.End(err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := c.client.Del(ctx, codec.Key(id)).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SetNotFound replaces the user short projection with a marker that the user does not exist.
+func (c cache) SetNotFound(ctx context.Context, id xid.ID, ttl int32) (err error) {
+	const op = "redis: set user short projection not found"
+
+	ctx, call := c.telemetry.Start(ctx, op)
+	defer func() { call.End(err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := c.client.Set(ctx, codec.Key(id), []byte{}, expiration(ttl)).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (c cache) GetUser(ctx context.Context, id xid.ID) (_ entity.User, err error) {
+	const op = "redis: get user"
+
+	ctx, call := c.telemetry.Start(ctx, op)
+	defer func() { call.End(err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	b, err := c.client.Get(ctx, codec.UserKey(id)).Bytes()
+	if err != nil {
+		if errors.Is(err, goredis.Nil) {
+			return entity.User{}, repo.ErrRecordNotFound
+		}
+		return entity.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	u, err := codec.DecodeUser(b)
+	if err != nil {
+		return entity.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return u, nil
+}
+
+func (c cache) SetUser(ctx context.Context, u entity.User, ttl int32) (err error) {
+	const op = "redis: set user"
+
+	ctx, call := c.telemetry.Start(ctx, op)
+	defer func() { call.End(err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := c.client.Set(ctx, codec.UserKey(u.ID), codec.EncodeUser(u), expiration(ttl)).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (c cache) DeleteUser(ctx context.Context, id xid.ID) (err error) {
+	const op = "redis: delete user"
+
+	ctx, call := c.telemetry.Start(ctx, op)
+	defer func() { call.End(err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := c.client.Del(ctx, codec.UserKey(id)).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (c cache) GetIDByUsername(ctx context.Context, username string) (_ xid.ID, err error) {
+	const op = "redis: get user id by username"
+
+	ctx, call := c.telemetry.Start(ctx, op)
+	defer func() { call.End(err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	b, err := c.client.Get(ctx, codec.UsernameKey(username)).Bytes()
+	if err != nil {
+		if errors.Is(err, goredis.Nil) {
+			return xid.NilID(), repo.ErrRecordNotFound
+		}
+		return xid.NilID(), fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := xid.FromBytes(b)
+	if err != nil {
+		return xid.NilID(), fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (c cache) GetManyIDsByUsernames(ctx context.Context, usernames []string) (ids map[string]xid.ID, missed []string, err error) {
+	const op = "redis: get many user ids by usernames"
+
+	if len(usernames) == 0 {
+		return map[string]xid.ID{}, []string{}, nil
+	}
+
+	ctx, call := c.telemetry.Start(ctx, op)
+	defer func() {
+		call.SetItems(len(ids))
+		call.End(err)
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	keys := make([]string, len(usernames))
+	for i, username := range usernames {
+		keys[i] = codec.UsernameKey(username)
+	}
+
+	vals, err := c.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	ids = make(map[string]xid.ID, len(vals))
+	missed = make([]string, 0)
+	for i, val := range vals {
+		s, ok := val.(string)
+		if !ok {
+			missed = append(missed, usernames[i])
+			continue
+		}
+
+		id, err := xid.FromBytes([]byte(s))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+		ids[usernames[i]] = id
+	}
+
+	return ids, missed, nil
+}
+
+func (c cache) SetIDByUsername(ctx context.Context, username string, id xid.ID, ttl int32) (err error) {
+	const op = "redis: set user id by username"
+
+	ctx, call := c.telemetry.Start(ctx, op)
+	defer func() { call.End(err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := c.client.Set(ctx, codec.UsernameKey(username), id.Bytes(), expiration(ttl)).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (c cache) DeleteIDByUsername(ctx context.Context, username string) (err error) {
+	const op = "redis: delete user id by username"
+
+	ctx, call := c.telemetry.Start(ctx, op)
+	defer func() { call.End(err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := c.client.Del(ctx, codec.UsernameKey(username)).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// expiration converts ttl in seconds to redis expiration, zero means no expiration.
+func expiration(ttl int32) time.Duration {
+	return time.Duration(ttl) * time.Second
+}
+
+// isNotFoundMarker reports whether the value is set by SetNotFound:
+// an encoded user short projection is never empty.
+func isNotFoundMarker(b []byte) bool {
+	return len(b) == 0
+}
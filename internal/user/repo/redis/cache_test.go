@@ -0,0 +1,221 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/rs/xid"
+
+	"github.com/Karzoug/meower-user-service/internal/user/entity"
+	"github.com/Karzoug/meower-user-service/internal/user/repo"
+	"github.com/Karzoug/meower-user-service/internal/user/repo/codec"
+)
+
+func newTestCache(t *testing.T) (cache, *miniredis.Miniredis) {
+	t.Helper()
+
+	srv := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	return NewUserCache(client), srv
+}
+
+func testShortProjection() entity.UserShortProjection {
+	return entity.UserShortProjection{
+		ID:         xid.New(),
+		Username:   "gopher",
+		Name:       "Gopher",
+		ImageURL:   "https://example.com/gopher.png",
+		StatusText: "digging",
+	}
+}
+
+func TestCacheSetGetOne(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestCache(t)
+	u := testShortProjection()
+
+	if _, err := c.GetOne(ctx, u.ID); !errors.Is(err, repo.ErrRecordNotFound) {
+		t.Fatalf("GetOne() before Set error = %v, want %v", err, repo.ErrRecordNotFound)
+	}
+
+	if err := c.Set(ctx, u.ID, u, 60); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	got, expiresAt, err := c.GetOneWithExpiration(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("GetOneWithExpiration() error = %v", err)
+	}
+	if got != u {
+		t.Errorf("GetOneWithExpiration() = %+v, want %+v", got, u)
+	}
+	if d := time.Until(expiresAt); d <= 0 || d > 60*time.Second {
+		t.Errorf("GetOneWithExpiration() expires in %v, want (0, 60s]", d)
+	}
+}
+
+func TestCacheExpiration(t *testing.T) {
+	ctx := context.Background()
+	c, srv := newTestCache(t)
+	u := testShortProjection()
+
+	if err := c.Set(ctx, u.ID, u, 10); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	srv.FastForward(11 * time.Second)
+
+	if _, err := c.GetOne(ctx, u.ID); !errors.Is(err, repo.ErrRecordNotFound) {
+		t.Errorf("GetOne() after ttl error = %v, want %v", err, repo.ErrRecordNotFound)
+	}
+}
+
+func TestCacheDelete(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestCache(t)
+	u := testShortProjection()
+
+	if err := c.Set(ctx, u.ID, u, 60); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := c.Delete(ctx, u.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := c.GetOne(ctx, u.ID); !errors.Is(err, repo.ErrRecordNotFound) {
+		t.Errorf("GetOne() after Delete error = %v, want %v", err, repo.ErrRecordNotFound)
+	}
+
+	// deleting a missing entry is not an error
+	if err := c.Delete(ctx, u.ID); err != nil {
+		t.Errorf("Delete() of missing entry error = %v", err)
+	}
+}
+
+func TestCacheSetNotFound(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestCache(t)
+	u := testShortProjection()
+
+	if err := c.Set(ctx, u.ID, u, 60); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := c.SetNotFound(ctx, u.ID, 60); err != nil {
+		t.Fatalf("SetNotFound() error = %v", err)
+	}
+	if _, err := c.GetOne(ctx, u.ID); !errors.Is(err, repo.ErrRecordNotFoundCached) {
+		t.Errorf("GetOne() after SetNotFound error = %v, want %v", err, repo.ErrRecordNotFoundCached)
+	}
+
+	users, missed, err := c.GetMany(ctx, []xid.ID{u.ID})
+	if err != nil {
+		t.Fatalf("GetMany() error = %v", err)
+	}
+	if len(users) != 0 || len(missed) != 0 {
+		t.Errorf("GetMany() = %v, %v, want no users and no missed ids", users, missed)
+	}
+}
+
+func TestCacheSetManyGetMany(t *testing.T) {
+	ctx := context.Background()
+	c, srv := newTestCache(t)
+
+	u1, u2 := testShortProjection(), testShortProjection()
+	u2.Username = "gopher2"
+	unknown := xid.New()
+
+	if err := c.SetMany(ctx, []entity.UserShortProjection{u1, u2}, 60); err != nil {
+		t.Fatalf("SetMany() error = %v", err)
+	}
+	if ttl := srv.TTL(codec.Key(u1.ID)); ttl != 60*time.Second {
+		t.Errorf("SetMany() ttl = %v, want %v", ttl, 60*time.Second)
+	}
+
+	users, missed, err := c.GetMany(ctx, []xid.ID{u1.ID, unknown, u2.ID})
+	if err != nil {
+		t.Fatalf("GetMany() error = %v", err)
+	}
+	if len(users) != 2 || users[0] != u1 || users[1] != u2 {
+		t.Errorf("GetMany() users = %+v, want %+v", users, []entity.UserShortProjection{u1, u2})
+	}
+	if len(missed) != 1 || missed[0] != unknown {
+		t.Errorf("GetMany() missed = %v, want %v", missed, []xid.ID{unknown})
+	}
+}
+
+func TestCacheUsernameIndex(t *testing.T) {
+	ctx := context.Background()
+	c, srv := newTestCache(t)
+	id := xid.New()
+
+	if err := c.SetIDByUsername(ctx, "gopher", id, 60); err != nil {
+		t.Fatalf("SetIDByUsername() error = %v", err)
+	}
+	// the index is shared with other cache backends
+	if !srv.Exists(codec.UsernameKey("gopher")) {
+		t.Errorf("username index key %q is not set", codec.UsernameKey("gopher"))
+	}
+
+	got, err := c.GetIDByUsername(ctx, "gopher")
+	if err != nil {
+		t.Fatalf("GetIDByUsername() error = %v", err)
+	}
+	if got != id {
+		t.Errorf("GetIDByUsername() = %v, want %v", got, id)
+	}
+
+	ids, missed, err := c.GetManyIDsByUsernames(ctx, []string{"gopher", "unknown"})
+	if err != nil {
+		t.Fatalf("GetManyIDsByUsernames() error = %v", err)
+	}
+	if len(ids) != 1 || ids["gopher"] != id {
+		t.Errorf("GetManyIDsByUsernames() ids = %v, want gopher: %v", ids, id)
+	}
+	if len(missed) != 1 || missed[0] != "unknown" {
+		t.Errorf("GetManyIDsByUsernames() missed = %v, want [unknown]", missed)
+	}
+
+	if err := c.DeleteIDByUsername(ctx, "gopher"); err != nil {
+		t.Fatalf("DeleteIDByUsername() error = %v", err)
+	}
+	if _, err := c.GetIDByUsername(ctx, "gopher"); !errors.Is(err, repo.ErrRecordNotFound) {
+		t.Errorf("GetIDByUsername() after delete error = %v, want %v", err, repo.ErrRecordNotFound)
+	}
+}
+
+func TestCacheUser(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestCache(t)
+	u := entity.User{
+		UserShortProjection: testShortProjection(),
+		UpdatedAt:           time.Now().UTC().Truncate(time.Microsecond),
+	}
+
+	if err := c.SetUser(ctx, u, 60); err != nil {
+		t.Fatalf("SetUser() error = %v", err)
+	}
+
+	got, err := c.GetUser(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	if got.UserShortProjection != u.UserShortProjection || !got.UpdatedAt.Equal(u.UpdatedAt) {
+		t.Errorf("GetUser() = %+v, want %+v", got, u)
+	}
+
+	// the user and its short projection are in different keyspaces
+	if _, err := c.GetOne(ctx, u.ID); !errors.Is(err, repo.ErrRecordNotFound) {
+		t.Errorf("GetOne() error = %v, want %v", err, repo.ErrRecordNotFound)
+	}
+
+	if err := c.DeleteUser(ctx, u.ID); err != nil {
+		t.Fatalf("DeleteUser() error = %v", err)
+	}
+	if _, err := c.GetUser(ctx, u.ID); !errors.Is(err, repo.ErrRecordNotFound) {
+		t.Errorf("GetUser() after DeleteUser error = %v, want %v", err, repo.ErrRecordNotFound)
+	}
+}
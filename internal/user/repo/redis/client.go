@@ -0,0 +1,42 @@
+package redis
+
+import (
+	"context"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+)
+
+type Client struct {
+	goredis.UniversalClient
+}
+
+// NewClient creates redis client: a cluster client if more than one address is given.
+func NewClient(ctx context.Context, cfg Config, logger zerolog.Logger) Client {
+	c := goredis.NewUniversalClient(&goredis.UniversalOptions{
+		Addrs:    cfg.Addresses,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	logger = logger.With().
+		Str("component", "redis client").
+		Logger()
+	if err := c.Ping(ctx).Err(); err != nil {
+		// problem with redis may be temporarily
+		logger.Warn().
+			Strs("addresses", cfg.Addresses).
+			Err(err).
+			Msg("ping: failed")
+	} else {
+		logger.Info().
+			Msg("ping: ok")
+	}
+
+	return Client{c}
+}
+
+func (c Client) Close(_ context.Context) error {
+	return c.UniversalClient.Close()
+}
@@ -0,0 +1,8 @@
+package redis
+
+type Config struct {
+	Addresses []string `env:"ADDRESSES,notEmpty" envSeparator:","`
+	Username  string   `env:"USERNAME"`
+	Password  string   `env:"PASSWORD"`
+	DB        int      `env:"DB" envDefault:"0"`
+}
@@ -0,0 +1,366 @@
+// Package repotest is a conformance test suite of user repository implementations:
+// all of them must pass it, so their behaviour can't drift apart.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+
+	"github.com/Karzoug/meower-user-service/internal/user/entity"
+	repoerr "github.com/Karzoug/meower-user-service/internal/user/repo"
+)
+
+// Repository is a user repository under test.
+type Repository interface {
+	Create(ctx context.Context, user entity.User) (xid.ID, error)
+	GetOne(ctx context.Context, id xid.ID) (entity.User, error)
+	GetOneShortProjection(ctx context.Context, id xid.ID) (entity.UserShortProjection, error)
+	GetOneShortProjectionByUsername(ctx context.Context, username string) (entity.UserShortProjection, error)
+	GetManyShortProjections(ctx context.Context, ids []xid.ID) ([]entity.UserShortProjection, error)
+	GetManyShortProjectionsByUsernames(ctx context.Context, usernames []string) ([]entity.UserShortProjection, error)
+	Update(ctx context.Context, u entity.User) (time.Time, error)
+	UpdateUsername(ctx context.Context, username, newUsername string) (xid.ID, error)
+	DeleteByUsername(ctx context.Context, username string) (xid.ID, error)
+	ForEachRecentShortProjections(ctx context.Context, limit, batchSize int, fn func([]entity.UserShortProjection) error) error
+}
+
+// OutboxFunc returns change types recorded to the outbox for the user in the order of changes.
+type OutboxFunc func(ctx context.Context, id xid.ID) ([]string, error)
+
+// NewFunc returns an empty repository and a function to read its outbox.
+type NewFunc func(t *testing.T) (Repository, OutboxFunc)
+
+// Run runs the conformance test suite, every test gets an empty repository.
+func Run(t *testing.T, newRepo NewFunc) {
+	t.Helper()
+
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, r Repository, outbox OutboxFunc)
+	}{
+		{"create and get", testCreateAndGet},
+		{"create duplicate", testCreateDuplicate},
+		{"get not found", testGetNotFound},
+		{"get many", testGetMany},
+		{"update", testUpdate},
+		{"update not found", testUpdateNotFound},
+		{"update username", testUpdateUsername},
+		{"update username conflict", testUpdateUsernameConflict},
+		{"delete", testDelete},
+		{"delete not found", testDeleteNotFound},
+		{"outbox", testOutbox},
+		{"for each recent", testForEachRecent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, outbox := newRepo(t)
+			tt.fn(t, r, outbox)
+		})
+	}
+}
+
+func testCreateAndGet(t *testing.T, r Repository, _ OutboxFunc) {
+	ctx := context.Background()
+	u := entity.NewUser("alice")
+
+	before := time.Now().Add(-time.Second)
+	id, err := r.Create(ctx, u)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if id != u.ID {
+		t.Errorf("Create() id = %v, want %v", id, u.ID)
+	}
+
+	got, err := r.GetOne(ctx, id)
+	if err != nil {
+		t.Fatalf("GetOne() error = %v", err)
+	}
+	if got.UserShortProjection != u.UserShortProjection {
+		t.Errorf("GetOne() = %+v, want %+v", got.UserShortProjection, u.UserShortProjection)
+	}
+	if got.UpdatedAt.Before(before) {
+		t.Errorf("GetOne() updated at = %v, want after %v", got.UpdatedAt, before)
+	}
+
+	short, err := r.GetOneShortProjection(ctx, id)
+	if err != nil {
+		t.Fatalf("GetOneShortProjection() error = %v", err)
+	}
+	if short != u.UserShortProjection {
+		t.Errorf("GetOneShortProjection() = %+v, want %+v", short, u.UserShortProjection)
+	}
+
+	short, err = r.GetOneShortProjectionByUsername(ctx, u.Username)
+	if err != nil {
+		t.Fatalf("GetOneShortProjectionByUsername() error = %v", err)
+	}
+	if short != u.UserShortProjection {
+		t.Errorf("GetOneShortProjectionByUsername() = %+v, want %+v", short, u.UserShortProjection)
+	}
+}
+
+func testCreateDuplicate(t *testing.T, r Repository, _ OutboxFunc) {
+	ctx := context.Background()
+	u := entity.NewUser("alice")
+
+	if _, err := r.Create(ctx, u); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if _, err := r.Create(ctx, entity.NewUser(u.Username)); !errors.Is(err, repoerr.ErrRecordAlreadyExists) {
+		t.Errorf("Create() with the same username error = %v, want %v", err, repoerr.ErrRecordAlreadyExists)
+	}
+
+	same := u
+	same.Username = "bob"
+	if _, err := r.Create(ctx, same); !errors.Is(err, repoerr.ErrRecordAlreadyExists) {
+		t.Errorf("Create() with the same id error = %v, want %v", err, repoerr.ErrRecordAlreadyExists)
+	}
+}
+
+func testGetNotFound(t *testing.T, r Repository, _ OutboxFunc) {
+	ctx := context.Background()
+
+	if _, err := r.GetOne(ctx, xid.New()); !errors.Is(err, repoerr.ErrRecordNotFound) {
+		t.Errorf("GetOne() error = %v, want %v", err, repoerr.ErrRecordNotFound)
+	}
+	if _, err := r.GetOneShortProjection(ctx, xid.New()); !errors.Is(err, repoerr.ErrRecordNotFound) {
+		t.Errorf("GetOneShortProjection() error = %v, want %v", err, repoerr.ErrRecordNotFound)
+	}
+	if _, err := r.GetOneShortProjectionByUsername(ctx, "unknown"); !errors.Is(err, repoerr.ErrRecordNotFound) {
+		t.Errorf("GetOneShortProjectionByUsername() error = %v, want %v", err, repoerr.ErrRecordNotFound)
+	}
+}
+
+func testGetMany(t *testing.T, r Repository, _ OutboxFunc) {
+	ctx := context.Background()
+	alice, bob := create(t, r, "alice"), create(t, r, "bob")
+
+	users, err := r.GetManyShortProjections(ctx, []xid.ID{bob.ID, xid.New(), alice.ID, bob.ID})
+	if err != nil {
+		t.Fatalf("GetManyShortProjections() error = %v", err)
+	}
+	assertSameUsers(t, "GetManyShortProjections()", users, alice.UserShortProjection, bob.UserShortProjection)
+
+	users, err = r.GetManyShortProjectionsByUsernames(ctx, []string{"bob", "unknown", "alice", "bob"})
+	if err != nil {
+		t.Fatalf("GetManyShortProjectionsByUsernames() error = %v", err)
+	}
+	assertSameUsers(t, "GetManyShortProjectionsByUsernames()", users, alice.UserShortProjection, bob.UserShortProjection)
+}
+
+func testUpdate(t *testing.T, r Repository, _ OutboxFunc) {
+	ctx := context.Background()
+	u := create(t, r, "alice")
+
+	upd := u
+	upd.Username = "ignored"
+	upd.Name = "Alice Liddell"
+	upd.ImageURL = "https://example.com/alice.png"
+	upd.StatusText = "down the rabbit hole"
+
+	updatedAt, err := r.Update(ctx, upd)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if updatedAt.Before(u.UpdatedAt) {
+		t.Errorf("Update() updated at = %v, want not before %v", updatedAt, u.UpdatedAt)
+	}
+
+	got, err := r.GetOne(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("GetOne() error = %v", err)
+	}
+
+	// the username is not changed by update
+	want := upd.UserShortProjection
+	want.Username = u.Username
+	if got.UserShortProjection != want {
+		t.Errorf("GetOne() after Update = %+v, want %+v", got.UserShortProjection, want)
+	}
+	if !got.UpdatedAt.Equal(updatedAt) {
+		t.Errorf("GetOne() updated at = %v, want %v", got.UpdatedAt, updatedAt)
+	}
+}
+
+func testUpdateNotFound(t *testing.T, r Repository, _ OutboxFunc) {
+	if _, err := r.Update(context.Background(), entity.NewUser("alice")); !errors.Is(err, repoerr.ErrRecordNotFound) {
+		t.Errorf("Update() error = %v, want %v", err, repoerr.ErrRecordNotFound)
+	}
+}
+
+func testUpdateUsername(t *testing.T, r Repository, outbox OutboxFunc) {
+	ctx := context.Background()
+	u := create(t, r, "alice")
+
+	id, err := r.UpdateUsername(ctx, u.Username, "alice2")
+	if err != nil {
+		t.Fatalf("UpdateUsername() error = %v", err)
+	}
+	if id != u.ID {
+		t.Errorf("UpdateUsername() id = %v, want %v", id, u.ID)
+	}
+
+	got, err := r.GetOneShortProjectionByUsername(ctx, "alice2")
+	if err != nil {
+		t.Fatalf("GetOneShortProjectionByUsername() with the new username error = %v", err)
+	}
+	if got.ID != u.ID {
+		t.Errorf("GetOneShortProjectionByUsername() id = %v, want %v", got.ID, u.ID)
+	}
+	if _, err := r.GetOneShortProjectionByUsername(ctx, u.Username); !errors.Is(err, repoerr.ErrRecordNotFound) {
+		t.Errorf("GetOneShortProjectionByUsername() with the old username error = %v, want %v", err, repoerr.ErrRecordNotFound)
+	}
+
+	changes, err := outbox(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("outbox error = %v", err)
+	}
+	if want := []string{"create", "update"}; !slices.Equal(changes, want) {
+		t.Errorf("outbox = %v, want %v", changes, want)
+	}
+
+	if _, err := r.UpdateUsername(ctx, "unknown", "bob"); !errors.Is(err, repoerr.ErrRecordNotFound) {
+		t.Errorf("UpdateUsername() of unknown user error = %v, want %v", err, repoerr.ErrRecordNotFound)
+	}
+}
+
+func testUpdateUsernameConflict(t *testing.T, r Repository, _ OutboxFunc) {
+	ctx := context.Background()
+	alice, bob := create(t, r, "alice"), create(t, r, "bob")
+
+	if _, err := r.UpdateUsername(ctx, alice.Username, bob.Username); !errors.Is(err, repoerr.ErrRecordAlreadyExists) {
+		t.Errorf("UpdateUsername() to the taken username error = %v, want %v", err, repoerr.ErrRecordAlreadyExists)
+	}
+
+	got, err := r.GetOneShortProjectionByUsername(ctx, alice.Username)
+	if err != nil {
+		t.Fatalf("GetOneShortProjectionByUsername() error = %v", err)
+	}
+	if got.ID != alice.ID {
+		t.Errorf("GetOneShortProjectionByUsername() id = %v, want %v", got.ID, alice.ID)
+	}
+}
+
+func testDelete(t *testing.T, r Repository, _ OutboxFunc) {
+	ctx := context.Background()
+	u := create(t, r, "alice")
+
+	id, err := r.DeleteByUsername(ctx, u.Username)
+	if err != nil {
+		t.Fatalf("DeleteByUsername() error = %v", err)
+	}
+	if id != u.ID {
+		t.Errorf("DeleteByUsername() id = %v, want %v", id, u.ID)
+	}
+
+	if _, err := r.GetOne(ctx, u.ID); !errors.Is(err, repoerr.ErrRecordNotFound) {
+		t.Errorf("GetOne() after DeleteByUsername error = %v, want %v", err, repoerr.ErrRecordNotFound)
+	}
+
+	// the username is free again
+	if _, err := r.Create(ctx, entity.NewUser(u.Username)); err != nil {
+		t.Errorf("Create() after DeleteByUsername error = %v", err)
+	}
+}
+
+func testDeleteNotFound(t *testing.T, r Repository, _ OutboxFunc) {
+	if _, err := r.DeleteByUsername(context.Background(), "unknown"); !errors.Is(err, repoerr.ErrNoAffected) {
+		t.Errorf("DeleteByUsername() error = %v, want %v", err, repoerr.ErrNoAffected)
+	}
+}
+
+func testOutbox(t *testing.T, r Repository, outbox OutboxFunc) {
+	ctx := context.Background()
+	u := create(t, r, "alice")
+
+	if _, err := r.Update(ctx, u); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if _, err := r.DeleteByUsername(ctx, u.Username); err != nil {
+		t.Fatalf("DeleteByUsername() error = %v", err)
+	}
+
+	// failed changes are not recorded
+	_, _ = r.Create(ctx, entity.NewUser("bob"))
+	_, _ = r.Create(ctx, entity.NewUser("bob"))
+	_, _ = r.Update(ctx, entity.NewUser("carol"))
+	_, _ = r.DeleteByUsername(ctx, "carol")
+
+	changes, err := outbox(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("outbox error = %v", err)
+	}
+	if want := []string{"create", "update", "delete"}; !slices.Equal(changes, want) {
+		t.Errorf("outbox = %v, want %v", changes, want)
+	}
+}
+
+func testForEachRecent(t *testing.T, r Repository, _ OutboxFunc) {
+	ctx := context.Background()
+	alice, bob, carol := create(t, r, "alice"), create(t, r, "bob"), create(t, r, "carol")
+
+	// make the update order differ from the creation order
+	for _, u := range []entity.User{bob, carol, alice} {
+		time.Sleep(2 * time.Millisecond)
+		if _, err := r.Update(ctx, u); err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+	}
+
+	var batches [][]entity.UserShortProjection
+	err := r.ForEachRecentShortProjections(ctx, 2, 1, func(users []entity.UserShortProjection) error {
+		batches = append(batches, slices.Clone(users))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachRecentShortProjections() error = %v", err)
+	}
+
+	want := [][]entity.UserShortProjection{{alice.UserShortProjection}, {carol.UserShortProjection}}
+	if !slices.EqualFunc(batches, want, slices.Equal) {
+		t.Errorf("ForEachRecentShortProjections() batches = %+v, want %+v", batches, want)
+	}
+
+	errStop := errors.New("stop")
+	err = r.ForEachRecentShortProjections(ctx, 10, 2, func([]entity.UserShortProjection) error {
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("ForEachRecentShortProjections() error = %v, want %v", err, errStop)
+	}
+}
+
+func create(t *testing.T, r Repository, username string) entity.User {
+	t.Helper()
+
+	u := entity.NewUser(username)
+	if _, err := r.Create(context.Background(), u); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	got, err := r.GetOne(context.Background(), u.ID)
+	if err != nil {
+		t.Fatalf("GetOne() error = %v", err)
+	}
+
+	return got
+}
+
+func assertSameUsers(t *testing.T, call string, got []entity.UserShortProjection, want ...entity.UserShortProjection) {
+	t.Helper()
+
+	byID := func(a, b entity.UserShortProjection) int { return a.ID.Compare(b.ID) }
+	got = slices.SortedFunc(slices.Values(got), byID)
+	want = slices.SortedFunc(slices.Values(want), byID)
+
+	if !slices.Equal(got, want) {
+		t.Errorf("%s = %+v, want %+v", call, got, want)
+	}
+}
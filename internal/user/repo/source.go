@@ -0,0 +1,32 @@
+package repo
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// ReadSource records whether reads made with a context were served by a read replica:
+// the caller decides by it how long the result may be cached.
+type ReadSource struct {
+	replica atomic.Bool
+}
+
+type readSourceKey struct{}
+
+// WithReadSource returns the context that records the source of reads made with it.
+func WithReadSource(ctx context.Context) (context.Context, *ReadSource) {
+	src := &ReadSource{}
+	return context.WithValue(ctx, readSourceKey{}, src), src
+}
+
+// MarkReplicaRead is called by repositories when a read made with the context is served by a replica.
+func MarkReplicaRead(ctx context.Context) {
+	if src, ok := ctx.Value(readSourceKey{}).(*ReadSource); ok {
+		src.replica.Store(true)
+	}
+}
+
+// FromReplica reports whether any of the reads was served by a replica, a replica may lag behind.
+func (s *ReadSource) FromReplica() bool {
+	return s != nil && s.replica.Load()
+}
@@ -0,0 +1,126 @@
+// Package telemetry records spans and metrics of shared cache calls
+// and propagates trace context of user changes.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Karzoug/meower-user-service/internal/user/repo"
+)
+
+const instrumentationName = "github.com/Karzoug/meower-user-service/internal/user/repo/telemetry"
+
+const (
+	statusOK    = "ok"
+	statusMiss  = "miss"
+	statusError = "error"
+)
+
+// Cache records spans and metrics of calls to a shared cache.
+type Cache struct {
+	system   string
+	tracer   trace.Tracer
+	duration metric.Float64Histogram
+	items    metric.Int64Histogram
+}
+
+// NewCache creates a recorder of calls to the cache system, e.g. memcached.
+func NewCache(system string) Cache {
+	meter := otel.GetMeterProvider().Meter(instrumentationName)
+
+	duration, err := meter.Float64Histogram("cache.duration",
+		metric.WithDescription("Duration of shared cache calls."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	items, err := meter.Int64Histogram("cache.items",
+		metric.WithDescription("Number of entries read or written by one multi-key shared cache call."),
+		metric.WithExplicitBucketBoundaries(0, 1, 5, 10, 25, 50, 100, 250, 500, 1000),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return Cache{
+		system:   system,
+		tracer:   otel.GetTracerProvider().Tracer(instrumentationName),
+		duration: duration,
+		items:    items,
+	}
+}
+
+// Call is a cache call in progress.
+type Call struct {
+	ctx   context.Context //nolint:containedctx
+	c     Cache
+	op    string
+	span  trace.Span
+	start time.Time
+	items int
+	multi bool
+}
+
+// Start starts a span of the cache operation op, the call must be ended by End.
+func (c Cache) Start(ctx context.Context, op string) (context.Context, *Call) {
+	ctx, span := c.tracer.Start(ctx, op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("cache.system", c.system)))
+
+	return ctx, &Call{
+		ctx:   ctx,
+		c:     c,
+		op:    op,
+		span:  span,
+		start: time.Now(),
+	}
+}
+
+// SetItems sets the number of entries read or written by a multi-key call.
+func (call *Call) SetItems(n int) {
+	call.items = n
+	call.multi = true
+}
+
+// End ends the span and records the call. A not found error is a miss, not a failure.
+func (call *Call) End(err error) {
+	defer call.span.End()
+
+	status := statusOK
+	switch {
+	case err == nil:
+	case errors.Is(err, repo.ErrRecordNotFound), errors.Is(err, repo.ErrRecordNotFoundCached):
+		status = statusMiss
+	default:
+		status = statusError
+		call.span.RecordError(err)
+		call.span.SetStatus(codes.Error, err.Error())
+	}
+	call.span.SetAttributes(attribute.String("cache.status", status))
+
+	attrs := metric.WithAttributeSet(attribute.NewSet(
+		attribute.String("system", call.c.system),
+		attribute.String("operation", call.op),
+		attribute.String("status", status),
+	))
+	call.c.duration.Record(call.ctx, time.Since(call.start).Seconds(), attrs)
+
+	if call.multi {
+		call.span.SetAttributes(attribute.Int("cache.items", call.items))
+		call.c.items.Record(call.ctx, int64(call.items), metric.WithAttributeSet(attribute.NewSet(
+			attribute.String("system", call.c.system),
+			attribute.String("operation", call.op),
+		)))
+	}
+}
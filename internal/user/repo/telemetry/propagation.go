@@ -0,0 +1,26 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceContextMessagePrefix is the prefix of logical decoding messages with the trace context
+// of the following user change, they are written to the WAL when changes are captured from it.
+const TraceContextMessagePrefix = "meower-user-service/trace-context"
+
+// TraceContext returns the trace context of a user change to be sent with the user change event
+// by the outbox service or the cdc publisher, it is nil if the change is not traced.
+func TraceContext(ctx context.Context) map[string]string {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil
+	}
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	return carrier
+}
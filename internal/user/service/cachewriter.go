@@ -0,0 +1,374 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+
+	"github.com/Karzoug/meower-user-service/internal/user/entity"
+	repoerr "github.com/Karzoug/meower-user-service/internal/user/repo"
+)
+
+// maxCacheWriteAge limits how long a value read from the repository may wait to be written
+// to the cache: forgotten entries are remembered only for this time.
+const maxCacheWriteAge = time.Minute
+
+type cacheWriteKind int
+
+const (
+	writeShortProjection cacheWriteKind = iota
+	writeNotFound
+	writeIDByUsername
+	writeUser
+)
+
+// generation orders reads of the repository against invalidations of cache entries:
+// a value read under a generation older than the invalidation of the entry is stale.
+// The source records whether the value was read from a replica, such values are cached for a short time.
+type generation struct {
+	n      uint64
+	at     time.Time
+	source *repoerr.ReadSource
+}
+
+type cacheWrite struct {
+	gen      generation
+	kind     cacheWriteKind
+	id       xid.ID
+	username string
+	user     entity.UserShortProjection
+	fullUser entity.User
+}
+
+// key identifies the cache entry: a later write to the same entry replaces a pending one.
+func (cw cacheWrite) key() string {
+	switch cw.kind {
+	case writeIDByUsername:
+		return usernameWriteKey(cw.username)
+	case writeUser:
+		return userWriteKey(cw.id)
+	default:
+		return idWriteKey(cw.id)
+	}
+}
+
+func idWriteKey(id xid.ID) string {
+	return "id:" + id.String()
+}
+
+func usernameWriteKey(username string) string {
+	return "username:" + username
+}
+
+func userWriteKey(id xid.ID) string {
+	return "user:" + id.String()
+}
+
+// cacheWriter writes to the cache asynchronously by a fixed pool of workers.
+// Pending writes to the same entry are coalesced, writes are dropped when the queue is full.
+// Every write carries the generation captured before the value was read from the repository,
+// writes of entries forgotten after that are dropped.
+type cacheWriter struct {
+	cfg     Config
+	cache   shortProjectionsCache
+	metrics metrics
+	logger  zerolog.Logger
+
+	mu        sync.Mutex
+	written   *sync.Cond
+	closed    bool
+	gen       uint64
+	forgotten map[string]generation
+	swept     time.Time
+	writing   map[string]int
+	pending   map[string]cacheWrite
+	queue     chan string
+	wg        sync.WaitGroup
+}
+
+func newCacheWriter(cfg Config, cache shortProjectionsCache, metrics metrics, logger zerolog.Logger) *cacheWriter {
+	w := &cacheWriter{
+		cfg:       cfg,
+		cache:     cache,
+		metrics:   metrics,
+		logger:    logger,
+		forgotten: make(map[string]generation),
+		swept:     time.Now(),
+		writing:   make(map[string]int),
+		pending:   make(map[string]cacheWrite, cfg.CacheWriter.QueueSize),
+		queue:     make(chan string, cfg.CacheWriter.QueueSize),
+	}
+	w.written = sync.NewCond(&w.mu)
+
+	w.wg.Add(cfg.CacheWriter.Workers)
+	for range cfg.CacheWriter.Workers {
+		go w.work()
+	}
+
+	return w
+}
+
+// capture returns the current generation and the context recording the source of reads,
+// it must be called before the value that is set to the cache later is read from the repository
+// with the returned context.
+func (w *cacheWriter) capture(ctx context.Context) (context.Context, generation) {
+	ctx, source := repoerr.WithReadSource(ctx)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return ctx, generation{n: w.gen, at: time.Now(), source: source}
+}
+
+// ttl returns the ttl of the entry written by cw: values read from a replica
+// may be stale, so they are not cached longer than the replica ttl.
+func (w *cacheWriter) ttl(cw cacheWrite, ttl int32) int32 {
+	if cw.gen.source.FromReplica() {
+		return min(ttl, w.cfg.Cache.ReplicaTTLSeconds)
+	}
+	return ttl
+}
+
+func (w *cacheWriter) setShortProjection(gen generation, u entity.UserShortProjection) {
+	w.enqueue(cacheWrite{gen: gen, kind: writeShortProjection, id: u.ID, user: u})
+}
+
+func (w *cacheWriter) setNotFound(gen generation, id xid.ID) {
+	w.enqueue(cacheWrite{gen: gen, kind: writeNotFound, id: id})
+}
+
+func (w *cacheWriter) setIDByUsername(gen generation, username string, id xid.ID) {
+	w.enqueue(cacheWrite{gen: gen, kind: writeIDByUsername, id: id, username: username})
+}
+
+func (w *cacheWriter) setUser(gen generation, u entity.User) {
+	w.enqueue(cacheWrite{gen: gen, kind: writeUser, id: u.ID, fullUser: u})
+}
+
+// setShortProjectionsNow writes the short projections to the cache synchronously except
+// the ones forgotten since the generation was captured. It returns the number of written projections.
+func (w *cacheWriter) setShortProjectionsNow(gen generation, users []entity.UserShortProjection) (int, error) {
+	batch := make([]cacheWrite, 0, len(users))
+
+	w.mu.Lock()
+	for i := range users {
+		cw := cacheWrite{gen: gen, kind: writeShortProjection, id: users[i].ID, user: users[i]}
+		if w.isStale(cw) {
+			w.metrics.cacheWritesDropped.Add(context.Background(), 1)
+			continue
+		}
+		w.writing[cw.key()]++
+		batch = append(batch, cw)
+	}
+	w.mu.Unlock()
+
+	return w.write(batch)
+}
+
+// forget cancels writes of the entry read before the call and waits for the write of it
+// that is in progress, so the entry may be invalidated in the cache after that.
+// It must be called when the entry is invalidated, otherwise a stale value may be written after the invalidation.
+func (w *cacheWriter) forget(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.gen++
+	now := time.Now()
+	w.forgotten[key] = generation{n: w.gen, at: now}
+	delete(w.pending, key)
+
+	if now.Sub(w.swept) > maxCacheWriteAge {
+		for k, gen := range w.forgotten {
+			if now.Sub(gen.at) > maxCacheWriteAge {
+				delete(w.forgotten, k)
+			}
+		}
+		w.swept = now
+	}
+
+	for w.writing[key] > 0 {
+		w.written.Wait()
+	}
+}
+
+// isStale reports whether the value of the write was read before the entry was forgotten,
+// values that are too old are stale too: the entry may be forgotten and swept since then.
+// It must be called with the lock held.
+func (w *cacheWriter) isStale(cw cacheWrite) bool {
+	if time.Since(cw.gen.at) > maxCacheWriteAge {
+		return true
+	}
+	forgotten, ok := w.forgotten[cw.key()]
+	return ok && cw.gen.n < forgotten.n
+}
+
+func (w *cacheWriter) enqueue(cw cacheWrite) {
+	key := cw.key()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed || w.isStale(cw) {
+		w.metrics.cacheWritesDropped.Add(context.Background(), 1)
+		return
+	}
+
+	if queued, ok := w.pending[key]; ok {
+		// the value read later is not older
+		if cw.gen.n >= queued.gen.n {
+			w.pending[key] = cw
+		}
+		w.metrics.cacheWritesCoalesced.Add(context.Background(), 1)
+		return
+	}
+
+	select {
+	case w.queue <- key:
+		w.pending[key] = cw
+	default:
+		w.metrics.cacheWritesDropped.Add(context.Background(), 1)
+	}
+}
+
+func (w *cacheWriter) work() {
+	defer w.wg.Done()
+
+	batch := make([]cacheWrite, 0, w.cfg.CacheWriter.BatchSize)
+	for key := range w.queue {
+		batch = w.take(batch[:0], key)
+
+		// take more of already queued writes without waiting
+	fill:
+		for len(batch) < w.cfg.CacheWriter.BatchSize {
+			select {
+			case next, ok := <-w.queue:
+				if !ok {
+					break fill
+				}
+				batch = w.take(batch, next)
+			default:
+				break fill
+			}
+		}
+
+		if _, err := w.write(batch); err != nil {
+			w.logger.Error().
+				Err(err).
+				Msg("write to cache failed")
+		}
+	}
+}
+
+func (w *cacheWriter) take(batch []cacheWrite, key string) []cacheWrite {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	cw, ok := w.pending[key]
+	if !ok { // forgotten
+		return batch
+	}
+	delete(w.pending, key)
+	if w.isStale(cw) {
+		w.metrics.cacheWritesDropped.Add(context.Background(), 1)
+		return batch
+	}
+	w.writing[key]++
+
+	return append(batch, cw)
+}
+
+// write writes the batch to the cache, the entries are marked as being written by take
+// and are released after it. It returns the number of written entries.
+func (w *cacheWriter) write(batch []cacheWrite) (int, error) {
+	// writes outlive requests that caused them
+	ctx := context.Background()
+
+	defer func() {
+		w.mu.Lock()
+		for _, cw := range batch {
+			key := cw.key()
+			if w.writing[key]--; w.writing[key] == 0 {
+				delete(w.writing, key)
+			}
+		}
+		w.mu.Unlock()
+		w.written.Broadcast()
+	}()
+
+	// the entries may be forgotten since they were taken
+	w.mu.Lock()
+	valid := make([]cacheWrite, 0, len(batch))
+	for _, cw := range batch {
+		if w.isStale(cw) {
+			w.metrics.cacheWritesDropped.Add(context.Background(), 1)
+			continue
+		}
+		valid = append(valid, cw)
+	}
+	w.mu.Unlock()
+
+	// short projections are set at once for every ttl
+	users := make(map[int32][]entity.UserShortProjection, 1)
+	n := len(valid)
+	var errs []error
+	for _, cw := range valid {
+		switch cw.kind {
+		case writeShortProjection:
+			ttl := w.ttl(cw, w.cfg.Cache.TTLSeconds)
+			users[ttl] = append(users[ttl], cw.user)
+		case writeNotFound:
+			if err := w.cache.SetNotFound(ctx, cw.id, w.ttl(cw, w.cfg.Cache.NotFoundTTLSeconds)); err != nil {
+				errs = append(errs, fmt.Errorf("set not found short user info: %w", err))
+				n--
+			}
+		case writeIDByUsername:
+			if err := w.cache.SetIDByUsername(ctx, cw.username, cw.id, w.ttl(cw, w.cfg.Cache.UsernameTTLSeconds)); err != nil {
+				errs = append(errs, fmt.Errorf("set user id by username: %w", err))
+				n--
+			}
+		case writeUser:
+			if err := w.cache.SetUser(ctx, cw.fullUser, w.ttl(cw, w.cfg.Cache.UserTTLSeconds)); err != nil {
+				errs = append(errs, fmt.Errorf("set user: %w", err))
+				n--
+			}
+		}
+	}
+
+	for ttl, users := range users {
+		if err := w.cache.SetMany(ctx, users, ttl); err != nil {
+			errs = append(errs, fmt.Errorf("set short users info: %w", err))
+			n -= len(users)
+		}
+	}
+
+	return n, errors.Join(errs...)
+}
+
+// Close stops accepting writes and waits until the queued ones are flushed
+// or the context is done.
+func (w *cacheWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
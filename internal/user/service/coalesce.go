@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/xid"
+
+	"github.com/Karzoug/meower-user-service/internal/user/entity"
+	repoerr "github.com/Karzoug/meower-user-service/internal/user/repo"
+)
+
+// sharedLoadTimeout limits a database lookup shared by concurrent callers:
+// it does not depend on the context of the caller that started it.
+const sharedLoadTimeout = 5 * time.Second
+
+// loadShortProjection gets a short projection from the repository, identical concurrent
+// lookups are coalesced into one. The result is set to the cache only once.
+func (us UserService) loadShortProjection(ctx context.Context, id xid.ID) (entity.UserShortProjection, error) {
+	v, err := us.loadShared(ctx, "id:"+id.String(), func(ctx context.Context) (any, error) {
+		ctx, gen := us.cacheWriter.capture(ctx)
+		user, err := us.repo.GetOneShortProjection(ctx, id)
+		if err != nil {
+			if errors.Is(err, repoerr.ErrRecordNotFound) {
+				us.cacheWriter.setNotFound(gen, id)
+			}
+			return nil, err
+		}
+
+		us.cacheWriter.setShortProjection(gen, user)
+
+		return user, nil
+	})
+	if err != nil {
+		return entity.UserShortProjection{}, err
+	}
+
+	return v.(entity.UserShortProjection), nil
+}
+
+// loadShortProjections gets short projections from the repository, concurrent lookups
+// of the same set of ids are coalesced into one. The result is set to the cache only once.
+func (us UserService) loadShortProjections(ctx context.Context, ids []xid.ID) ([]entity.UserShortProjection, error) {
+	v, err := us.loadShared(ctx, "ids:"+idsKey(ids), func(ctx context.Context) (any, error) {
+		ctx, gen := us.cacheWriter.capture(ctx)
+		users, err := us.repo.GetManyShortProjections(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+
+		found := make(map[xid.ID]struct{}, len(users))
+		for i := range users {
+			found[users[i].ID] = struct{}{}
+			us.cacheWriter.setShortProjection(gen, users[i])
+		}
+		for _, id := range ids {
+			if _, ok := found[id]; !ok {
+				us.cacheWriter.setNotFound(gen, id)
+			}
+		}
+
+		return users, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]entity.UserShortProjection), nil
+}
+
+// loadShared runs the load once for concurrent callers with the same key. A caller stops waiting
+// when its context is done, while the load goes on for the others with its own timeout.
+func (us UserService) loadShared(ctx context.Context, key string, load func(context.Context) (any, error)) (any, error) {
+	ch := us.flights.DoChan(key, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sharedLoadTimeout)
+		defer cancel()
+
+		return load(ctx)
+	})
+
+	select {
+	case res := <-ch:
+		return res.Val, res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// refreshEarly decides whether the cache entry should be recomputed before its expiration
+// (probabilistic early expiration, XFetch): the closer the expiration, the higher the chance.
+// The zero expiration means it is unknown, so the entry is never refreshed early.
+func (us UserService) refreshEarly(expiresAt time.Time) bool {
+	if expiresAt.IsZero() || us.cfg.Cache.EarlyRefreshDeltaMilliseconds <= 0 {
+		return false
+	}
+
+	delta := float64(us.cfg.Cache.EarlyRefreshDeltaMilliseconds) * float64(time.Millisecond)
+	gap := time.Duration(-delta * us.cfg.Cache.EarlyRefreshBeta * math.Log(1-rand.Float64())) //nolint:gosec
+
+	return !time.Now().Add(gap).Before(expiresAt)
+}
+
+// idsKey returns a key that is the same for any order of the ids.
+func idsKey(ids []xid.ID) string {
+	strs := make([]string, len(ids))
+	for i := range ids {
+		strs[i] = ids[i].String()
+	}
+	slices.Sort(strs)
+
+	return strings.Join(strs, ",")
+}
@@ -1,7 +1,88 @@
 package service
 
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
 type Config struct {
 	Cache struct {
 		TTLSeconds int32 `env:"TTL_SECONDS" envDefault:"3600"`
+		// UsernameTTLSeconds is a ttl of the username to id index entries
+		UsernameTTLSeconds int32 `env:"USERNAME_TTL_SECONDS" envDefault:"600"`
+		// UserTTLSeconds is a ttl of full user entries
+		UserTTLSeconds int32 `env:"USER_TTL_SECONDS" envDefault:"600"`
+		// NotFoundTTLSeconds is a ttl of markers of unknown user ids
+		NotFoundTTLSeconds int32 `env:"NOT_FOUND_TTL_SECONDS" envDefault:"60"`
+		// ReplicaTTLSeconds is a maximum ttl of entries read from the read replica:
+		// a stale entry read from a lagging replica is not served longer than that
+		ReplicaTTLSeconds int32 `env:"REPLICA_TTL_SECONDS" envDefault:"30"`
+		// EarlyRefreshDeltaMilliseconds is an expected time to recompute an entry:
+		// hot entries are recomputed by one caller shortly before expiration, 0 disables it
+		EarlyRefreshDeltaMilliseconds int `env:"EARLY_REFRESH_DELTA_MILLISECONDS" envDefault:"100"`
+		// EarlyRefreshBeta scales the early refresh window, values > 1 favor earlier refresh
+		EarlyRefreshBeta float64 `env:"EARLY_REFRESH_BETA" envDefault:"1"`
 	} `envPrefix:"CACHE_"`
+	CacheWriter struct {
+		// QueueSize limits the number of pending cache writes, new writes are dropped when it is full
+		QueueSize int `env:"QUEUE_SIZE" envDefault:"10000"`
+		// Workers is a number of goroutines writing to the cache, nothing is written without them
+		Workers int `env:"WORKERS" envDefault:"4"`
+		// BatchSize is a maximum number of pending writes taken by a worker at once
+		BatchSize int `env:"BATCH_SIZE" envDefault:"100"`
+	} `envPrefix:"CACHE_WRITER_"`
+	WarmUp struct {
+		// Enabled turns on filling the cache with the most recently updated users on startup
+		Enabled bool `env:"ENABLED" envDefault:"false"`
+		// Limit is a maximum number of users put into the cache
+		Limit     int `env:"LIMIT" envDefault:"10000"`
+		BatchSize int `env:"BATCH_SIZE" envDefault:"100"`
+		// BatchesPerSecond limits the load of the warm-up on the database and the cache
+		BatchesPerSecond float64 `env:"BATCHES_PER_SECOND" envDefault:"20"`
+		// BudgetSeconds is a maximum time the warm-up delays the service start, it is stopped after that.
+		// It is at most 60: users read by the warm-up earlier than a minute ago are not cached
+		BudgetSeconds int `env:"BUDGET_SECONDS" envDefault:"10"`
+	} `envPrefix:"WARM_UP_"`
+	// MaxBatchSize limits the number of users requested in one batch call
+	MaxBatchSize int `env:"MAX_BATCH_SIZE" envDefault:"100"`
+}
+
+func (cfg Config) Validate() error {
+	var errs []error
+
+	if cfg.Cache.ReplicaTTLSeconds < 1 {
+		errs = append(errs, fmt.Errorf("cache replica ttl %d must be positive", cfg.Cache.ReplicaTTLSeconds))
+	}
+	if cfg.CacheWriter.QueueSize < 1 {
+		errs = append(errs, fmt.Errorf("cache writer queue size %d must be positive", cfg.CacheWriter.QueueSize))
+	}
+	if cfg.CacheWriter.Workers < 1 {
+		errs = append(errs, fmt.Errorf("cache writer workers %d must be positive", cfg.CacheWriter.Workers))
+	}
+	if cfg.CacheWriter.BatchSize < 1 {
+		errs = append(errs, fmt.Errorf("cache writer batch size %d must be positive", cfg.CacheWriter.BatchSize))
+	}
+
+	if cfg.WarmUp.Limit < 1 {
+		errs = append(errs, fmt.Errorf("warm-up limit %d must be positive", cfg.WarmUp.Limit))
+	}
+	if cfg.WarmUp.BatchSize < 1 {
+		errs = append(errs, fmt.Errorf("warm-up batch size %d must be positive", cfg.WarmUp.BatchSize))
+	}
+	if cfg.WarmUp.BatchesPerSecond <= 0 {
+		errs = append(errs, fmt.Errorf("warm-up batches per second %g must be positive", cfg.WarmUp.BatchesPerSecond))
+	}
+	if budget := time.Duration(cfg.WarmUp.BudgetSeconds) * time.Second; budget <= 0 || budget > maxCacheWriteAge {
+		errs = append(errs, fmt.Errorf("warm-up budget %ds must be positive and at most %s", cfg.WarmUp.BudgetSeconds, maxCacheWriteAge))
+	}
+
+	if cfg.MaxBatchSize < 1 {
+		errs = append(errs, fmt.Errorf("max batch size %d must be positive", cfg.MaxBatchSize))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid user service config: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,96 @@
+package service_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/caarlos0/env/v11"
+
+	"github.com/Karzoug/meower-user-service/internal/user/service"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr []string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name: "zero cache writer",
+			env: map[string]string{
+				"CACHE_WRITER_QUEUE_SIZE": "0",
+				"CACHE_WRITER_WORKERS":    "0",
+				"CACHE_WRITER_BATCH_SIZE": "0",
+			},
+			wantErr: []string{"queue size 0", "workers 0", "batch size 0"},
+		},
+		{
+			name: "zero warm-up",
+			env: map[string]string{
+				"WARM_UP_LIMIT":              "0",
+				"WARM_UP_BATCH_SIZE":         "0",
+				"WARM_UP_BATCHES_PER_SECOND": "0",
+			},
+			wantErr: []string{"warm-up limit 0", "warm-up batch size 0", "warm-up batches per second 0"},
+		},
+		{
+			name: "warm-up budget out of range",
+			env: map[string]string{
+				"WARM_UP_BUDGET_SECONDS": "61",
+			},
+			wantErr: []string{"warm-up budget 61s"},
+		},
+		{
+			name: "zero warm-up budget",
+			env: map[string]string{
+				"WARM_UP_BUDGET_SECONDS": "0",
+			},
+			wantErr: []string{"warm-up budget 0s"},
+		},
+		{
+			name: "zero max batch size",
+			env: map[string]string{
+				"MAX_BATCH_SIZE": "0",
+			},
+			wantErr: []string{"max batch size 0"},
+		},
+		{
+			name: "negative queue size",
+			env: map[string]string{
+				"CACHE_WRITER_QUEUE_SIZE": "-1",
+			},
+			wantErr: []string{"queue size -1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			environment := map[string]string{}
+			for k, v := range tt.env {
+				environment[k] = v
+			}
+			cfg, err := env.ParseAsWithOptions[service.Config](env.Options{Environment: environment})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = cfg.Validate()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() error = nil, want %v", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/rs/xid"
 
@@ -14,12 +15,26 @@ type repository interface {
 	GetOneShortProjection(ctx context.Context, id xid.ID) (entity.UserShortProjection, error)
 	GetOneShortProjectionByUsername(ctx context.Context, username string) (entity.UserShortProjection, error)
 	GetManyShortProjections(ctx context.Context, ids []xid.ID) ([]entity.UserShortProjection, error)
-	Update(ctx context.Context, u entity.User) error
+	GetManyShortProjectionsByUsernames(ctx context.Context, usernames []string) ([]entity.UserShortProjection, error)
+	Update(ctx context.Context, u entity.User) (time.Time, error)
+	UpdateUsername(ctx context.Context, username, newUsername string) (xid.ID, error)
 	DeleteByUsername(ctx context.Context, username string) (xid.ID, error)
+	ForEachRecentShortProjections(ctx context.Context, limit, batchSize int, fn func([]entity.UserShortProjection) error) error
 }
 
 type shortProjectionsCache interface {
-	GetOne(id xid.ID) (entity.UserShortProjection, error)
-	GetMany(ids []xid.ID) (users []entity.UserShortProjection, missed []xid.ID, err error)
-	Set(id xid.ID, u entity.UserShortProjection, ttl int32) error
+	GetOne(ctx context.Context, id xid.ID) (entity.UserShortProjection, error)
+	GetOneWithExpiration(ctx context.Context, id xid.ID) (u entity.UserShortProjection, expiresAt time.Time, err error)
+	GetMany(ctx context.Context, ids []xid.ID) (users []entity.UserShortProjection, missed []xid.ID, err error)
+	Set(ctx context.Context, id xid.ID, u entity.UserShortProjection, ttl int32) error
+	SetMany(ctx context.Context, users []entity.UserShortProjection, ttl int32) error
+	Delete(ctx context.Context, id xid.ID) error
+	SetNotFound(ctx context.Context, id xid.ID, ttl int32) error
+	GetUser(ctx context.Context, id xid.ID) (entity.User, error)
+	SetUser(ctx context.Context, u entity.User, ttl int32) error
+	DeleteUser(ctx context.Context, id xid.ID) error
+	GetIDByUsername(ctx context.Context, username string) (xid.ID, error)
+	GetManyIDsByUsernames(ctx context.Context, usernames []string) (ids map[string]xid.ID, missed []string, err error)
+	SetIDByUsername(ctx context.Context, username string, id xid.ID, ttl int32) error
+	DeleteIDByUsername(ctx context.Context, username string) error
 }
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const meterName = "github.com/Karzoug/meower-user-service/internal/user/service"
+
+type metrics struct {
+	batchSize     metric.Int64Histogram
+	cacheHitRatio metric.Float64Histogram
+	negativeHits  metric.Int64Counter
+
+	cacheWritesDropped   metric.Int64Counter
+	cacheWritesCoalesced metric.Int64Counter
+}
+
+func newMetrics() metrics {
+	meter := otel.GetMeterProvider().Meter(meterName)
+
+	batchSize, err := meter.Int64Histogram("batch_get_short_projections.size",
+		metric.WithDescription("Number of unique ids requested in one BatchGetShortProjections call."),
+		metric.WithExplicitBucketBoundaries(1, 5, 10, 25, 50, 100, 250, 500, 1000),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	cacheHitRatio, err := meter.Float64Histogram("batch_get_short_projections.cache_hit_ratio",
+		metric.WithDescription("Share of ids found in the cache in one BatchGetShortProjections call."),
+		metric.WithExplicitBucketBoundaries(0, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	negativeHits, err := meter.Int64Counter("short_projections_cache.negative_hits",
+		metric.WithDescription("Number of user ids found in the cache as not existing."),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	cacheWritesDropped, err := meter.Int64Counter("cache_writer.dropped",
+		metric.WithDescription("Number of cache writes dropped because the queue is full or closed."),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	cacheWritesCoalesced, err := meter.Int64Counter("cache_writer.coalesced",
+		metric.WithDescription("Number of cache writes replaced pending writes to the same entry."),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return metrics{
+		batchSize:            batchSize,
+		cacheHitRatio:        cacheHitRatio,
+		negativeHits:         negativeHits,
+		cacheWritesDropped:   cacheWritesDropped,
+		cacheWritesCoalesced: cacheWritesCoalesced,
+	}
+}
@@ -3,9 +3,13 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"time"
 
 	"github.com/rs/xid"
 	"github.com/rs/zerolog"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/Karzoug/meower-common-go/ucerr"
 	"google.golang.org/grpc/codes"
@@ -18,6 +22,9 @@ type UserService struct {
 	cfg                   Config
 	repo                  repository
 	shortProjectionsCache shortProjectionsCache
+	cacheWriter           *cacheWriter
+	flights               *singleflight.Group
+	metrics               metrics
 	logger                zerolog.Logger
 }
 
@@ -27,14 +34,24 @@ func NewUserService(cfg Config, repo repository, cache shortProjectionsCache, lo
 		Str("component", "user service").
 		Logger()
 
+	metrics := newMetrics()
+
 	return UserService{
 		cfg:                   cfg,
 		repo:                  repo,
 		shortProjectionsCache: cache,
+		cacheWriter:           newCacheWriter(cfg, cache, metrics, logger),
+		flights:               &singleflight.Group{},
+		metrics:               metrics,
 		logger:                logger,
 	}
 }
 
+// Close flushes pending cache writes.
+func (us UserService) Close(ctx context.Context) error {
+	return us.cacheWriter.Close(ctx)
+}
+
 // CreateByUsername creates a new user.
 func (us UserService) CreateByUsername(ctx context.Context, username string) (xid.ID, error) {
 	u := entity.NewUser(username)
@@ -44,58 +61,135 @@ func (us UserService) CreateByUsername(ctx context.Context, username string) (xi
 		case errors.Is(err, repoerr.ErrRecordAlreadyExists):
 			return xid.NilID(), ucerr.NewError(err, "user already exists", codes.AlreadyExists)
 		default:
-			return xid.NilID(), ucerr.NewInternalError(err)
+			return xid.NilID(), repoError(err)
 		}
 	}
 
+	// the id could be requested before the user was created
+	us.cacheWriter.forget(idWriteKey(id))
+	if err := us.shortProjectionsCache.Delete(ctx, id); err != nil {
+		us.logger.Error().
+			Err(err).
+			Msg("delete short user info from cache failed")
+	}
+
 	return id, nil
 }
 
-// Update updates an existing user.
-func (us UserService) Update(ctx context.Context, reqUserID xid.ID, u entity.User) error {
+// Update updates an existing user and returns the new update time of it:
+// the caller may pass it to Get to read its own write.
+func (us UserService) Update(ctx context.Context, reqUserID xid.ID, u entity.User) (time.Time, error) {
 	if reqUserID.Compare(u.ID) != 0 {
-		return ucerr.NewError(nil,
+		return time.Time{}, ucerr.NewError(nil,
 			"the caller does not have permission to update this user",
 			codes.PermissionDenied)
 	}
 
 	if err := u.Validate(); err != nil {
-		return ucerr.NewError(err, err.Error(), codes.InvalidArgument)
+		return time.Time{}, ucerr.NewError(err, err.Error(), codes.InvalidArgument)
 	}
 
-	if err := us.repo.Update(ctx, u); err != nil {
+	updatedAt, err := us.repo.Update(ctx, u)
+	if err != nil {
 		switch {
 		case errors.Is(err, repoerr.ErrRecordNotFound):
-			return ucerr.NewError(err, "user not found", codes.NotFound)
+			return time.Time{}, ucerr.NewError(err, "user not found", codes.NotFound)
 		default:
-			return ucerr.NewInternalError(err)
+			return time.Time{}, repoError(err)
 		}
 	}
 
-	return nil
+	us.cacheWriter.forget(idWriteKey(u.ID))
+	if err := us.shortProjectionsCache.Delete(ctx, u.ID); err != nil {
+		us.logger.Error().
+			Err(err).
+			Msg("delete short user info from cache failed")
+	}
+	us.cacheWriter.forget(userWriteKey(u.ID))
+	if err := us.shortProjectionsCache.DeleteUser(ctx, u.ID); err != nil {
+		us.logger.Error().
+			Err(err).
+			Msg("delete user from cache failed")
+	}
+
+	return updatedAt, nil
 }
 
-// Get returns an existing user.
-func (us UserService) Get(ctx context.Context, reqUserID xid.ID, id xid.ID) (entity.User, error) {
+// Get returns an existing user. The cached user is returned only if it is not older than minUpdatedAt,
+// so the caller reads its own write by passing the update time returned by Update.
+func (us UserService) Get(ctx context.Context, reqUserID, id xid.ID, minUpdatedAt time.Time) (entity.User, error) {
 	if reqUserID.Compare(id) != 0 {
 		return entity.User{}, ucerr.NewError(nil,
 			"the caller does not have permission to get this user",
 			codes.PermissionDenied)
 	}
 
-	u, err := us.repo.GetOne(ctx, id)
+	u, err := us.shortProjectionsCache.GetUser(ctx, id)
+	switch {
+	case nil == err:
+		if !u.UpdatedAt.Before(minUpdatedAt) {
+			return u, nil
+		}
+	case !errors.Is(err, repoerr.ErrRecordNotFound):
+		us.logger.Error().
+			Err(err).
+			Msg("get user from cache failed")
+	}
+
+	ctx, gen := us.cacheWriter.capture(ctx)
+	u, err = us.repo.GetOne(ctx, id)
 	if err != nil {
 		switch {
 		case errors.Is(err, repoerr.ErrRecordNotFound):
 			return entity.User{}, ucerr.NewError(err, "user not found", codes.NotFound)
 		default:
-			return entity.User{}, ucerr.NewInternalError(err)
+			return entity.User{}, repoError(err)
 		}
 	}
 
+	us.cacheWriter.setUser(gen, u)
+
 	return u, nil
 }
 
+// ChangeUsername changes the username of an existing user and returns the id of it.
+func (us UserService) ChangeUsername(ctx context.Context, username, newUsername string) (xid.ID, error) {
+	id, err := us.repo.UpdateUsername(ctx, username, newUsername)
+	if err != nil {
+		switch {
+		case errors.Is(err, repoerr.ErrRecordNotFound):
+			return xid.NilID(), ucerr.NewError(err, "user not found", codes.NotFound)
+		case errors.Is(err, repoerr.ErrRecordAlreadyExists):
+			return xid.NilID(), ucerr.NewError(err, "username is already taken", codes.AlreadyExists)
+		default:
+			return xid.NilID(), repoError(err)
+		}
+	}
+
+	for _, name := range []string{username, newUsername} {
+		us.cacheWriter.forget(usernameWriteKey(name))
+		if err := us.shortProjectionsCache.DeleteIDByUsername(ctx, name); err != nil {
+			us.logger.Error().
+				Err(err).
+				Msg("delete user id by username from cache failed")
+		}
+	}
+	us.cacheWriter.forget(idWriteKey(id))
+	if err := us.shortProjectionsCache.Delete(ctx, id); err != nil {
+		us.logger.Error().
+			Err(err).
+			Msg("delete short user info from cache failed")
+	}
+	us.cacheWriter.forget(userWriteKey(id))
+	if err := us.shortProjectionsCache.DeleteUser(ctx, id); err != nil {
+		us.logger.Error().
+			Err(err).
+			Msg("delete user from cache failed")
+	}
+
+	return id, nil
+}
+
 // DeleteByUsername deletes an existing user by username.
 func (us UserService) DeleteByUsername(ctx context.Context, username string) (xid.ID, error) {
 	id, err := us.repo.DeleteByUsername(ctx, username)
@@ -104,91 +198,297 @@ func (us UserService) DeleteByUsername(ctx context.Context, username string) (xi
 		case errors.Is(err, repoerr.ErrNoAffected):
 			return id, nil
 		default:
-			return xid.NilID(), ucerr.NewInternalError(err)
+			return xid.NilID(), repoError(err)
 		}
 	}
 
+	us.cacheWriter.forget(usernameWriteKey(username))
+	if err := us.shortProjectionsCache.DeleteIDByUsername(ctx, username); err != nil {
+		us.logger.Error().
+			Err(err).
+			Msg("delete user id by username from cache failed")
+	}
+	us.cacheWriter.forget(idWriteKey(id))
+	if err := us.shortProjectionsCache.SetNotFound(ctx, id, us.cfg.Cache.NotFoundTTLSeconds); err != nil {
+		us.logger.Error().
+			Err(err).
+			Msg("set not found short user info to cache failed")
+	}
+	us.cacheWriter.forget(userWriteKey(id))
+	if err := us.shortProjectionsCache.DeleteUser(ctx, id); err != nil {
+		us.logger.Error().
+			Err(err).
+			Msg("delete user from cache failed")
+	}
+
 	return id, nil
 }
 
 // GetShortProjection returns a short projection (for public display) of an existing user.
 func (us UserService) GetShortProjection(ctx context.Context, id xid.ID) (entity.UserShortProjection, error) {
-	user, err := us.shortProjectionsCache.GetOne(id)
+	user, expiresAt, err := us.shortProjectionsCache.GetOneWithExpiration(ctx, id)
 	if nil == err {
-		return user, nil
+		if !us.refreshEarly(expiresAt) {
+			return user, nil
+		}
+
+		// the entry is about to expire: recompute it by this caller,
+		// but the cached value is still good if the repository fails
+		fresh, err := us.loadShortProjection(ctx, id)
+		switch {
+		case nil == err:
+			return fresh, nil
+		case errors.Is(err, repoerr.ErrRecordNotFound):
+			return entity.UserShortProjection{}, ucerr.NewError(err, "user not found", codes.NotFound)
+		default:
+			us.logger.Warn().
+				Err(err).
+				Msg("early refresh of short user info failed")
+			return user, nil
+		}
 	}
-	if !errors.Is(err, repoerr.ErrRecordNotFound) {
+	switch {
+	case errors.Is(err, repoerr.ErrRecordNotFoundCached):
+		us.metrics.negativeHits.Add(ctx, 1)
+		return entity.UserShortProjection{}, ucerr.NewError(err, "user not found", codes.NotFound)
+	case !errors.Is(err, repoerr.ErrRecordNotFound):
 		us.logger.Error().
 			Err(err).
 			Msg("get short user info from cache failed")
 	}
 
-	user, err = us.repo.GetOneShortProjection(ctx, id)
+	user, err = us.loadShortProjection(ctx, id)
 	if err != nil {
 		switch {
 		case errors.Is(err, repoerr.ErrRecordNotFound):
 			return entity.UserShortProjection{}, ucerr.NewError(err, "user not found", codes.NotFound)
 		default:
-			return entity.UserShortProjection{}, ucerr.NewInternalError(err)
+			return entity.UserShortProjection{}, repoError(err)
 		}
 	}
 
-	go func() {
-		if err := us.shortProjectionsCache.Set(id, user, us.cfg.Cache.TTLSeconds); err != nil {
-			us.logger.Error().
-				Err(err).
-				Msg("set short user info to cache failed")
-		}
-	}()
-
 	return user, nil
 }
 
 // GetShortProjectionByUsername returns a short projection (for public display) of an existing user by username.
 func (us UserService) GetShortProjectionByUsername(ctx context.Context, username string) (entity.UserShortProjection, error) {
+	if user, ok := us.getCachedShortProjectionByUsername(ctx, username); ok {
+		return user, nil
+	}
+
+	ctx, gen := us.cacheWriter.capture(ctx)
 	user, err := us.repo.GetOneShortProjectionByUsername(ctx, username)
 	if err != nil {
 		switch {
 		case errors.Is(err, repoerr.ErrRecordNotFound):
 			return entity.UserShortProjection{}, ucerr.NewError(err, "user not found", codes.NotFound)
 		default:
-			return entity.UserShortProjection{}, ucerr.NewInternalError(err)
+			return entity.UserShortProjection{}, repoError(err)
 		}
 	}
 
+	us.cacheWriter.setShortProjection(gen, user)
+	us.cacheWriter.setIDByUsername(gen, user.Username, user.ID)
+
 	return user, nil
 }
 
-// BatchGetShortProjections returns a batch of short projections (for public display) of existing users.
-func (us UserService) BatchGetShortProjections(ctx context.Context, ids []xid.ID) ([]entity.UserShortProjection, error) {
-	users, missed, err := us.shortProjectionsCache.GetMany(ids)
-	if nil == err && len(missed) == 0 {
-		return users, nil
+// getCachedShortProjectionByUsername resolves username to id with the cache index
+// and then returns cached short projection by this id.
+func (us UserService) getCachedShortProjectionByUsername(ctx context.Context, username string) (entity.UserShortProjection, bool) {
+	id, err := us.shortProjectionsCache.GetIDByUsername(ctx, username)
+	if err != nil {
+		if !errors.Is(err, repoerr.ErrRecordNotFound) {
+			us.logger.Error().
+				Err(err).
+				Msg("get user id by username from cache failed")
+		}
+		return entity.UserShortProjection{}, false
 	}
+
+	user, err := us.shortProjectionsCache.GetOne(ctx, id)
+	if err != nil {
+		if !errors.Is(err, repoerr.ErrRecordNotFound) && !errors.Is(err, repoerr.ErrRecordNotFoundCached) {
+			us.logger.Error().
+				Err(err).
+				Msg("get short user info from cache failed")
+		}
+		return entity.UserShortProjection{}, false
+	}
+
+	// the index is stale: the user has changed username since the entry was set
+	if user.Username != username {
+		if err := us.shortProjectionsCache.DeleteIDByUsername(ctx, username); err != nil {
+			us.logger.Error().
+				Err(err).
+				Msg("delete user id by username from cache failed")
+		}
+		return entity.UserShortProjection{}, false
+	}
+
+	return user, true
+}
+
+// BatchGetShortProjections returns a batch of short projections (for public display) of existing users
+// in the order of requested ids without duplicates and ids of users that were not found.
+func (us UserService) BatchGetShortProjections(ctx context.Context, ids []xid.ID) ([]entity.UserShortProjection, []xid.ID, error) {
+	if len(ids) > us.cfg.MaxBatchSize {
+		return nil, nil, ucerr.NewError(nil,
+			fmt.Sprintf("too many ids in batch: maximum is %d", us.cfg.MaxBatchSize),
+			codes.InvalidArgument)
+	}
+
+	ids = uniqueIDs(ids)
+	if len(ids) == 0 {
+		return []entity.UserShortProjection{}, []xid.ID{}, nil
+	}
+
+	found := make(map[xid.ID]entity.UserShortProjection, len(ids))
+
+	cachedUsers, missed, err := us.shortProjectionsCache.GetMany(ctx, ids)
 	if err != nil {
 		us.logger.Error().
 			Err(err).
 			Msg("get short users info from cache failed")
 
-		users = make([]entity.UserShortProjection, 0, len(ids))
 		missed = ids
+	} else {
+		for i := range cachedUsers {
+			found[cachedUsers[i].ID] = cachedUsers[i]
+		}
+		// ids that are neither found nor missed are known to be not found
+		if negative := len(ids) - len(cachedUsers) - len(missed); negative > 0 {
+			us.metrics.negativeHits.Add(ctx, int64(negative))
+		}
 	}
 
-	missedUsers, err := us.repo.GetManyShortProjections(ctx, missed)
-	if err != nil {
-		return nil, ucerr.NewInternalError(err)
-	}
-	users = append(users, missedUsers...)
+	us.metrics.batchSize.Record(ctx, int64(len(ids)))
+	us.metrics.cacheHitRatio.Record(ctx, float64(len(ids)-len(missed))/float64(len(ids)))
 
-	go func() {
+	if len(missed) != 0 {
+		missedUsers, err := us.loadShortProjections(ctx, missed)
+		if err != nil {
+			return nil, nil, repoError(err)
+		}
 		for i := range missedUsers {
-			if err := us.shortProjectionsCache.Set(missedUsers[i].ID, missedUsers[i], us.cfg.Cache.TTLSeconds); err != nil {
-				us.logger.Error().
-					Err(err).
-					Msg("set short user info to cache failed")
-			}
+			found[missedUsers[i].ID] = missedUsers[i]
 		}
-	}()
+	}
+
+	users := make([]entity.UserShortProjection, 0, len(found))
+	notFound := make([]xid.ID, 0, len(ids)-len(found))
+	for _, id := range ids {
+		if u, ok := found[id]; ok {
+			users = append(users, u)
+		} else {
+			notFound = append(notFound, id)
+		}
+	}
+
+	return users, notFound, nil
+}
+
+// BatchGetShortProjectionsByUsernames returns a batch of short projections (for public display) of existing users
+// keyed by requested usernames. Usernames of unknown users are absent from the result.
+func (us UserService) BatchGetShortProjectionsByUsernames(ctx context.Context, usernames []string) (map[string]entity.UserShortProjection, error) {
+	if len(usernames) > us.cfg.MaxBatchSize {
+		return nil, ucerr.NewError(nil,
+			fmt.Sprintf("too many usernames in batch: maximum is %d", us.cfg.MaxBatchSize),
+			codes.InvalidArgument)
+	}
+
+	usernames = slices.Clone(usernames)
+	slices.Sort(usernames)
+	usernames = slices.Compact(usernames)
+
+	users, missed := us.getCachedShortProjectionsByUsernames(ctx, usernames)
+	if len(missed) == 0 {
+		return users, nil
+	}
+
+	ctx, gen := us.cacheWriter.capture(ctx)
+	missedUsers, err := us.repo.GetManyShortProjectionsByUsernames(ctx, missed)
+	if err != nil {
+		return nil, repoError(err)
+	}
+	for i := range missedUsers {
+		users[missedUsers[i].Username] = missedUsers[i]
+	}
+
+	for i := range missedUsers {
+		us.cacheWriter.setShortProjection(gen, missedUsers[i])
+		us.cacheWriter.setIDByUsername(gen, missedUsers[i].Username, missedUsers[i].ID)
+	}
 
 	return users, nil
 }
+
+// getCachedShortProjectionsByUsernames resolves usernames to ids with the cache index
+// and then returns cached short projections by these ids.
+func (us UserService) getCachedShortProjectionsByUsernames(ctx context.Context, usernames []string) (map[string]entity.UserShortProjection, []string) {
+	users := make(map[string]entity.UserShortProjection, len(usernames))
+
+	ids, missed, err := us.shortProjectionsCache.GetManyIDsByUsernames(ctx, usernames)
+	if err != nil {
+		us.logger.Error().
+			Err(err).
+			Msg("get user ids by usernames from cache failed")
+
+		return users, usernames
+	}
+	if len(ids) == 0 {
+		return users, missed
+	}
+
+	cachedIDs := make([]xid.ID, 0, len(ids))
+	for _, id := range ids {
+		cachedIDs = append(cachedIDs, id)
+	}
+
+	cachedUsers, _, err := us.shortProjectionsCache.GetMany(ctx, cachedIDs)
+	if err != nil {
+		us.logger.Error().
+			Err(err).
+			Msg("get short users info from cache failed")
+
+		return users, usernames
+	}
+	for i := range cachedUsers {
+		// the index may be stale: trust only a projection with the same username
+		if id, ok := ids[cachedUsers[i].Username]; ok && id == cachedUsers[i].ID {
+			users[cachedUsers[i].Username] = cachedUsers[i]
+		}
+	}
+
+	for username := range ids {
+		if _, ok := users[username]; !ok {
+			missed = append(missed, username)
+		}
+	}
+
+	return users, missed
+}
+
+// uniqueIDs returns ids without duplicates keeping the order of the first occurrence.
+func uniqueIDs(ids []xid.ID) []xid.ID {
+	seen := make(map[xid.ID]struct{}, len(ids))
+	res := make([]xid.ID, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		res = append(res, id)
+	}
+
+	return res
+}
+
+// repoError converts an unexpected repository error to the use case error.
+func repoError(err error) error {
+	if errors.Is(err, repoerr.ErrUnavailable) {
+		return ucerr.NewError(err, "service is temporarily unavailable", codes.Unavailable)
+	}
+
+	return ucerr.NewInternalError(err)
+}
@@ -0,0 +1,941 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"google.golang.org/grpc/codes"
+
+	"github.com/Karzoug/meower-common-go/ucerr"
+
+	"github.com/Karzoug/meower-user-service/internal/user/entity"
+	"github.com/Karzoug/meower-user-service/internal/user/repo"
+	"github.com/Karzoug/meower-user-service/internal/user/service"
+	"github.com/Karzoug/meower-user-service/internal/user/service/servicetest"
+)
+
+var errBoom = errors.New("boom")
+
+func TestCreateByUsername(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(h *servicetest.Harness)
+		wantCode codes.Code
+	}{
+		{
+			name: "ok",
+		},
+		{
+			name: "already exists",
+			setup: func(h *servicetest.Harness) {
+				createUser(t, h, "alice")
+			},
+			wantCode: codes.AlreadyExists,
+		},
+		{
+			name: "repository error",
+			setup: func(h *servicetest.Harness) {
+				h.Repo.Fail(errBoom)
+			},
+			wantCode: codes.Internal,
+		},
+		{
+			name: "repository unavailable",
+			setup: func(h *servicetest.Harness) {
+				h.Repo.Fail(repo.ErrUnavailable)
+			},
+			wantCode: codes.Unavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := servicetest.New(t)
+			if tt.setup != nil {
+				tt.setup(h)
+			}
+
+			id, err := h.Service.CreateByUsername(context.Background(), "alice")
+			assertCode(t, err, tt.wantCode)
+			if tt.wantCode != codes.OK {
+				return
+			}
+
+			got, err := h.Service.GetShortProjection(context.Background(), id)
+			if err != nil {
+				t.Fatalf("GetShortProjection() error = %v", err)
+			}
+			if got.Username != "alice" {
+				t.Errorf("GetShortProjection() username = %q, want %q", got.Username, "alice")
+			}
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup returns the requested user id, the caller id and the min update time
+		setup    func(h *servicetest.Harness, u entity.User) (id, reqUserID xid.ID, minUpdatedAt time.Time)
+		wantCode codes.Code
+		wantName string
+	}{
+		{
+			name: "from repository",
+			setup: func(_ *servicetest.Harness, u entity.User) (xid.ID, xid.ID, time.Time) {
+				return u.ID, u.ID, time.Time{}
+			},
+			wantName: "alice",
+		},
+		{
+			name: "another user",
+			setup: func(_ *servicetest.Harness, u entity.User) (xid.ID, xid.ID, time.Time) {
+				return u.ID, xid.New(), time.Time{}
+			},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name: "anonymous",
+			setup: func(_ *servicetest.Harness, u entity.User) (xid.ID, xid.ID, time.Time) {
+				return u.ID, xid.NilID(), time.Time{}
+			},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name: "not found",
+			setup: func(_ *servicetest.Harness, _ entity.User) (xid.ID, xid.ID, time.Time) {
+				id := xid.New()
+				return id, id, time.Time{}
+			},
+			wantCode: codes.NotFound,
+		},
+		{
+			name: "cache hit",
+			setup: func(h *servicetest.Harness, u entity.User) (xid.ID, xid.ID, time.Time) {
+				u.Name = "cached"
+				if err := h.Cache.SetUser(context.Background(), u, 60); err != nil {
+					t.Fatal(err)
+				}
+				h.Repo.Fail(errBoom)
+				return u.ID, u.ID, u.UpdatedAt
+			},
+			wantName: "cached",
+		},
+		{
+			name: "cached user is older than the caller write",
+			setup: func(h *servicetest.Harness, u entity.User) (xid.ID, xid.ID, time.Time) {
+				u.Name = "cached"
+				if err := h.Cache.SetUser(context.Background(), u, 60); err != nil {
+					t.Fatal(err)
+				}
+				return u.ID, u.ID, u.UpdatedAt.Add(time.Second)
+			},
+			wantName: "alice",
+		},
+		{
+			name: "cache error",
+			setup: func(h *servicetest.Harness, u entity.User) (xid.ID, xid.ID, time.Time) {
+				h.Cache.Fail(errBoom)
+				return u.ID, u.ID, time.Time{}
+			},
+			wantName: "alice",
+		},
+		{
+			name: "repository error",
+			setup: func(h *servicetest.Harness, u entity.User) (xid.ID, xid.ID, time.Time) {
+				h.Repo.Fail(errBoom)
+				return u.ID, u.ID, time.Time{}
+			},
+			wantCode: codes.Internal,
+		},
+		{
+			name: "repository unavailable",
+			setup: func(h *servicetest.Harness, u entity.User) (xid.ID, xid.ID, time.Time) {
+				h.Repo.Fail(repo.ErrUnavailable)
+				return u.ID, u.ID, time.Time{}
+			},
+			wantCode: codes.Unavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := servicetest.New(t)
+			id, reqUserID, minUpdatedAt := tt.setup(h, createUser(t, h, "alice"))
+
+			got, err := h.Service.Get(context.Background(), reqUserID, id, minUpdatedAt)
+			assertCode(t, err, tt.wantCode)
+			if tt.wantCode == codes.OK && got.Name != tt.wantName {
+				t.Errorf("Get() name = %q, want %q", got.Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     func(h *servicetest.Harness, u *entity.User) (reqUserID xid.ID)
+		wantCode  codes.Code
+		wantCalls int
+	}{
+		{
+			name: "ok",
+			setup: func(_ *servicetest.Harness, u *entity.User) xid.ID {
+				u.Name = "Alice"
+				return u.ID
+			},
+			wantCalls: 1,
+		},
+		{
+			name: "another user",
+			setup: func(_ *servicetest.Harness, u *entity.User) xid.ID {
+				return xid.New()
+			},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name: "invalid user",
+			setup: func(_ *servicetest.Harness, u *entity.User) xid.ID {
+				u.ImageURL = "not an url"
+				return u.ID
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "not found",
+			setup: func(_ *servicetest.Harness, u *entity.User) xid.ID {
+				u.ID = xid.New()
+				return u.ID
+			},
+			wantCode:  codes.NotFound,
+			wantCalls: 1,
+		},
+		{
+			name: "repository error",
+			setup: func(h *servicetest.Harness, u *entity.User) xid.ID {
+				h.Repo.Fail(errBoom)
+				return u.ID
+			},
+			wantCode:  codes.Internal,
+			wantCalls: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := servicetest.New(t)
+			u := createUser(t, h, "alice")
+			reqUserID := tt.setup(h, &u)
+			calls := h.Repo.Calls()
+
+			_, err := h.Service.Update(context.Background(), reqUserID, u)
+			assertCode(t, err, tt.wantCode)
+			if got := h.Repo.Calls() - calls; got != tt.wantCalls {
+				t.Errorf("Update() repository calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestUpdateInvalidatesCache(t *testing.T) {
+	h := servicetest.New(t)
+	u := createUser(t, h, "alice")
+
+	// fill the cache
+	if _, err := h.Service.Get(context.Background(), u.ID, u.ID, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Cache.Set(context.Background(), u.ID, u.UserShortProjection, 60); err != nil {
+		t.Fatal(err)
+	}
+
+	u.Name = "Alice"
+	updatedAt, err := h.Service.Update(context.Background(), u.ID, u)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	got, err := h.Service.Get(context.Background(), u.ID, u.ID, updatedAt)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Name != "Alice" {
+		t.Errorf("Get() after Update name = %q, want %q", got.Name, "Alice")
+	}
+
+	short, err := h.Service.GetShortProjection(context.Background(), u.ID)
+	if err != nil {
+		t.Fatalf("GetShortProjection() error = %v", err)
+	}
+	if short.Name != "Alice" {
+		t.Errorf("GetShortProjection() after Update name = %q, want %q", short.Name, "Alice")
+	}
+}
+
+func TestUpdateDuringCacheWrite(t *testing.T) {
+	h := servicetest.New(t)
+	u := createUser(t, h, "alice")
+
+	// the worker writes the projection read before the update and is blocked in the middle of it
+	blocked, release := h.Cache.BlockWrites()
+	defer release()
+	if _, err := h.Service.GetShortProjection(context.Background(), u.ID); err != nil {
+		t.Fatal(err)
+	}
+	<-blocked
+
+	u.Name = "Alice"
+	updated := make(chan error, 1)
+	go func() {
+		_, err := h.Service.Update(context.Background(), u.ID, u)
+		updated <- err
+	}()
+
+	// the update waits for the write, so it must not be done before the write is released
+	var err error
+	select {
+	case err = <-updated:
+		t.Error("Update() is done during the cache write")
+		release()
+	case <-time.After(100 * time.Millisecond):
+		release()
+		err = <-updated
+	}
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	h.Flush()
+
+	got, err := h.Cache.GetOne(context.Background(), u.ID)
+	if err == nil && got.Name != "Alice" {
+		t.Errorf("cached name after Update = %q, want %q", got.Name, "Alice")
+	}
+}
+
+func TestChangeUsername(t *testing.T) {
+	tests := []struct {
+		name        string
+		username    string
+		newUsername string
+		setup       func(h *servicetest.Harness)
+		wantCode    codes.Code
+	}{
+		{
+			name:        "ok",
+			username:    "alice",
+			newUsername: "alice2",
+		},
+		{
+			name:        "unknown user",
+			username:    "carol",
+			newUsername: "carol2",
+			wantCode:    codes.NotFound,
+		},
+		{
+			name:        "username is taken",
+			username:    "alice",
+			newUsername: "bob",
+			wantCode:    codes.AlreadyExists,
+		},
+		{
+			name:        "repository error",
+			username:    "alice",
+			newUsername: "alice2",
+			setup: func(h *servicetest.Harness) {
+				h.Repo.Fail(errBoom)
+			},
+			wantCode: codes.Internal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := servicetest.New(t)
+			u := createUser(t, h, "alice")
+			createUser(t, h, "bob")
+
+			// fill the cache with the old username
+			if _, err := h.Service.GetShortProjectionByUsername(context.Background(), "alice"); err != nil {
+				t.Fatal(err)
+			}
+			if tt.setup != nil {
+				tt.setup(h)
+			}
+
+			id, err := h.Service.ChangeUsername(context.Background(), tt.username, tt.newUsername)
+			assertCode(t, err, tt.wantCode)
+			if tt.wantCode != codes.OK {
+				return
+			}
+			if id != u.ID {
+				t.Errorf("ChangeUsername() id = %v, want %v", id, u.ID)
+			}
+
+			short, err := h.Service.GetShortProjectionByUsername(context.Background(), tt.newUsername)
+			if err != nil {
+				t.Fatalf("GetShortProjectionByUsername() with the new username error = %v", err)
+			}
+			if short.ID != u.ID || short.Username != tt.newUsername {
+				t.Errorf("GetShortProjectionByUsername() = %+v, want id %v and username %q", short, u.ID, tt.newUsername)
+			}
+
+			_, err = h.Service.GetShortProjectionByUsername(context.Background(), tt.username)
+			assertCode(t, err, codes.NotFound)
+		})
+	}
+}
+
+func TestDeleteByUsername(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		setup    func(h *servicetest.Harness)
+		wantCode codes.Code
+		wantNil  bool
+		// wantMarker means that the cache must know that the user does not exist anymore
+		wantMarker bool
+	}{
+		{
+			name:       "ok",
+			username:   "alice",
+			wantMarker: true,
+		},
+		{
+			name:     "unknown user",
+			username: "bob",
+			wantNil:  true,
+		},
+		{
+			name:     "no affected",
+			username: "alice",
+			setup: func(h *servicetest.Harness) {
+				h.Repo.Fail(repo.ErrNoAffected)
+			},
+			wantNil: true,
+		},
+		{
+			name:     "repository error",
+			username: "alice",
+			setup: func(h *servicetest.Harness) {
+				h.Repo.Fail(errBoom)
+			},
+			wantCode: codes.Internal,
+		},
+		{
+			name:     "repository unavailable",
+			username: "alice",
+			setup: func(h *servicetest.Harness) {
+				h.Repo.Fail(repo.ErrUnavailable)
+			},
+			wantCode: codes.Unavailable,
+		},
+		{
+			name:     "cache error",
+			username: "alice",
+			setup: func(h *servicetest.Harness) {
+				h.Cache.Fail(errBoom)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := servicetest.New(t)
+			u := createUser(t, h, "alice")
+			if tt.setup != nil {
+				tt.setup(h)
+			}
+
+			id, err := h.Service.DeleteByUsername(context.Background(), tt.username)
+			assertCode(t, err, tt.wantCode)
+			if tt.wantCode != codes.OK {
+				return
+			}
+			if tt.wantNil {
+				if !id.IsNil() {
+					t.Errorf("DeleteByUsername() id = %v, want nil id", id)
+				}
+				return
+			}
+			if id != u.ID {
+				t.Errorf("DeleteByUsername() id = %v, want %v", id, u.ID)
+			}
+
+			if tt.wantMarker && !h.Cache.IsNotFound(u.ID) {
+				t.Errorf("DeleteByUsername() cache has no not found marker of the user")
+			}
+		})
+	}
+}
+
+func TestGetShortProjection(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(h *servicetest.Harness, u entity.User) xid.ID
+		wantCode codes.Code
+		wantName string
+	}{
+		{
+			name: "cache miss",
+			setup: func(_ *servicetest.Harness, u entity.User) xid.ID {
+				return u.ID
+			},
+			wantName: "alice",
+		},
+		{
+			name: "cache hit",
+			setup: func(h *servicetest.Harness, u entity.User) xid.ID {
+				u.Name = "cached"
+				if err := h.Cache.Set(context.Background(), u.ID, u.UserShortProjection, 60); err != nil {
+					t.Fatal(err)
+				}
+				h.Repo.Fail(errBoom)
+				return u.ID
+			},
+			wantName: "cached",
+		},
+		{
+			name: "cached not found",
+			setup: func(h *servicetest.Harness, _ entity.User) xid.ID {
+				id := xid.New()
+				if err := h.Cache.SetNotFound(context.Background(), id, 60); err != nil {
+					t.Fatal(err)
+				}
+				h.Repo.Fail(errBoom)
+				return id
+			},
+			wantCode: codes.NotFound,
+		},
+		{
+			name: "cache error",
+			setup: func(h *servicetest.Harness, u entity.User) xid.ID {
+				h.Cache.Fail(errBoom)
+				return u.ID
+			},
+			wantName: "alice",
+		},
+		{
+			name: "not found",
+			setup: func(_ *servicetest.Harness, _ entity.User) xid.ID {
+				return xid.New()
+			},
+			wantCode: codes.NotFound,
+		},
+		{
+			name: "repository error",
+			setup: func(h *servicetest.Harness, u entity.User) xid.ID {
+				h.Repo.Fail(errBoom)
+				return u.ID
+			},
+			wantCode: codes.Internal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := servicetest.New(t)
+			id := tt.setup(h, createUser(t, h, "alice"))
+
+			got, err := h.Service.GetShortProjection(context.Background(), id)
+			assertCode(t, err, tt.wantCode)
+			if tt.wantCode == codes.OK && got.Name != tt.wantName {
+				t.Errorf("GetShortProjection() name = %q, want %q", got.Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestGetShortProjectionFillsCache(t *testing.T) {
+	h := servicetest.New(t)
+	u := createUser(t, h, "alice")
+	unknown := xid.New()
+
+	if _, err := h.Service.GetShortProjection(context.Background(), u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Service.GetShortProjection(context.Background(), unknown); codeOf(err) != codes.NotFound {
+		t.Fatalf("GetShortProjection() error = %v, want not found", err)
+	}
+	h.Flush()
+
+	if got, err := h.Cache.GetOne(context.Background(), u.ID); err != nil || got != u.UserShortProjection {
+		t.Errorf("cache = %+v, %v, want %+v", got, err, u.UserShortProjection)
+	}
+	if !h.Cache.IsNotFound(unknown) {
+		t.Errorf("cache has no not found marker of the unknown user")
+	}
+}
+
+func TestReplicaReadsCachedShortly(t *testing.T) {
+	tests := []struct {
+		name    string
+		replica bool
+		want    int32
+	}{
+		{name: "primary", replica: false, want: 3600},
+		{name: "replica", replica: true, want: 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" lookup", func(t *testing.T) {
+			h := servicetest.New(t)
+			u := createUser(t, h, "alice")
+			h.Repo.ServeFromReplica(tt.replica)
+
+			if _, err := h.Service.GetShortProjection(context.Background(), u.ID); err != nil {
+				t.Fatal(err)
+			}
+			h.Flush()
+
+			if got := h.Cache.TTL(u.ID); got != tt.want {
+				t.Errorf("cache ttl = %d, want %d", got, tt.want)
+			}
+		})
+		t.Run(tt.name+" warm-up", func(t *testing.T) {
+			h := servicetest.New(t, func(cfg *service.Config) {
+				cfg.WarmUp.BatchesPerSecond = 1000
+			})
+			u := createUser(t, h, "alice")
+			h.Repo.ServeFromReplica(tt.replica)
+
+			if _, err := h.Service.WarmUpCache(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			h.Flush()
+
+			if got := h.Cache.TTL(u.ID); got != tt.want {
+				t.Errorf("cache ttl = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetShortProjectionCanceledDuringLoad(t *testing.T) {
+	h := servicetest.New(t)
+	u := createUser(t, h, "alice")
+
+	blocked, release := h.Repo.BlockCalls()
+	defer release()
+	ctx, cancel := context.WithCancel(context.Background())
+	got := make(chan error, 1)
+	go func() {
+		_, err := h.Service.GetShortProjection(ctx, u.ID)
+		got <- err
+	}()
+	<-blocked
+
+	// the caller does not wait for the shared load after its context is done
+	cancel()
+	select {
+	case err := <-got:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("GetShortProjection() error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("GetShortProjection() waits for the shared load after cancellation")
+	}
+
+	// the load goes on and fills the cache
+	release()
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		cached, err := h.Cache.GetOne(context.Background(), u.ID)
+		if err == nil && cached == u.UserShortProjection {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("cache = %+v, %v, want %+v", cached, err, u.UserShortProjection)
+		}
+	}
+}
+
+func TestGetShortProjectionByUsername(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		setup    func(h *servicetest.Harness, u entity.User)
+		wantCode codes.Code
+		wantName string
+	}{
+		{
+			name:     "cache miss",
+			username: "alice",
+			wantName: "alice",
+		},
+		{
+			name:     "cache hit",
+			username: "alice",
+			setup: func(h *servicetest.Harness, u entity.User) {
+				u.Name = "cached"
+				if err := h.Cache.Set(context.Background(), u.ID, u.UserShortProjection, 60); err != nil {
+					t.Fatal(err)
+				}
+				if err := h.Cache.SetIDByUsername(context.Background(), u.Username, u.ID, 60); err != nil {
+					t.Fatal(err)
+				}
+				h.Repo.Fail(errBoom)
+			},
+			wantName: "cached",
+		},
+		{
+			name:     "stale username index",
+			username: "alice",
+			setup: func(h *servicetest.Harness, u entity.User) {
+				other := entity.NewUser("bob")
+				if err := h.Cache.Set(context.Background(), other.ID, other.UserShortProjection, 60); err != nil {
+					t.Fatal(err)
+				}
+				if err := h.Cache.SetIDByUsername(context.Background(), u.Username, other.ID, 60); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantName: "alice",
+		},
+		{
+			name:     "cache error",
+			username: "alice",
+			setup: func(h *servicetest.Harness, _ entity.User) {
+				h.Cache.Fail(errBoom)
+			},
+			wantName: "alice",
+		},
+		{
+			name:     "not found",
+			username: "bob",
+			wantCode: codes.NotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := servicetest.New(t)
+			u := createUser(t, h, "alice")
+			if tt.setup != nil {
+				tt.setup(h, u)
+			}
+
+			got, err := h.Service.GetShortProjectionByUsername(context.Background(), tt.username)
+			assertCode(t, err, tt.wantCode)
+			if tt.wantCode == codes.OK && got.Name != tt.wantName {
+				t.Errorf("GetShortProjectionByUsername() name = %q, want %q", got.Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestBatchGetShortProjections(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(h *servicetest.Harness, alice, bob entity.User)
+		wantCode codes.Code
+	}{
+		{
+			name: "cache miss",
+		},
+		{
+			name: "partial cache hit",
+			setup: func(h *servicetest.Harness, alice, _ entity.User) {
+				if err := h.Cache.Set(context.Background(), alice.ID, alice.UserShortProjection, 60); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "cache error",
+			setup: func(h *servicetest.Harness, _, _ entity.User) {
+				h.Cache.Fail(errBoom)
+			},
+		},
+		{
+			name: "repository error",
+			setup: func(h *servicetest.Harness, _, _ entity.User) {
+				h.Repo.Fail(errBoom)
+			},
+			wantCode: codes.Internal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := servicetest.New(t)
+			alice, bob := createUser(t, h, "alice"), createUser(t, h, "bob")
+			if tt.setup != nil {
+				tt.setup(h, alice, bob)
+			}
+			unknown := xid.New()
+
+			users, notFound, err := h.Service.BatchGetShortProjections(context.Background(),
+				[]xid.ID{bob.ID, unknown, alice.ID, bob.ID})
+			assertCode(t, err, tt.wantCode)
+			if tt.wantCode != codes.OK {
+				return
+			}
+
+			want := []entity.UserShortProjection{bob.UserShortProjection, alice.UserShortProjection}
+			if !slices.Equal(users, want) {
+				t.Errorf("BatchGetShortProjections() users = %+v, want %+v", users, want)
+			}
+			if !slices.Equal(notFound, []xid.ID{unknown}) {
+				t.Errorf("BatchGetShortProjections() not found = %v, want %v", notFound, []xid.ID{unknown})
+			}
+		})
+	}
+}
+
+func TestBatchGetShortProjectionsTooMany(t *testing.T) {
+	h := servicetest.New(t, func(cfg *service.Config) {
+		cfg.MaxBatchSize = 2
+	})
+
+	_, _, err := h.Service.BatchGetShortProjections(context.Background(), []xid.ID{xid.New(), xid.New(), xid.New()})
+	assertCode(t, err, codes.InvalidArgument)
+
+	_, err = h.Service.BatchGetShortProjectionsByUsernames(context.Background(), []string{"a", "b", "c"})
+	assertCode(t, err, codes.InvalidArgument)
+}
+
+func TestBatchGetShortProjectionsByUsernames(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(h *servicetest.Harness, alice, bob entity.User)
+		wantCode codes.Code
+	}{
+		{
+			name: "cache miss",
+		},
+		{
+			name: "partial cache hit",
+			setup: func(h *servicetest.Harness, alice, _ entity.User) {
+				if err := h.Cache.Set(context.Background(), alice.ID, alice.UserShortProjection, 60); err != nil {
+					t.Fatal(err)
+				}
+				if err := h.Cache.SetIDByUsername(context.Background(), alice.Username, alice.ID, 60); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "cache error",
+			setup: func(h *servicetest.Harness, _, _ entity.User) {
+				h.Cache.Fail(errBoom)
+			},
+		},
+		{
+			name: "repository error",
+			setup: func(h *servicetest.Harness, _, _ entity.User) {
+				h.Repo.Fail(errBoom)
+			},
+			wantCode: codes.Internal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := servicetest.New(t)
+			alice, bob := createUser(t, h, "alice"), createUser(t, h, "bob")
+			if tt.setup != nil {
+				tt.setup(h, alice, bob)
+			}
+
+			users, err := h.Service.BatchGetShortProjectionsByUsernames(context.Background(),
+				[]string{"bob", "unknown", "alice", "bob"})
+			assertCode(t, err, tt.wantCode)
+			if tt.wantCode != codes.OK {
+				return
+			}
+
+			want := map[string]entity.UserShortProjection{
+				"alice": alice.UserShortProjection,
+				"bob":   bob.UserShortProjection,
+			}
+			if len(users) != len(want) || users["alice"] != want["alice"] || users["bob"] != want["bob"] {
+				t.Errorf("BatchGetShortProjectionsByUsernames() = %+v, want %+v", users, want)
+			}
+		})
+	}
+}
+
+func TestWarmUpCache(t *testing.T) {
+	h := servicetest.New(t, func(cfg *service.Config) {
+		cfg.WarmUp.Limit = 2
+		cfg.WarmUp.BatchSize = 1
+		cfg.WarmUp.BatchesPerSecond = 1000
+	})
+	createUser(t, h, "alice")
+	createUser(t, h, "bob")
+	createUser(t, h, "carol")
+
+	n, err := h.Service.WarmUpCache(context.Background())
+	if err != nil {
+		t.Fatalf("WarmUpCache() error = %v", err)
+	}
+	if n != 2 {
+		t.Errorf("WarmUpCache() = %d, want %d", n, 2)
+	}
+}
+
+func TestUpdateDuringWarmUp(t *testing.T) {
+	h := servicetest.New(t, func(cfg *service.Config) {
+		cfg.WarmUp.BatchSize = 1
+		cfg.WarmUp.BatchesPerSecond = 1000
+	})
+	alice := createUser(t, h, "alice")
+	bob := createUser(t, h, "bob")
+
+	// the warm-up is blocked on the batch of bob, alice is already read by its stream
+	blocked, release := h.Cache.BlockWrites()
+	defer release()
+	warmedUp := make(chan error, 1)
+	go func() {
+		_, err := h.Service.WarmUpCache(context.Background())
+		warmedUp <- err
+	}()
+	<-blocked
+
+	alice.Name = "Alice"
+	if _, err := h.Service.Update(context.Background(), alice.ID, alice); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	release()
+	if err := <-warmedUp; err != nil {
+		t.Fatalf("WarmUpCache() error = %v", err)
+	}
+
+	if got, err := h.Cache.GetOne(context.Background(), alice.ID); !errors.Is(err, repo.ErrRecordNotFound) {
+		t.Errorf("cache after Update = %+v, %v, want not found", got, err)
+	}
+	if _, err := h.Cache.GetOne(context.Background(), bob.ID); err != nil {
+		t.Errorf("cache of bob error = %v, want nil", err)
+	}
+}
+
+func createUser(t *testing.T, h *servicetest.Harness, username string) entity.User {
+	t.Helper()
+
+	u := entity.NewUser(username)
+	if _, err := h.Repo.Create(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := h.Repo.GetOne(context.Background(), u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return got
+}
+
+func codeOf(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+
+	var ucErr ucerr.Error
+	if !errors.As(err, &ucErr) {
+		return codes.Unknown
+	}
+
+	return ucErr.Code()
+}
+
+func assertCode(t *testing.T, err error, want codes.Code) {
+	t.Helper()
+
+	if got := codeOf(err); got != want {
+		t.Errorf("error = %v (code %v), want code %v", err, got, want)
+	}
+}
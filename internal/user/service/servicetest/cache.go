@@ -0,0 +1,282 @@
+package servicetest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+
+	"github.com/Karzoug/meower-user-service/internal/user/entity"
+	"github.com/Karzoug/meower-user-service/internal/user/repo"
+)
+
+// Cache is an in-memory users cache without expiration, all calls fail with the error set by Fail.
+type Cache struct {
+	mu          sync.Mutex
+	err         error
+	projections map[xid.ID]entity.UserShortProjection
+	ttls        map[xid.ID]int32
+	notFound    map[xid.ID]struct{}
+	users       map[xid.ID]entity.User
+	usernameIDs map[string]xid.ID
+	blocked     chan struct{}
+	release     chan struct{}
+}
+
+func NewCache() *Cache {
+	return &Cache{
+		projections: make(map[xid.ID]entity.UserShortProjection),
+		ttls:        make(map[xid.ID]int32),
+		notFound:    make(map[xid.ID]struct{}),
+		users:       make(map[xid.ID]entity.User),
+		usernameIDs: make(map[string]xid.ID),
+	}
+}
+
+// Fail makes all following calls fail with err, nil err restores the cache.
+func (c *Cache) Fail(err error) {
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+}
+
+// BlockWrites makes the following SetMany calls wait until release is called,
+// blocked is closed when the first of them starts waiting.
+func (c *Cache) BlockWrites() (blocked <-chan struct{}, release func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.blocked = make(chan struct{})
+	c.release = make(chan struct{})
+
+	var once sync.Once
+	rel := c.release
+	return c.blocked, func() { once.Do(func() { close(rel) }) }
+}
+
+// TTL returns the ttl the short projection of the user was cached with, 0 if it is not cached.
+func (c *Cache) TTL(id xid.ID) int32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ttls[id]
+}
+
+// IsNotFound reports whether the cache has the marker that the user does not exist.
+func (c *Cache) IsNotFound(id xid.ID) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.notFound[id]
+	return ok
+}
+
+func (c *Cache) GetOne(ctx context.Context, id xid.ID) (entity.UserShortProjection, error) {
+	u, _, err := c.GetOneWithExpiration(ctx, id)
+	return u, err
+}
+
+func (c *Cache) GetOneWithExpiration(ctx context.Context, id xid.ID) (entity.UserShortProjection, time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return entity.UserShortProjection{}, time.Time{}, c.err
+	}
+	if _, ok := c.notFound[id]; ok {
+		return entity.UserShortProjection{}, time.Time{}, repo.ErrRecordNotFoundCached
+	}
+	u, ok := c.projections[id]
+	if !ok {
+		return entity.UserShortProjection{}, time.Time{}, repo.ErrRecordNotFound
+	}
+
+	return u, time.Time{}, nil
+}
+
+func (c *Cache) GetMany(ctx context.Context, ids []xid.ID) (users []entity.UserShortProjection, missed []xid.ID, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+
+	users = make([]entity.UserShortProjection, 0, len(ids))
+	missed = make([]xid.ID, 0)
+	for _, id := range ids {
+		if _, ok := c.notFound[id]; ok {
+			continue
+		}
+		if u, ok := c.projections[id]; ok {
+			users = append(users, u)
+			continue
+		}
+		missed = append(missed, id)
+	}
+
+	return users, missed, nil
+}
+
+func (c *Cache) Set(ctx context.Context, id xid.ID, u entity.UserShortProjection, ttl int32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+	delete(c.notFound, id)
+	c.projections[id] = u
+	c.ttls[id] = ttl
+
+	return nil
+}
+
+func (c *Cache) SetMany(ctx context.Context, users []entity.UserShortProjection, ttl int32) error {
+	c.mu.Lock()
+	blocked, release := c.blocked, c.release
+	c.blocked = nil
+	c.mu.Unlock()
+	if blocked != nil {
+		close(blocked)
+	}
+	if release != nil {
+		<-release
+	}
+
+	for i := range users {
+		if err := c.Set(ctx, users[i].ID, users[i], ttl); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Cache) Delete(ctx context.Context, id xid.ID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+	delete(c.notFound, id)
+	delete(c.projections, id)
+	delete(c.ttls, id)
+
+	return nil
+}
+
+func (c *Cache) SetNotFound(ctx context.Context, id xid.ID, _ int32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+	delete(c.projections, id)
+	delete(c.ttls, id)
+	c.notFound[id] = struct{}{}
+
+	return nil
+}
+
+func (c *Cache) GetUser(ctx context.Context, id xid.ID) (entity.User, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return entity.User{}, c.err
+	}
+	u, ok := c.users[id]
+	if !ok {
+		return entity.User{}, repo.ErrRecordNotFound
+	}
+
+	return u, nil
+}
+
+func (c *Cache) SetUser(ctx context.Context, u entity.User, _ int32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+	c.users[u.ID] = u
+
+	return nil
+}
+
+func (c *Cache) DeleteUser(ctx context.Context, id xid.ID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+	delete(c.users, id)
+
+	return nil
+}
+
+func (c *Cache) GetIDByUsername(ctx context.Context, username string) (xid.ID, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return xid.NilID(), c.err
+	}
+	id, ok := c.usernameIDs[username]
+	if !ok {
+		return xid.NilID(), repo.ErrRecordNotFound
+	}
+
+	return id, nil
+}
+
+func (c *Cache) GetManyIDsByUsernames(ctx context.Context, usernames []string) (ids map[string]xid.ID, missed []string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+
+	ids = make(map[string]xid.ID, len(usernames))
+	missed = make([]string, 0)
+	for _, username := range usernames {
+		if id, ok := c.usernameIDs[username]; ok {
+			ids[username] = id
+			continue
+		}
+		missed = append(missed, username)
+	}
+
+	return ids, missed, nil
+}
+
+func (c *Cache) SetIDByUsername(ctx context.Context, username string, id xid.ID, _ int32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+	c.usernameIDs[username] = id
+
+	return nil
+}
+
+func (c *Cache) DeleteIDByUsername(ctx context.Context, username string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+	delete(c.usernameIDs, username)
+
+	return nil
+}
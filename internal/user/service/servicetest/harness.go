@@ -0,0 +1,55 @@
+// Package servicetest wires the user service with in-memory fakes of its dependencies for tests.
+package servicetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/caarlos0/env/v11"
+	"github.com/rs/zerolog"
+
+	"github.com/Karzoug/meower-user-service/internal/user/service"
+)
+
+// Harness is the user service with its fake repository and cache.
+type Harness struct {
+	Service service.UserService
+	Repo    *Repo
+	Cache   *Cache
+
+	closed bool
+}
+
+// New creates the user service with the default config changed by opts.
+// Early refresh of cache entries is disabled, so the service is deterministic.
+func New(t *testing.T, opts ...func(*service.Config)) *Harness {
+	t.Helper()
+
+	cfg, err := env.ParseAsWithOptions[service.Config](env.Options{Environment: map[string]string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Cache.EarlyRefreshDeltaMilliseconds = 0
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	h := &Harness{
+		Repo:  NewRepo(),
+		Cache: NewCache(),
+	}
+	h.Service = service.NewUserService(cfg, h.Repo, h.Cache, zerolog.Nop())
+	t.Cleanup(h.Flush)
+
+	return h
+}
+
+// Flush waits until asynchronous cache writes are done, the service must not be used after it.
+func (h *Harness) Flush() {
+	if h.closed {
+		return
+	}
+	h.closed = true
+
+	_ = h.Service.Close(context.Background())
+}
@@ -0,0 +1,172 @@
+package servicetest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+
+	"github.com/Karzoug/meower-user-service/internal/user/entity"
+	"github.com/Karzoug/meower-user-service/internal/user/repo"
+	"github.com/Karzoug/meower-user-service/internal/user/repo/memory"
+	"github.com/Karzoug/meower-user-service/internal/user/repo/repotest"
+)
+
+type memoryRepo interface {
+	repotest.Repository
+	Outbox() []memory.OutboxRecord
+}
+
+// Repo is an in-memory user repository, all calls fail with the error set by Fail.
+type Repo struct {
+	next memoryRepo
+
+	mu      sync.Mutex
+	err     error
+	calls   int
+	replica bool
+	blocked chan struct{}
+	release chan struct{}
+}
+
+func NewRepo() *Repo {
+	return &Repo{next: memory.NewUserRepo()}
+}
+
+// Fail makes all following calls fail with err, nil err restores the repository.
+func (r *Repo) Fail(err error) {
+	r.mu.Lock()
+	r.err = err
+	r.mu.Unlock()
+}
+
+// BlockCalls makes the following calls wait until release is called,
+// blocked is closed when the first of them starts waiting.
+func (r *Repo) BlockCalls() (blocked <-chan struct{}, release func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.blocked = make(chan struct{})
+	r.release = make(chan struct{})
+
+	var once sync.Once
+	rel := r.release
+	return r.blocked, func() { once.Do(func() { close(rel) }) }
+}
+
+// ServeFromReplica makes all following calls be recorded as served by a read replica.
+func (r *Repo) ServeFromReplica(replica bool) {
+	r.mu.Lock()
+	r.replica = replica
+	r.mu.Unlock()
+}
+
+// Calls returns the number of calls of the repository.
+func (r *Repo) Calls() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.calls
+}
+
+// Outbox returns all recorded user changes in the order of changes:
+// the outbox is the only way the service publishes events.
+func (r *Repo) Outbox() []memory.OutboxRecord {
+	return r.next.Outbox()
+}
+
+func (r *Repo) call(ctx context.Context) error {
+	r.mu.Lock()
+	blocked, release := r.blocked, r.release
+	r.blocked = nil
+	r.mu.Unlock()
+	if blocked != nil {
+		close(blocked)
+	}
+	if release != nil {
+		<-release
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls++
+	if r.err == nil && r.replica {
+		repo.MarkReplicaRead(ctx)
+	}
+	return r.err
+}
+
+func (r *Repo) Create(ctx context.Context, user entity.User) (xid.ID, error) {
+	if err := r.call(ctx); err != nil {
+		return xid.NilID(), err
+	}
+	return r.next.Create(ctx, user)
+}
+
+func (r *Repo) GetOne(ctx context.Context, id xid.ID) (entity.User, error) {
+	if err := r.call(ctx); err != nil {
+		return entity.User{}, err
+	}
+	return r.next.GetOne(ctx, id)
+}
+
+func (r *Repo) GetOneShortProjection(ctx context.Context, id xid.ID) (entity.UserShortProjection, error) {
+	if err := r.call(ctx); err != nil {
+		return entity.UserShortProjection{}, err
+	}
+	return r.next.GetOneShortProjection(ctx, id)
+}
+
+func (r *Repo) GetOneShortProjectionByUsername(ctx context.Context, username string) (entity.UserShortProjection, error) {
+	if err := r.call(ctx); err != nil {
+		return entity.UserShortProjection{}, err
+	}
+	return r.next.GetOneShortProjectionByUsername(ctx, username)
+}
+
+func (r *Repo) GetManyShortProjections(ctx context.Context, ids []xid.ID) ([]entity.UserShortProjection, error) {
+	if err := r.call(ctx); err != nil {
+		return nil, err
+	}
+	return r.next.GetManyShortProjections(ctx, ids)
+}
+
+func (r *Repo) GetManyShortProjectionsByUsernames(ctx context.Context, usernames []string) ([]entity.UserShortProjection, error) {
+	if err := r.call(ctx); err != nil {
+		return nil, err
+	}
+	return r.next.GetManyShortProjectionsByUsernames(ctx, usernames)
+}
+
+func (r *Repo) Update(ctx context.Context, u entity.User) (time.Time, error) {
+	if err := r.call(ctx); err != nil {
+		return time.Time{}, err
+	}
+	return r.next.Update(ctx, u)
+}
+
+func (r *Repo) UpdateUsername(ctx context.Context, username, newUsername string) (xid.ID, error) {
+	if err := r.call(ctx); err != nil {
+		return xid.NilID(), err
+	}
+	return r.next.UpdateUsername(ctx, username, newUsername)
+}
+
+func (r *Repo) DeleteByUsername(ctx context.Context, username string) (xid.ID, error) {
+	if err := r.call(ctx); err != nil {
+		return xid.NilID(), err
+	}
+	return r.next.DeleteByUsername(ctx, username)
+}
+
+func (r *Repo) ForEachRecentShortProjections(ctx context.Context,
+	limit, batchSize int,
+	fn func([]entity.UserShortProjection) error,
+) error {
+	if err := r.call(ctx); err != nil {
+		return err
+	}
+	return r.next.ForEachRecentShortProjections(ctx, limit, batchSize, fn)
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+
+	"github.com/Karzoug/meower-user-service/internal/user/entity"
+)
+
+// WarmUpCache fills the short projections cache with the most recently updated users
+// in rate limited batches, users read from a replica are cached with the replica ttl.
+// Users changed since the stream started are not cached: the stream may have read them before the change.
+// It returns the number of cached users and stops when the context is done.
+func (us UserService) WarmUpCache(ctx context.Context) (int, error) {
+	limiter := rate.NewLimiter(rate.Limit(us.cfg.WarmUp.BatchesPerSecond), 1)
+	// the whole stream is read from one snapshot taken when it starts
+	ctx, gen := us.cacheWriter.capture(ctx)
+
+	var n int
+	err := us.repo.ForEachRecentShortProjections(ctx, us.cfg.WarmUp.Limit, us.cfg.WarmUp.BatchSize,
+		func(users []entity.UserShortProjection) error {
+			if err := limiter.Wait(ctx); err != nil {
+				return err
+			}
+			written, err := us.cacheWriter.setShortProjectionsNow(gen, users)
+			n += written
+
+			return err
+		})
+
+	return n, err
+}
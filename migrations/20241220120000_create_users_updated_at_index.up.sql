@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS users_updated_at_idx ON users (updated_at DESC);
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE outbox DROP COLUMN trace_context;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE outbox ADD COLUMN trace_context JSONB DEFAULT NULL;
\ No newline at end of file